@@ -2,20 +2,31 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/jackgris/twitter-backend/auth/internal/handler"
+	"github.com/jackgris/twitter-backend/auth/internal/store"
+	"github.com/jackgris/twitter-backend/auth/internal/store/attemptdb"
+	"github.com/jackgris/twitter-backend/auth/internal/store/ratelimitdb"
 	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/jackgris/twitter-backend/auth/pkg/attempts"
 	"github.com/jackgris/twitter-backend/auth/pkg/database"
 	"github.com/jackgris/twitter-backend/auth/pkg/logger"
+	"github.com/jackgris/twitter-backend/auth/pkg/mailer"
 	"github.com/jackgris/twitter-backend/auth/pkg/msgbroker"
+	"github.com/jackgris/twitter-backend/auth/pkg/oidc"
+	"github.com/jackgris/twitter-backend/auth/pkg/ratelimit"
+	"github.com/jackgris/twitter-backend/auth/pkg/token"
 )
 
 func main() {
@@ -31,7 +42,7 @@ func main() {
 func run(ctx context.Context, serviceName string, log *logger.Logger) error {
 
 	db := database.ConnectDB(ctx, log)
-	defer db.Close(ctx)
+	defer db.Close()
 
 	store := userdb.NewStore(db)
 
@@ -42,7 +53,58 @@ func run(ctx context.Context, serviceName string, log *logger.Logger) error {
 	}
 	msgbroker := msgbroker.NewMsgBroker(serviceName, msgBrokerPath, log)
 
-	mux, u := handler.NewHandler(store, msgbroker, log)
+	keys, err := token.LoadKeys(getEnv("JWT_KEYS_DIR", "../keys"))
+	if err != nil {
+		log.Error(ctx, serviceName, "status", "Loading JWT signing keys", "error", err)
+		os.Exit(1)
+	}
+
+	accessTTL := 15 * time.Minute
+	if ttl := os.Getenv("ACCESS_TOKEN_TTL"); ttl != "" {
+		accessTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			log.Error(ctx, serviceName, "status", "Environment variable ACCESS_TOKEN_TTL is not a duration")
+			os.Exit(1)
+		}
+	}
+	if accessTTL > time.Hour {
+		log.Error(ctx, serviceName, "status", "ACCESS_TOKEN_TTL can't be longer than 1h, use refresh tokens instead")
+		os.Exit(1)
+	}
+
+	refreshTTL := 30 * 24 * time.Hour
+	if ttl := os.Getenv("REFRESH_TOKEN_TTL"); ttl != "" {
+		refreshTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			log.Error(ctx, serviceName, "status", "Environment variable REFRESH_TOKEN_TTL is not a duration")
+			os.Exit(1)
+		}
+	}
+	tokens, err := token.NewIssuer(keys, os.Getenv("JWT_SIGNING_KEY_ID"), getEnv("JWT_ISSUER", "twitter-backend-auth"), getEnv("JWT_AUDIENCE", "twitter-backend"), accessTTL, refreshTTL)
+	if err != nil {
+		log.Error(ctx, serviceName, "status", "Creating JWT issuer", "error", err)
+		os.Exit(1)
+	}
+
+	config, err := handlerConfig(ctx, db)
+	if err != nil {
+		log.Error(ctx, serviceName, "status", "Reading handler configuration", "error", err)
+		os.Exit(1)
+	}
+	if os.Getenv("EMAIL_TOKEN_SECRET") == "" {
+		log.Info(ctx, serviceName, "status", "EMAIL_TOKEN_SECRET is empty, email links won't survive a restart")
+	}
+
+	suggestionsInterval := time.Hour
+	if interval := os.Getenv("SUGGESTIONS_INTERVAL"); interval != "" {
+		suggestionsInterval, err = time.ParseDuration(interval)
+		if err != nil || suggestionsInterval <= 0 {
+			log.Error(ctx, serviceName, "status", "Environment variable SUGGESTIONS_INTERVAL is not a positive duration")
+			os.Exit(1)
+		}
+	}
+
+	mux, u := handler.NewHandler(store, msgbroker, tokens, config, log)
 
 	portEnv := os.Getenv("PORT")
 	port, err := strconv.Atoi(portEnv)
@@ -70,6 +132,14 @@ func run(ctx context.Context, serviceName string, log *logger.Logger) error {
 		u.SubscribeGetFollowers()
 	}()
 
+	go func() {
+		u.MigratePlaintextPasswords()
+	}()
+
+	go func() {
+		u.RefreshSuggestions(suggestionsInterval)
+	}()
+
 	// -------------------------------------------------------------------------
 	// Shutdown
 
@@ -92,3 +162,163 @@ func run(ctx context.Context, serviceName string, log *logger.Logger) error {
 
 	return nil
 }
+
+// accountAttempts slows down guessing the password of an account: a few
+// tries are free, then every failure doubles the wait, and 10 failures lock
+// the account for 15 minutes.
+var accountAttempts = attempts.Policy{
+	Free:            5,
+	BaseDelay:       time.Second,
+	MaxDelay:        5 * time.Minute,
+	LockoutAfter:    10,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+// ipAttempts is more lenient than accountAttempts, many users can share an
+// IP address behind a NAT.
+var ipAttempts = attempts.Policy{
+	Free:            20,
+	BaseDelay:       time.Second,
+	MaxDelay:        5 * time.Minute,
+	LockoutAfter:    100,
+	LockoutDuration: time.Hour,
+	Window:          time.Hour,
+}
+
+const (
+	// resetsPerEmail is how many reset emails an address gets per hour, so
+	// it can't be flooded with them
+	resetsPerEmail = 3
+	// resetsPerIP is how many resets an IP address can ask for per hour
+	resetsPerIP = 20
+	// verificationsPerUser is how many verification emails a user can ask
+	// for per hour, so they can't flood the address they set
+	verificationsPerUser = 3
+)
+
+// handlerConfig reads the settings of the handlers from the environment.
+func handlerConfig(ctx context.Context, db store.PgxIface) (handler.Config, error) {
+	var config handler.Config
+
+	from := getEnv("MAIL_FROM", "no-reply@twitter-backend.local")
+	switch driver := getEnv("MAIL_DRIVER", "file"); driver {
+	case "smtp":
+		addr := os.Getenv("SMTP_ADDR")
+		if addr == "" {
+			return config, errors.New("environment variable SMTP_ADDR is empty")
+		}
+		config.Mailer = mailer.NewSMTP(addr, from, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
+	case "file":
+		config.Mailer = mailer.NewFile(getEnv("MAIL_DIR", "./mail"), from)
+	default:
+		return config, fmt.Errorf("unknown MAIL_DRIVER %q", driver)
+	}
+
+	secret := []byte(os.Getenv("EMAIL_TOKEN_SECRET"))
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return config, fmt.Errorf("generating email token secret: %w", err)
+		}
+	}
+	config.Signer = token.NewSigner(secret)
+
+	config.VerifyEmailURL = getEnv("VERIFY_EMAIL_URL", "http://localhost:8080/verify-email?token=")
+
+	config.VerifyEmailTTL = 24 * time.Hour
+	if ttl := os.Getenv("VERIFY_EMAIL_TTL"); ttl != "" {
+		var err error
+		config.VerifyEmailTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			return config, errors.New("environment variable VERIFY_EMAIL_TTL is not a duration")
+		}
+	}
+
+	config.ResetPasswordURL = getEnv("RESET_PASSWORD_URL", "http://localhost:8080/reset-password?token=")
+
+	config.ResetPasswordTTL = time.Hour
+	if ttl := os.Getenv("RESET_PASSWORD_TTL"); ttl != "" {
+		var err error
+		config.ResetPasswordTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			return config, errors.New("environment variable RESET_PASSWORD_TTL is not a duration")
+		}
+	}
+
+	switch tracker := getEnv("LOGIN_ATTEMPTS_STORE", "postgres"); tracker {
+	case "postgres":
+		config.LoginAccounts = attemptdb.NewStore(db, accountAttempts)
+		config.LoginIPs = attemptdb.NewStore(db, ipAttempts)
+	case "memory":
+		config.LoginAccounts = attempts.NewMemory(accountAttempts)
+		config.LoginIPs = attempts.NewMemory(ipAttempts)
+	default:
+		return config, fmt.Errorf("unknown LOGIN_ATTEMPTS_STORE %q", tracker)
+	}
+
+	config.AdminToken = os.Getenv("ADMIN_TOKEN")
+	config.MFAIssuer = getEnv("MFA_ISSUER", "Twitter Backend")
+
+	importsPerHour, err := strconv.Atoi(getEnv("IMPORT_FOLLOWS_PER_HOUR", "400"))
+	if err != nil || importsPerHour < 1 {
+		return config, errors.New("environment variable IMPORT_FOLLOWS_PER_HOUR is not a positive number")
+	}
+	switch limiter := getEnv("RATE_LIMIT_STORE", "postgres"); limiter {
+	case "postgres":
+		config.FollowImports = ratelimitdb.NewStore(db, importsPerHour, time.Hour)
+		config.ResetEmails = ratelimitdb.NewStore(db, resetsPerEmail, time.Hour)
+		config.ResetIPs = ratelimitdb.NewStore(db, resetsPerIP, time.Hour)
+		config.VerificationEmails = ratelimitdb.NewStore(db, verificationsPerUser, time.Hour)
+	case "memory":
+		config.FollowImports = ratelimit.NewWindow(importsPerHour, time.Hour)
+		config.ResetEmails = ratelimit.NewWindow(resetsPerEmail, time.Hour)
+		config.ResetIPs = ratelimit.NewWindow(resetsPerIP, time.Hour)
+		config.VerificationEmails = ratelimit.NewWindow(verificationsPerUser, time.Hour)
+	default:
+		return config, fmt.Errorf("unknown RATE_LIMIT_STORE %q", limiter)
+	}
+
+	config.UsernameCooldown = 7 * 24 * time.Hour
+	if cooldown := os.Getenv("USERNAME_CHANGE_COOLDOWN"); cooldown != "" {
+		config.UsernameCooldown, err = time.ParseDuration(cooldown)
+		if err != nil {
+			return config, errors.New("environment variable USERNAME_CHANGE_COOLDOWN is not a duration")
+		}
+	}
+
+	config.UsernameReservation = 30 * 24 * time.Hour
+	if reservation := os.Getenv("USERNAME_RESERVATION"); reservation != "" {
+		config.UsernameReservation, err = time.ParseDuration(reservation)
+		if err != nil {
+			return config, errors.New("environment variable USERNAME_RESERVATION is not a duration")
+		}
+	}
+
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		clientID := os.Getenv("OIDC_CLIENT_ID")
+		if clientID == "" {
+			return config, errors.New("environment variable OIDC_CLIENT_ID is empty")
+		}
+		provider, err := oidc.Discover(ctx, oidc.Config{
+			Issuer:       issuer,
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  getEnv("OIDC_REDIRECT_URL", "http://localhost:8080/auth/oidc/callback"),
+			Scopes:       strings.Fields(getEnv("OIDC_SCOPES", "email profile")),
+		})
+		if err != nil {
+			return config, fmt.Errorf("discovering OIDC provider: %w", err)
+		}
+		config.OIDC = provider
+	}
+
+	return config, nil
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
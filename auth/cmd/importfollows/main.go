@@ -0,0 +1,159 @@
+// Command importfollows follows in bulk the users listed in a file, one
+// username or ID per line, through the import endpoint of the auth service.
+// It also reads the CSV exports of the service, taking the first column.
+// The result of every row is written to stdout as CSV. Running it again with
+// the same file only follows the users that are missing.
+//
+//	ACCESS_TOKEN=... go run ./cmd/importfollows -file following.csv
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type result struct {
+	Input  string `json:"input"`
+	UserID string `json:"user_id"`
+	Status string `json:"status"`
+}
+
+func main() {
+	api := flag.String("api", "http://localhost:8080/auth", "URL of the auth service")
+	file := flag.String("file", "-", "file with a username or ID per line, - reads stdin")
+	batch := flag.Int("batch", 100, "rows sent in each request, up to 500")
+	wait := flag.Bool("wait", false, "wait and retry the rows over the import limit instead of reporting them as rate_limited")
+	flag.Parse()
+
+	if *batch < 1 || *batch > 500 {
+		fmt.Fprintln(os.Stderr, "batch must be between 1 and 500")
+		os.Exit(2)
+	}
+
+	token := os.Getenv("ACCESS_TOKEN")
+	if token == "" {
+		fmt.Fprintln(os.Stderr, "ACCESS_TOKEN is empty, log in and set it to the access token")
+		os.Exit(2)
+	}
+
+	rows, err := readRows(*file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "reading rows:", err)
+		os.Exit(1)
+	}
+
+	out := csv.NewWriter(os.Stdout)
+	_ = out.Write([]string{"input", "user_id", "status"})
+
+	client := &http.Client{Timeout: time.Minute}
+	counts := make(map[string]int)
+	for start := 0; start < len(rows); start += *batch {
+		pending := rows[start:min(start+*batch, len(rows))]
+		for len(pending) > 0 {
+			results, retryAfter, err := importRows(client, *api, token, pending)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "importing rows:", err)
+				os.Exit(1)
+			}
+
+			pending = nil
+			for _, r := range results {
+				if r.Status == "rate_limited" && *wait {
+					pending = append(pending, r.Input)
+					continue
+				}
+				counts[r.Status]++
+				_ = out.Write([]string{r.Input, r.UserID, r.Status})
+			}
+			out.Flush()
+
+			if len(pending) > 0 {
+				fmt.Fprintf(os.Stderr, "import limit reached, waiting %s\n", retryAfter)
+				time.Sleep(retryAfter)
+			}
+		}
+	}
+
+	out.Flush()
+	for status, n := range counts {
+		fmt.Fprintf(os.Stderr, "%s: %d\n", status, n)
+	}
+}
+
+// readRows returns the non empty lines of file, or the first column of a CSV
+// export without its header.
+func readRows(file string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var rows []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		line, _, _ = strings.Cut(line, ",")
+		if line == "" || strings.HasPrefix(line, "#") || line == "id" {
+			continue
+		}
+		rows = append(rows, line)
+	}
+
+	return rows, scanner.Err()
+}
+
+// importRows sends one batch and returns its results and, when rows were
+// over the limit, how long to wait before sending them again.
+func importRows(client *http.Client, api, token string, rows []string) ([]result, time.Duration, error) {
+	body, err := json.Marshal(map[string][]string{"users": rows})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(api, "/")+"/following/import", bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, 0, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var answer struct {
+		Results []result `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return nil, 0, err
+	}
+
+	retryAfter := time.Minute
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+
+	return answer.Results, retryAfter, nil
+}
@@ -0,0 +1,43 @@
+// Command mockoidc runs a mock OpenID Connect provider to try the OIDC login
+// of the auth service locally. Every login signs in the same user.
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"github.com/jackgris/twitter-backend/auth/pkg/logger"
+	"github.com/jackgris/twitter-backend/auth/pkg/oidc/oidctest"
+)
+
+func main() {
+	ctx := context.Background()
+	log := logger.New(os.Stdout)
+
+	addr := getEnv("ADDR", ":9000")
+	issuer, err := oidctest.New(getEnv("OIDC_ISSUER", "http://localhost:9000"), getEnv("OIDC_CLIENT_ID", "twitter-backend"), oidctest.User{
+		Subject:           getEnv("OIDC_SUBJECT", "mock-user"),
+		Email:             getEnv("OIDC_EMAIL", "mock-user@example.com"),
+		EmailVerified:     true,
+		Name:              getEnv("OIDC_NAME", "Mock User"),
+		PreferredUsername: getEnv("OIDC_USERNAME", "mock_user"),
+	})
+	if err != nil {
+		log.Error(ctx, "mock oidc", "status", "Creating issuer", "error", err)
+		os.Exit(1)
+	}
+
+	log.Info(ctx, "mock oidc startup", "issuer", issuer.URL, "address", addr)
+	if err := http.ListenAndServe(addr, issuer); err != nil {
+		log.Error(ctx, "mock oidc", "status", "Server error", "error", err)
+		os.Exit(1)
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -15,8 +15,35 @@ type User struct {
 	Token          string
 	DateCreated    time.Time
 	EncodedDate    string
-	Followers      []UserFollowers
-	Following      []UserFollowers
+	Version        int
+	Protected      bool
+	// EmailVerifiedAt is nil until the user proves they own the email
+	EmailVerifiedAt *time.Time
+	// Role is user, moderator or admin
+	Role string
+	// SuspendedAt is nil unless a moderator suspended the account
+	SuspendedAt *time.Time
+	// Profile, every field is optional
+	DisplayName string
+	Bio         string
+	AvatarURL   string
+	Location    string
+	Website     string
+}
+
+// UserPatch holds the fields a profile update changes, nil fields are left
+// as they are.
+type UserPatch struct {
+	UserName    *string
+	Email       *string
+	Password    *string
+	Salt        *string
+	Protected   *bool
+	DisplayName *string
+	Bio         *string
+	AvatarURL   *string
+	Location    *string
+	Website     *string
 }
 
 type UserFollowers struct {
@@ -24,3 +51,150 @@ type UserFollowers struct {
 	UserID     string
 	FollowerID string
 }
+
+// UserSummary is the public part of a user shown in listings.
+type UserSummary struct {
+	ID             string
+	UserName       string
+	DisplayName    string
+	AvatarURL      string
+	FollowerCount  int
+	FollowingCount int
+}
+
+// UserPage is a page of a users listing, like followers or blocked users.
+// NextCursor is empty on the last page.
+type UserPage struct {
+	Users      []UserSummary
+	NextCursor string
+}
+
+// FollowRequest is a follow of a protected user waiting for its approval.
+type FollowRequest struct {
+	ID         string
+	UserID     string
+	FollowerID string
+	CreatedAt  time.Time
+}
+
+// Relationship is a block or a mute of TargetID by UserID.
+type Relationship struct {
+	ID        string
+	UserID    string
+	TargetID  string
+	CreatedAt time.Time
+}
+
+type RefreshToken struct {
+	ID        string
+	UserID    string
+	FamilyID  string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	RotatedAt *time.Time
+	RevokedAt *time.Time
+}
+
+// PasswordResetToken lets a user who forgot their password set a new one.
+// Only the hash of the token sent by email is stored.
+type PasswordResetToken struct {
+	ID        string
+	UserID    string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// UserIdentity links a user to their account at an OpenID Connect provider.
+type UserIdentity struct {
+	ID        string
+	UserID    string
+	Issuer    string
+	Subject   string
+	Email     string
+	CreatedAt time.Time
+}
+
+// MFA is the TOTP second factor of a user. It only protects the logins once
+// EnabledAt is set, after the user confirmed they can generate codes.
+type MFA struct {
+	UserID    string
+	Secret    string
+	CreatedAt time.Time
+	EnabledAt *time.Time
+	// LastStep is the time step of the last code used, codes can't be used
+	// twice
+	LastStep int64
+}
+
+// Session is a login of a user, it lasts as long as the refresh tokens
+// rotated from that login. Its ID is the family ID of those tokens.
+type Session struct {
+	ID         string
+	UserID     string
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+// Suggestion is a user someone may want to follow.
+type Suggestion struct {
+	User  UserSummary
+	Score float64
+	// FriendsOfFriends is how many users followed by the user follow the
+	// suggested one
+	FriendsOfFriends int
+	// MutualFollowers is how many users follow both
+	MutualFollowers int
+}
+
+// RelationshipStatus is how a user relates to another one, in both
+// directions. Mutes are private, so only the ones of the user are shown.
+type RelationshipStatus struct {
+	TargetID   string
+	Following  bool
+	FollowedBy bool
+	// FollowRequested is a follow request of the user waiting for the
+	// approval of the target, FollowRequestReceived the other way around
+	FollowRequested       bool
+	FollowRequestReceived bool
+	Blocking              bool
+	BlockedBy             bool
+	Muting                bool
+}
+
+// UsernameChange is a change of the username of a user. The old username is
+// reserved for the user until ReservedUntil.
+type UsernameChange struct {
+	UserID        string
+	OldUsername   string
+	NewUsername   string
+	ChangedAt     time.Time
+	ReservedUntil time.Time
+	// NextChangeAt is when the user can change their username again
+	NextChangeAt time.Time
+}
+
+// APIKey lets a bot account call the services without logging in. Only the
+// hash of the key is stored, Prefix is the start of the key that tells keys
+// apart in listings.
+type APIKey struct {
+	ID      string
+	UserID  string
+	Name    string
+	Prefix  string
+	KeyHash string
+	// Scopes are what the key can call, like tweet:write or timeline:read
+	Scopes []string
+	// CreatedBy is the admin who created the key
+	CreatedBy  string
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	// Username is of the bot, VerifyAPIKey fills it
+	Username string
+}
@@ -0,0 +1,253 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/jackgris/twitter-backend/auth/pkg/middleware"
+	"github.com/jackgris/twitter-backend/auth/pkg/uuid"
+)
+
+// maxSuspensionReason is how many characters of the reason of a suspension
+// are kept.
+const maxSuspensionReason = 500
+
+// adminOnly lets through the requests of users whose role has perm. The
+// admin token in X-Admin-Token can do everything, it is how the first admin
+// is named. Without an admin token configured only roles are accepted.
+func (u UserHandler) adminOnly(next http.HandlerFunc, perm middleware.Permission) http.HandlerFunc {
+	authorized := middleware.Authorize(middleware.Require(next, perm), u.keys)
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-Admin-Token")
+		if token == "" {
+			authorized(w, r)
+			return
+		}
+
+		if u.config.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(u.config.AdminToken)) != 1 {
+			http.Error(w, "admin token invalid", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// moderator returns who takes an admin action, for the logs, and whether
+// they have perm. Requests with the admin token have no claims and can do
+// everything.
+func moderator(r *http.Request, perm middleware.Permission) (string, bool) {
+	claims, ok := middleware.ClaimsFromContext(r.Context())
+	if !ok {
+		return "admin token", true
+	}
+	return claims.UserID, claims.Can(perm)
+}
+
+// adminTarget returns the valid user ID of the path, refusing the caller's
+// own account, so nobody locks themselves out.
+func adminTarget(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID := r.PathValue("id")
+	if ok := uuid.IsValid(userID); !ok {
+		http.Error(w, "user id invalid", http.StatusBadRequest)
+		return "", false
+	}
+
+	if claims, ok := middleware.ClaimsFromContext(r.Context()); ok && claims.UserID == userID {
+		http.Error(w, "you can't do this to your own account", http.StatusForbidden)
+		return "", false
+	}
+
+	return userID, true
+}
+
+// outranks refuses moderators acting on moderators and admins, only admins
+// can. It answers the request when the caller doesn't outrank userID.
+func (u UserHandler) outranks(w http.ResponseWriter, r *http.Request, userID, action string) bool {
+	user, err := u.store.GetUserbyID(userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		}
+		return false
+	}
+
+	_, canManageRoles := moderator(r, middleware.PermManageRoles)
+	if role, _ := middleware.ParseRole(user.Role); role != middleware.RoleUser && !canManageRoles {
+		http.Error(w, "only admins can "+action+" moderators and admins", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// SuspendUser suspends an account and logs it out everywhere. The other
+// services reject its access tokens and hide its tweets. Only admins can
+// suspend moderators and admins.
+func (u UserHandler) SuspendUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := adminTarget(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if input.Reason == "" {
+		http.Error(w, "reason is required", http.StatusBadRequest)
+		return
+	}
+
+	if !u.outranks(w, r, userID, "suspend") {
+		return
+	}
+
+	err := u.store.SuspendUser(userID, truncateRunes(input.Reason, maxSuspensionReason))
+	if err != nil {
+		if errors.Is(err, userdb.ErrUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		u.logs.Error(r.Context(), "auth service", "suspending user", err, "user ID", userID)
+		http.Error(w, "Can't suspend user", http.StatusInternalServerError)
+		return
+	}
+
+	u.msgBroker.PublishMessages(usersTopic, NewUserSuspension(userID, true))
+
+	moderatorID, _ := moderator(r, middleware.PermSuspendUsers)
+	u.logs.Info(r.Context(), "auth service", "user suspended", "user ID", userID, "moderator ID", moderatorID, "reason", input.Reason)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnsuspendUser lifts the suspension of an account, which has to log in
+// again. Only admins can unsuspend moderators and admins.
+func (u UserHandler) UnsuspendUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := adminTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if !u.outranks(w, r, userID, "unsuspend") {
+		return
+	}
+
+	err := u.store.UnsuspendUser(userID)
+	if err != nil {
+		if errors.Is(err, userdb.ErrUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		u.logs.Error(r.Context(), "auth service", "unsuspending user", err, "user ID", userID)
+		http.Error(w, "Can't unsuspend user", http.StatusInternalServerError)
+		return
+	}
+
+	u.msgBroker.PublishMessages(usersTopic, NewUserSuspension(userID, false))
+
+	moderatorID, _ := moderator(r, middleware.PermSuspendUsers)
+	u.logs.Info(r.Context(), "auth service", "user unsuspended", "user ID", userID, "moderator ID", moderatorID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutUser logs an account out everywhere. Its access tokens keep working
+// until they expire, suspend the account to reject them right away. Only
+// admins can log out moderators and admins.
+func (u UserHandler) LogoutUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := adminTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if !u.outranks(w, r, userID, "log out") {
+		return
+	}
+
+	if err := u.store.RevokeAllSessions(userID); err != nil {
+		u.logs.Error(r.Context(), "auth service", "logging user out", err, "user ID", userID)
+		http.Error(w, "Can't revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	moderatorID, _ := moderator(r, middleware.PermLogoutUsers)
+	u.logs.Info(r.Context(), "auth service", "user logged out by moderator", "user ID", userID, "moderator ID", moderatorID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetUserRole changes the role of an account. Every service checks the
+// current role, the access tokens of the account keep working with the new
+// one.
+func (u UserHandler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	userID, ok := adminTarget(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	role, ok := middleware.ParseRole(input.Role)
+	if !ok {
+		http.Error(w, "role must be user, moderator or admin", http.StatusBadRequest)
+		return
+	}
+
+	err := u.store.SetRole(userID, string(role))
+	if err != nil {
+		if errors.Is(err, userdb.ErrUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		u.logs.Error(r.Context(), "auth service", "changing role", err, "user ID", userID)
+		http.Error(w, "Can't change role", http.StatusInternalServerError)
+		return
+	}
+
+	u.msgBroker.PublishMessages(usersTopic, NewUserRoleChanged(userID, string(role)))
+
+	moderatorID, _ := moderator(r, middleware.PermManageRoles)
+	u.logs.Info(r.Context(), "auth service", "role changed", "user ID", userID, "role", role, "moderator ID", moderatorID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteUser deletes an account, the other services purge its tweets and
+// timelines.
+func (u UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := adminTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := u.store.Delete(userID)
+	if err != nil {
+		if errors.Is(err, userdb.ErrDeleteUser) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		u.logs.Error(r.Context(), "auth service", "deleting user", err, "user ID", userID)
+		http.Error(w, "Can't delete user", http.StatusInternalServerError)
+		return
+	}
+
+	u.msgBroker.PublishMessages(usersTopic, NewUserDeleted(userID))
+
+	moderatorID, _ := moderator(r, middleware.PermDeleteUsers)
+	u.logs.Info(r.Context(), "auth service", "user deleted by moderator", "user ID", userID, "moderator ID", moderatorID)
+	w.WriteHeader(http.StatusNoContent)
+}
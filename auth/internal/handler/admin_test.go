@@ -0,0 +1,74 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModeratorsCantActOnStaff(t *testing.T) {
+	roles := map[string]string{
+		"csvqvamek44s73e2qfa0": "admin",
+		"csvqvamek44s73e2qfb0": "moderator",
+		"csvqvamek44s73e2qfc0": "user",
+	}
+	acted := map[string]bool{}
+	store := &MockStore{
+		GetUserbyIDFunc: func(id string) (usermodel.User, error) {
+			role, ok := roles[id]
+			if !ok {
+				return usermodel.User{}, pgx.ErrNoRows
+			}
+			return usermodel.User{ID: id, Role: role}, nil
+		},
+		UnsuspendUserFunc: func(userID string) error {
+			acted[userID] = true
+			return nil
+		},
+		RevokeAllSessionsFunc: func(userID string) error {
+			acted[userID] = true
+			return nil
+		},
+	}
+	h := newHandler(t, store)
+
+	handlers := map[string]http.HandlerFunc{
+		"Unsuspend": h.UnsuspendUser,
+		"Logout":    h.LogoutUser,
+	}
+
+	tests := []struct {
+		name         string
+		role         middleware.Role
+		targetID     string
+		expectedCode int
+	}{
+		{name: "Moderator on user", role: middleware.RoleModerator, targetID: "csvqvamek44s73e2qfc0", expectedCode: http.StatusNoContent},
+		{name: "Moderator on moderator", role: middleware.RoleModerator, targetID: "csvqvamek44s73e2qfb0", expectedCode: http.StatusForbidden},
+		{name: "Moderator on admin", role: middleware.RoleModerator, targetID: "csvqvamek44s73e2qfa0", expectedCode: http.StatusForbidden},
+		{name: "Admin on moderator", role: middleware.RoleAdmin, targetID: "csvqvamek44s73e2qfb0", expectedCode: http.StatusNoContent},
+		{name: "Unknown user", role: middleware.RoleModerator, targetID: "csvqvamek44s73e2qfd0", expectedCode: http.StatusNotFound},
+	}
+
+	for action, handle := range handlers {
+		for _, test := range tests {
+			t.Run(action+" "+test.name, func(t *testing.T) {
+				clear(acted)
+				req := httptest.NewRequest(http.MethodPost, "/admin/users/"+test.targetID, nil)
+				req.SetPathValue("id", test.targetID)
+				req = req.WithContext(middleware.ContextWithClaims(req.Context(), middleware.Claims{UserID: "csvqvamek44s73e2qfe0", Role: test.role}))
+				rec := httptest.NewRecorder()
+
+				handle(rec, req)
+
+				assert.Equal(t, test.expectedCode, rec.Code)
+				assert.Equal(t, test.expectedCode == http.StatusNoContent, acted[test.targetID])
+			})
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/jackgris/twitter-backend/auth/pkg/middleware"
+	"github.com/jackgris/twitter-backend/auth/pkg/password"
+	"github.com/jackgris/twitter-backend/auth/pkg/token"
+	"github.com/jackgris/twitter-backend/auth/pkg/uuid"
+	"github.com/jackgris/twitter-backend/auth/pkg/validator"
+)
+
+// apiKeyStore verifies API keys against the database, for the routes of
+// this service. The other services ask VerifyAPIKey.
+type apiKeyStore struct {
+	store Store
+}
+
+func (s apiKeyStore) VerifyAPIKey(_ context.Context, key string) (middleware.APIKey, error) {
+	if !strings.HasPrefix(key, middleware.APIKeyPrefix) {
+		return middleware.APIKey{}, middleware.ErrInvalidAPIKey
+	}
+
+	apiKey, err := s.store.VerifyAPIKey(token.HashOpaque(key))
+	if err != nil {
+		if errors.Is(err, userdb.ErrInvalidAPIKey) {
+			return middleware.APIKey{}, middleware.ErrInvalidAPIKey
+		}
+		return middleware.APIKey{}, err
+	}
+
+	// Scopes that no longer exist are dropped
+	var scopes []middleware.Scope
+	for _, name := range apiKey.Scopes {
+		if scope, ok := middleware.ParseScope(name); ok {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return middleware.APIKey{
+		ID:       apiKey.ID,
+		UserID:   apiKey.UserID,
+		Username: apiKey.Username,
+		Scopes:   scopes,
+	}, nil
+}
+
+// newAPIKey returns a random API key and its prefix. The prefix is the
+// public part shown in listings, the rest is an opaque token.
+func newAPIKey() (key, prefix string, err error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	prefix = middleware.APIKeyPrefix + hex.EncodeToString(b)
+
+	secret, err := token.NewOpaque()
+	if err != nil {
+		return "", "", err
+	}
+
+	return prefix + "_" + secret, prefix, nil
+}
+
+// VerifyAPIKey tells the other services which bot an API key belongs to and
+// what it can call, and records the key was used.
+func (u UserHandler) VerifyAPIKey(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Key string `json:"key"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	apiKey, err := apiKeyStore{store: u.store}.VerifyAPIKey(r.Context(), input.Key)
+	if err != nil {
+		if errors.Is(err, middleware.ErrInvalidAPIKey) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		u.logs.Error(r.Context(), "auth service", "verifying API key", err)
+		http.Error(w, "Can't verify API key", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(apiKey)
+}
+
+// CreateBot creates a bot account, for internal tools that used to share
+// the credentials of a person. Bots can't log in, they get API keys.
+func (u UserHandler) CreateBot(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		UserName    string `json:"username"`
+		DisplayName string `json:"display_name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	v := validator.New()
+	validator.ValidateName(v, input.UserName)
+	validator.ValidateDisplayName(v, input.DisplayName)
+	if !v.Valid() {
+		http.Error(w, validationError(v), http.StatusBadRequest)
+		return
+	}
+
+	// Like the users of OIDC logins, the password is random and never shown
+	secret, err := token.NewOpaque()
+	if err != nil {
+		http.Error(w, "Can't create bot", http.StatusInternalServerError)
+		return
+	}
+	hash, salt, err := password.Hash(secret)
+	if err != nil {
+		http.Error(w, "Can't hash bot password", http.StatusInternalServerError)
+		return
+	}
+
+	bot, err := u.store.CreateBot(usermodel.User{
+		UserName:    input.UserName,
+		Password:    hash,
+		Salt:        salt,
+		DisplayName: input.DisplayName,
+	})
+	if err != nil {
+		if errors.Is(err, userdb.ErrUsernameTaken) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		u.logs.Error(r.Context(), "auth service", "creating bot", err)
+		http.Error(w, "Can't save bot in database", http.StatusInternalServerError)
+		return
+	}
+
+	adminID, _ := moderator(r, middleware.PermManageBots)
+	u.logs.Info(r.Context(), "auth service", "bot created", "user ID", bot.ID, "admin ID", adminID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(UserToJSON(bot))
+}
+
+// maxAPIKeyName is how many characters the name of an API key can have.
+const maxAPIKeyName = 100
+
+// CreateAPIKey creates an API key for a bot with the scopes it needs, and
+// an optional expiry. The key is only shown in this response, only its hash
+// is stored.
+func (u UserHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	botID, ok := adminTarget(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Name != "", "name", "must be provided")
+	validator.ValidateText(v, "name", input.Name, maxAPIKeyName)
+	v.Check(len(input.Scopes) > 0, "scopes", "must be provided")
+	v.Check(validator.Unique(input.Scopes), "scopes", "can't have duplicates")
+	for _, scope := range input.Scopes {
+		_, ok := middleware.ParseScope(scope)
+		v.Check(ok, "scopes", "must be tweet:read, tweet:write, timeline:read, users:read or users:write")
+	}
+	v.Check(input.ExpiresAt == nil || input.ExpiresAt.After(time.Now()), "expires_at", "must be in the future")
+	if !v.Valid() {
+		http.Error(w, validationError(v), http.StatusBadRequest)
+		return
+	}
+
+	key, prefix, err := newAPIKey()
+	if err != nil {
+		http.Error(w, "Can't generate API key", http.StatusInternalServerError)
+		return
+	}
+
+	adminID, _ := moderator(r, middleware.PermManageBots)
+	apiKey, err := u.store.CreateAPIKey(usermodel.APIKey{
+		UserID:    botID,
+		Name:      input.Name,
+		Prefix:    prefix,
+		KeyHash:   token.HashOpaque(key),
+		Scopes:    input.Scopes,
+		CreatedBy: adminID,
+		ExpiresAt: input.ExpiresAt,
+	})
+	if err != nil {
+		if errors.Is(err, userdb.ErrNotBot) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		u.logs.Error(r.Context(), "auth service", "creating API key", err, "user ID", botID)
+		http.Error(w, "Can't save API key", http.StatusInternalServerError)
+		return
+	}
+
+	u.logs.Info(r.Context(), "auth service", "API key created", "user ID", botID, "prefix", prefix, "admin ID", adminID)
+
+	response := APIKeyToJSON(apiKey)
+	response.Key = key
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// GetAPIKeys lists the API keys of a bot, with when they were last used.
+func (u UserHandler) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	botID := r.PathValue("id")
+	if ok := uuid.IsValid(botID); !ok {
+		http.Error(w, "user id invalid", http.StatusBadRequest)
+		return
+	}
+
+	keys, err := u.store.ListAPIKeys(botID)
+	if err != nil {
+		u.logs.Error(r.Context(), "auth service", "listing API keys", err, "user ID", botID)
+		http.Error(w, "Failed to retrieve API keys", http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Keys []APIKey `json:"keys"`
+	}{
+		Keys: make([]APIKey, 0, len(keys)),
+	}
+	for _, key := range keys {
+		response.Keys = append(response.Keys, APIKeyToJSON(key))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// RevokeAPIKey revokes an API key of a bot. The other services cache keys
+// for a few seconds, so it may keep working there a little longer.
+func (u UserHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	botID, ok := adminTarget(w, r)
+	if !ok {
+		return
+	}
+
+	keyID := r.PathValue("key")
+	if ok := uuid.IsValid(keyID); !ok {
+		http.Error(w, "API key id invalid", http.StatusBadRequest)
+		return
+	}
+
+	err := u.store.RevokeAPIKey(botID, keyID)
+	if err != nil {
+		if errors.Is(err, userdb.ErrAPIKeyNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		u.logs.Error(r.Context(), "auth service", "revoking API key", err, "user ID", botID)
+		http.Error(w, "Can't revoke API key", http.StatusInternalServerError)
+		return
+	}
+
+	adminID, _ := moderator(r, middleware.PermManageBots)
+	u.logs.Info(r.Context(), "auth service", "API key revoked", "user ID", botID, "key ID", keyID, "admin ID", adminID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// attemptKeys are the keys failed logins are counted under, one for the
+// account and one for the IP address the login comes from.
+type attemptKeys struct {
+	account string
+	ip      string
+}
+
+// loginKeys count the failures of a login that isn't known to be a user.
+func loginKeys(r *http.Request, login string) attemptKeys {
+	return attemptKeys{
+		account: accountKey(login),
+		ip:      ipKey(clientIP(r)),
+	}
+}
+
+// userKeys count the failures of a user under their ID, so logging in with
+// their username or email, in any case, shares the counter.
+func userKeys(r *http.Request, userID string) attemptKeys {
+	return attemptKeys{
+		account: userKey(userID),
+		ip:      ipKey(clientIP(r)),
+	}
+}
+
+func accountKey(login string) string {
+	return "account:" + strings.ToLower(login)
+}
+
+func userKey(userID string) string {
+	return "user:" + userID
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// clientIP returns the address of the client. Behind Nginx it's in
+// X-Real-IP, the service must not be reachable without the proxy or clients
+// could set it themselves.
+func clientIP(r *http.Request) string {
+	if ip := r.Header.Get("X-Real-IP"); ip != "" {
+		return ip
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// loginWait returns how long the login has to wait because of the previous
+// failures of the account or the IP. Errors of the trackers are logged and
+// let the login through, a database hiccup shouldn't lock everybody out.
+func (u UserHandler) loginWait(ctx context.Context, keys attemptKeys) time.Duration {
+	accountWait, err := u.config.LoginAccounts.Wait(ctx, keys.account)
+	if err != nil {
+		u.logs.Error(ctx, "auth service", "login: reading failed attempts", err)
+	}
+
+	ipWait, err := u.config.LoginIPs.Wait(ctx, keys.ip)
+	if err != nil {
+		u.logs.Error(ctx, "auth service", "login: reading failed attempts", err)
+	}
+
+	return max(accountWait, ipWait)
+}
+
+// loginFailed records the failure for the account and the IP, and answers
+// 401 Unauthorized. Unknown accounts are counted too, so the answers don't
+// tell which accounts exist.
+func (u UserHandler) loginFailed(w http.ResponseWriter, r *http.Request, keys attemptKeys) {
+	u.recordFailure(r.Context(), keys)
+	http.Error(w, "invalid login or password", http.StatusUnauthorized)
+}
+
+func (u UserHandler) recordFailure(ctx context.Context, keys attemptKeys) {
+	if _, err := u.config.LoginAccounts.Fail(ctx, keys.account); err != nil {
+		u.logs.Error(ctx, "auth service", "login: recording failed attempt", err)
+	}
+	if _, err := u.config.LoginIPs.Fail(ctx, keys.ip); err != nil {
+		u.logs.Error(ctx, "auth service", "login: recording failed attempt", err)
+	}
+}
+
+func tooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	seconds := int((wait + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, "too many failed logins, try again later", http.StatusTooManyRequests)
+}
+
+// Unlock forgets the failed logins of an account, an IP address or both, so
+// they can log in again right away. The login can be the username or the
+// email, the failed passwords and codes of the user are forgotten.
+func (u UserHandler) Unlock(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Login string `json:"login"`
+		IP    string `json:"ip"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if input.Login == "" && input.IP == "" {
+		http.Error(w, "login or ip is required", http.StatusBadRequest)
+		return
+	}
+
+	if input.Login != "" {
+		keys := []string{accountKey(input.Login)}
+		user, err := u.store.GetUserByLogin(input.Login)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+		case err != nil:
+			http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+			return
+		default:
+			keys = append(keys, userKey(user.ID), mfaKey(user.ID))
+		}
+
+		for _, key := range keys {
+			if err := u.config.LoginAccounts.Reset(r.Context(), key); err != nil {
+				http.Error(w, "Can't unlock the account", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	if input.IP != "" {
+		if err := u.config.LoginIPs.Reset(r.Context(), ipKey(input.IP)); err != nil {
+			http.Error(w, "Can't unlock the IP", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	u.logs.Info(r.Context(), "auth service", "login unlocked", "login", input.Login, "ip", input.IP)
+	w.WriteHeader(http.StatusNoContent)
+}
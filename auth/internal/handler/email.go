@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/jackgris/twitter-backend/auth/pkg/mailer"
+	"github.com/jackgris/twitter-backend/auth/pkg/token"
+)
+
+// verifyEmailPurpose binds the signed tokens to the email verification.
+const verifyEmailPurpose = "verify-email"
+
+// VerifyEmail marks the email in the token as verified. Tokens are single
+// use and stop working once the user changes their email.
+func (u UserHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if input.Token == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	value, err := u.config.Signer.Verify(verifyEmailPurpose, input.Token)
+	if err != nil {
+		if errors.Is(err, token.ErrExpiredSignedToken) {
+			http.Error(w, "token expired, ask for a new one", http.StatusBadRequest)
+		} else {
+			http.Error(w, "invalid token", http.StatusBadRequest)
+		}
+		return
+	}
+
+	userID, email, _ := strings.Cut(value, " ")
+	err = u.store.VerifyEmail(userID, email)
+	if err != nil {
+		if errors.Is(err, userdb.ErrEmailNotVerifiable) {
+			http.Error(w, "token already used", http.StatusBadRequest)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to verify email: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResendVerificationEmail sends a new verification link to the caller, a
+// few times per hour.
+func (u UserHandler) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	userID, ok := actingUser(w, r, "")
+	if !ok {
+		return
+	}
+
+	user, err := u.store.GetUserbyID(userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to retrieve user: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if user.EmailVerifiedAt != nil {
+		http.Error(w, "email already verified", http.StatusConflict)
+		return
+	}
+
+	// Errors of the limiter are logged and let the request through, like
+	// the password resets
+	taken, resetAt, err := u.config.VerificationEmails.Take(r.Context(), "verify:user:"+user.ID, 1)
+	if err != nil {
+		u.logs.Error(r.Context(), "auth service", "resending verification email: taking from the limit", err, "user ID", user.ID)
+	} else if taken == 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(resetAt).Seconds())+1))
+		http.Error(w, "too many verification emails, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	if err := u.sendVerificationEmail(r.Context(), user); err != nil {
+		u.logs.Error(r.Context(), "auth service", "sending verification email", err, "user ID", user.ID)
+		http.Error(w, "Can't send verification email", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (u UserHandler) sendVerificationEmail(ctx context.Context, user usermodel.User) error {
+	signed := u.config.Signer.Sign(verifyEmailPurpose, user.ID+" "+user.Email, time.Now().Add(u.config.VerifyEmailTTL))
+
+	return u.config.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: "Hi " + user.UserName + ",\n\n" +
+			"Open the link below to verify your email:\n\n" +
+			u.config.VerifyEmailURL + url.QueryEscape(signed) + "\n\n" +
+			"The link expires in " + u.config.VerifyEmailTTL.String() + ".\n",
+	})
+}
@@ -0,0 +1,39 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/internal/handler"
+	"github.com/jackgris/twitter-backend/auth/pkg/mailer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResendVerificationEmailIsLimited(t *testing.T) {
+	user := usermodel.User{ID: "csvqvamek44s73e2qfa0", UserName: "jackgris", Email: "jack@example.com"}
+	store := &MockStore{
+		GetUserbyIDFunc: func(id string) (usermodel.User, error) {
+			return user, nil
+		},
+	}
+	mail := mailer.NewMemory()
+	h := newHandler(t, store, func(config *handler.Config) {
+		config.Mailer = mail
+	})
+
+	codes := []int{}
+	var last *httptest.ResponseRecorder
+	for range 3 {
+		req := authorized(httptest.NewRequest(http.MethodPost, "/verify-email/resend", nil), user.ID, "")
+		last = httptest.NewRecorder()
+
+		h.ResendVerificationEmail(last, req)
+		codes = append(codes, last.Code)
+	}
+
+	assert.Equal(t, []int{http.StatusAccepted, http.StatusAccepted, http.StatusTooManyRequests}, codes)
+	assert.NotEmpty(t, last.Header().Get("Retry-After"))
+	assert.Len(t, mail.Messages(), 2)
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 
 	"github.com/ThreeDotsLabs/watermill/message"
-	"github.com/jackc/pgx/v5"
 	"github.com/jackgris/twitter-backend/auth/pkg/msgbroker"
 )
 
@@ -18,14 +17,16 @@ type Tweet struct {
 
 type Followers struct {
 	Header      msgbroker.Header `json:"header"`
+	UserID      string           `json:"user_id"`
 	TweetID     string           `json:"tweet_id"`
 	Content     string           `json:"content"`
 	FollowersID []string         `json:"followers_id"`
 }
 
-func NewFollowers(tweetID, content string, followers []string) *message.Message {
+func NewFollowers(userID, tweetID, content string, followers []string) *message.Message {
 	event := Followers{
 		Header:      msgbroker.NewHeader("followers"),
+		UserID:      userID,
 		TweetID:     tweetID,
 		Content:     content,
 		FollowersID: followers,
@@ -35,6 +36,128 @@ func NewFollowers(tweetID, content string, followers []string) *message.Message
 	return message.NewMessage(event.Header.ID, tweetMsg)
 }
 
+// relationshipsTopic carries the user_followed, user_unfollowed,
+// user_blocked, user_unblocked, user_muted and user_unmuted events, so the
+// tweet and timeline services keep their own copy of the relationships they
+// enforce. The UserID of the event is the user who follows, blocks or mutes.
+const relationshipsTopic = "relationships"
+
+// usersTopic carries the changes to users other services keep a copy of.
+const usersTopic = "users"
+
+type UserProtectionEvent struct {
+	Header    msgbroker.Header `json:"header"`
+	UserID    string           `json:"user_id"`
+	Protected bool             `json:"protected"`
+}
+
+func NewUserProtection(userID string, protected bool) *message.Message {
+	event := UserProtectionEvent{
+		Header:    msgbroker.NewHeader("user_protection_changed"),
+		UserID:    userID,
+		Protected: protected,
+	}
+	userMsg, _ := json.Marshal(event)
+
+	return message.NewMessage(event.Header.ID, userMsg)
+}
+
+// UserDeletedEvent tells the other services to purge the content of a
+// deleted user.
+type UserDeletedEvent struct {
+	Header msgbroker.Header `json:"header"`
+	UserID string           `json:"user_id"`
+}
+
+func NewUserDeleted(userID string) *message.Message {
+	event := UserDeletedEvent{
+		Header: msgbroker.NewHeader("user_deleted"),
+		UserID: userID,
+	}
+	userMsg, _ := json.Marshal(event)
+
+	return message.NewMessage(event.Header.ID, userMsg)
+}
+
+// UserSuspensionEvent tells the other services to reject the tokens of a
+// suspended user and hide their tweets (user_suspended), or to stop doing it
+// (user_unsuspended).
+type UserSuspensionEvent struct {
+	Header msgbroker.Header `json:"header"`
+	UserID string           `json:"user_id"`
+}
+
+func NewUserSuspension(userID string, suspended bool) *message.Message {
+	eventName := "user_unsuspended"
+	if suspended {
+		eventName = "user_suspended"
+	}
+	event := UserSuspensionEvent{
+		Header: msgbroker.NewHeader(eventName),
+		UserID: userID,
+	}
+	userMsg, _ := json.Marshal(event)
+
+	return message.NewMessage(event.Header.ID, userMsg)
+}
+
+// UserRoleEvent tells the other services the role of a user changed, so
+// they stop trusting the role claim of the access tokens they already have.
+type UserRoleEvent struct {
+	Header msgbroker.Header `json:"header"`
+	UserID string           `json:"user_id"`
+	Role   string           `json:"role"`
+}
+
+func NewUserRoleChanged(userID, role string) *message.Message {
+	event := UserRoleEvent{
+		Header: msgbroker.NewHeader("user_role_changed"),
+		UserID: userID,
+		Role:   role,
+	}
+	userMsg, _ := json.Marshal(event)
+
+	return message.NewMessage(event.Header.ID, userMsg)
+}
+
+// UserRenamedEvent tells the other services a user changed their username,
+// so they refresh what they show of them.
+type UserRenamedEvent struct {
+	Header      msgbroker.Header `json:"header"`
+	UserID      string           `json:"user_id"`
+	OldUsername string           `json:"old_username"`
+	Username    string           `json:"username"`
+}
+
+func NewUserRenamed(userID, oldUsername, username string) *message.Message {
+	event := UserRenamedEvent{
+		Header:      msgbroker.NewHeader("user_renamed"),
+		UserID:      userID,
+		OldUsername: oldUsername,
+		Username:    username,
+	}
+	userMsg, _ := json.Marshal(event)
+
+	return message.NewMessage(event.Header.ID, userMsg)
+}
+
+type RelationshipEvent struct {
+	Header   msgbroker.Header `json:"header"`
+	UserID   string           `json:"user_id"`
+	TargetID string           `json:"target_id"`
+}
+
+func NewRelationship(eventName, userID, targetID string) *message.Message {
+	event := RelationshipEvent{
+		Header:   msgbroker.NewHeader(eventName),
+		UserID:   userID,
+		TargetID: targetID,
+	}
+	relationshipMsg, _ := json.Marshal(event)
+
+	return message.NewMessage(event.Header.ID, relationshipMsg)
+}
+
 func (u *UserHandler) SubscribeGetFollowers() {
 	ctx := context.Background()
 	topic := "tweets"
@@ -54,20 +177,13 @@ func (u *UserHandler) SubscribeGetFollowers() {
 
 		u.logs.Info(ctx, "auth service", "receive tweets ", tweet, "ID", msg.UUID)
 
-		user, err := u.store.GetUserbyID(tweet.UserID)
+		userFollowers, err := u.store.FollowerIDs(tweet.UserID)
 		if err != nil {
-			if err != pgx.ErrNoRows {
-				u.logs.Error(ctx, "auth service", "getting followers "+topic, err)
-			}
+			u.logs.Error(ctx, "auth service", "getting followers "+topic, err)
 			continue
 		}
 
-		userFollowers := []string{}
-		for _, f := range user.Followers {
-			userFollowers = append(userFollowers, f.FollowerID)
-		}
-
-		followers := NewFollowers(tweet.TweetID, tweet.Content, userFollowers)
+		followers := NewFollowers(tweet.UserID, tweet.TweetID, tweet.Content, userFollowers)
 
 		u.msgBroker.PublishMessages("followers", followers)
 
@@ -0,0 +1,354 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/jackgris/twitter-backend/auth/pkg/uuid"
+)
+
+const (
+	// exportBatchSize is how many users an export reads from the database
+	// at a time, only one batch is in memory
+	exportBatchSize = 500
+	// maxImportRows is how many users an import can follow in one request
+	maxImportRows = 500
+)
+
+// ExportFollowers streams every follower of the caller as NDJSON, one user
+// per line, or as CSV with format=csv.
+func (u UserHandler) ExportFollowers(w http.ResponseWriter, r *http.Request) {
+	u.exportFollows(w, r, "followers", u.store.GetFollowers)
+}
+
+// ExportFollowing streams every user the caller follows, like
+// ExportFollowers.
+func (u UserHandler) ExportFollowing(w http.ResponseWriter, r *http.Request) {
+	u.exportFollows(w, r, "following", u.store.GetFollowing)
+}
+
+// exportFollows writes the users of list in batches, flushing each one, so
+// the size of the export doesn't matter. The database connection is only
+// held while reading a batch.
+func (u UserHandler) exportFollows(w http.ResponseWriter, r *http.Request, name string, list func(userID, cursor string, limit int) (usermodel.UserPage, error)) {
+	userID, ok := actingUser(w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "ndjson"
+	}
+	if format != "ndjson" && format != "csv" {
+		http.Error(w, "format must be ndjson or csv", http.StatusBadRequest)
+		return
+	}
+
+	// The first batch is read before answering, so its errors still get a
+	// proper status code
+	page, err := list(userID, "", exportBatchSize)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to retrieve users: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var write func(user usermodel.UserSummary) error
+	var flush func() error
+	if format == "csv" {
+		cw := csv.NewWriter(w)
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, name))
+		w.WriteHeader(http.StatusOK)
+		_ = cw.Write([]string{"id", "username", "display_name", "follower_count", "following_count"})
+		write = func(user usermodel.UserSummary) error {
+			return cw.Write([]string{user.ID, user.UserName, user.DisplayName, strconv.Itoa(user.FollowerCount), strconv.Itoa(user.FollowingCount)})
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	} else {
+		enc := json.NewEncoder(w)
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.ndjson"`, name))
+		w.WriteHeader(http.StatusOK)
+		write = func(user usermodel.UserSummary) error {
+			return enc.Encode(UserSummaryToJSON(user))
+		}
+		flush = func() error { return nil }
+	}
+
+	flusher, _ := w.(http.Flusher)
+	exported := 0
+	for {
+		for _, user := range page.Users {
+			if err := write(user); err != nil {
+				return
+			}
+			exported++
+		}
+		if err := flush(); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		if page.NextCursor == "" || r.Context().Err() != nil {
+			break
+		}
+
+		page, err = list(userID, page.NextCursor, exportBatchSize)
+		if err != nil {
+			// The status was already sent, the client sees a truncated
+			// export
+			u.logs.Error(r.Context(), "auth service", "export: retrieving users", err, "user ID", userID, "exported", exported)
+			return
+		}
+	}
+}
+
+// ImportResult is the outcome of one row of an import.
+type ImportResult struct {
+	Input  string `json:"input"`
+	UserID string `json:"user_id,omitempty"`
+	// Status is followed, requested, already_following, already_requested,
+	// not_found, invalid, self, blocked, rate_limited or error
+	Status string `json:"status"`
+}
+
+// ImportFollowing follows every user in the body, given by username or ID,
+// and answers with the result of each row. Rows that were already followed
+// or requested are skipped, so a failed import can be sent again. New
+// follows count against the import limit of the caller, the rows past it
+// are rate_limited and can be retried later.
+func (u UserHandler) ImportFollowing(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Users []string `json:"users"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	followerID, ok := actingUser(w, r, "")
+	if !ok {
+		return
+	}
+
+	if len(input.Users) == 0 {
+		http.Error(w, "users is required", http.StatusBadRequest)
+		return
+	}
+	if len(input.Users) > maxImportRows {
+		http.Error(w, fmt.Sprintf("users can have a maximum of %d rows", maxImportRows), http.StatusBadRequest)
+		return
+	}
+
+	// Every row is resolved with one query, the IDs by ID and the rest by
+	// username
+	results := make([]ImportResult, len(input.Users))
+	logins := make([]string, len(input.Users))
+	var ids, usernames []string
+	for i, row := range input.Users {
+		results[i].Input = row
+		logins[i] = strings.TrimPrefix(strings.TrimSpace(row), "@")
+		switch {
+		case logins[i] == "":
+			results[i].Status = "invalid"
+		case uuid.IsValid(logins[i]):
+			ids = append(ids, logins[i])
+		default:
+			usernames = append(usernames, logins[i])
+		}
+	}
+
+	found, err := u.store.GetUsersByIDOrUsername(ids, usernames)
+	if err != nil {
+		u.logs.Error(r.Context(), "auth service", "import: retrieving users", err, "user ID", followerID)
+		http.Error(w, "Failed to retrieve users", http.StatusInternalServerError)
+		return
+	}
+	byID := make(map[string]usermodel.User, len(found))
+	byUsername := make(map[string]usermodel.User, len(found))
+	for _, user := range found {
+		byID[user.ID] = user
+		byUsername[strings.ToLower(user.UserName)] = user
+	}
+
+	users := make([]usermodel.User, len(input.Users))
+	// rows has the indexes of the rows of each user found
+	rows := make(map[string][]int)
+	var targetIDs []string
+	for i := range results {
+		if results[i].Status != "" {
+			continue
+		}
+
+		var ok bool
+		if uuid.IsValid(logins[i]) {
+			users[i], ok = byID[logins[i]]
+		} else {
+			users[i], ok = byUsername[strings.ToLower(logins[i])]
+		}
+		if !ok {
+			results[i].Status = "not_found"
+			continue
+		}
+
+		results[i].UserID = users[i].ID
+		if users[i].ID == followerID {
+			results[i].Status = "self"
+			continue
+		}
+		if _, ok := rows[users[i].ID]; !ok {
+			targetIDs = append(targetIDs, users[i].ID)
+		}
+		rows[users[i].ID] = append(rows[users[i].ID], i)
+	}
+
+	// The users already followed, requested or blocked are skipped before
+	// taking from the limit, sending the same import again costs nothing
+	for start := 0; start < len(targetIDs); start += maxRelationshipTargets {
+		end := min(start+maxRelationshipTargets, len(targetIDs))
+		statuses, err := u.store.GetRelationships(followerID, targetIDs[start:end])
+		if err != nil {
+			u.logs.Error(r.Context(), "auth service", "import: retrieving relationships", err, "user ID", followerID)
+			http.Error(w, "Failed to retrieve relationships", http.StatusInternalServerError)
+			return
+		}
+		for _, status := range statuses {
+			for _, i := range rows[status.TargetID] {
+				switch {
+				case status.Following:
+					results[i].Status = "already_following"
+				case status.FollowRequested:
+					results[i].Status = "already_requested"
+				case status.Blocking, status.BlockedBy:
+					results[i].Status = "blocked"
+				}
+			}
+		}
+	}
+
+	// The users left are followed in the order of the rows, as many as the
+	// limit of the caller allows
+	var pending []string
+	for _, id := range targetIDs {
+		if results[rows[id][0]].Status == "" {
+			pending = append(pending, id)
+		}
+	}
+	allowed := make(map[string]bool, len(pending))
+	var resetAt time.Time
+	if len(pending) > 0 {
+		var taken int
+		taken, resetAt, err = u.config.FollowImports.Take(r.Context(), "import:"+followerID, len(pending))
+		if err != nil {
+			u.logs.Error(r.Context(), "auth service", "import: taking from the limit", err, "user ID", followerID)
+			http.Error(w, "Can't check the import limit", http.StatusInternalServerError)
+			return
+		}
+		for _, id := range pending[:taken] {
+			allowed[id] = true
+		}
+	}
+
+	done := make(map[string]string)
+	for i := range results {
+		if results[i].Status != "" {
+			continue
+		}
+
+		// Rows repeating a user get the result of the first one
+		if status, ok := done[users[i].ID]; ok {
+			switch status {
+			case "followed":
+				status = "already_following"
+			case "requested":
+				status = "already_requested"
+			}
+			results[i].Status = status
+			continue
+		}
+
+		if !allowed[users[i].ID] {
+			results[i].Status = "rate_limited"
+			continue
+		}
+
+		results[i].Status = u.importFollow(r, followerID, users[i])
+		done[users[i].ID] = results[i].Status
+	}
+
+	if len(allowed) < len(pending) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(resetAt).Seconds())+1))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(struct {
+		Results []ImportResult `json:"results"`
+	}{
+		Results: results,
+	})
+}
+
+// importFollow follows user, or asks to when they are protected, and returns
+// the status of the row.
+func (u UserHandler) importFollow(r *http.Request, followerID string, user usermodel.User) string {
+	follow := usermodel.UserFollowers{
+		UserID:     user.ID,
+		FollowerID: followerID,
+	}
+
+	var err error
+	if user.Protected {
+		var created bool
+		_, created, err = u.store.RequestFollow(follow)
+		if err == nil {
+			if created {
+				return "requested"
+			}
+			return "already_requested"
+		}
+		if errors.Is(err, userdb.ErrAlreadyFollowing) {
+			return "already_following"
+		}
+	} else {
+		var created bool
+		follow, created, err = u.store.Follow(follow)
+		if err == nil {
+			if !created {
+				return "already_following"
+			}
+			u.msgBroker.PublishMessages(relationshipsTopic, NewRelationship("user_followed", follow.FollowerID, follow.UserID))
+			return "followed"
+		}
+	}
+
+	switch {
+	case errors.Is(err, userdb.ErrSelfFollow):
+		return "self"
+	case errors.Is(err, userdb.ErrBlocked):
+		return "blocked"
+	case errors.Is(err, userdb.ErrUserNotFound):
+		return "not_found"
+	default:
+		u.logs.Error(r.Context(), "auth service", "import: following user", err, "user ID", user.ID)
+		return "error"
+	}
+}
@@ -0,0 +1,119 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/internal/handler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportFollowing(t *testing.T) {
+	const followerID = "csvqvamek44s73e2qf8g"
+	users := []usermodel.User{
+		{ID: followerID, UserName: "jackgris"},
+		{ID: "csvqda265b6s73dtmot0", UserName: "alice"},
+		{ID: "d0lqa0s65b6s73dtmou0", UserName: "bob", Protected: true},
+		{ID: "d0lqa1k65b6s73dtmov0", UserName: "carol"},
+		{ID: "d0lqa2c65b6s73dtmp00", UserName: "dave"},
+		{ID: "d0lqa3465b6s73dtmp10", UserName: "erin"},
+		{ID: "d0lqa3s65b6s73dtmp20", UserName: "frank"},
+		{ID: "d0lqa4k65b6s73dtmp30", UserName: "grace"},
+	}
+
+	newStore := func(lookups *int) *MockStore {
+		return &MockStore{
+			GetUsersByIDOrUsernameFunc: func(ids, usernames []string) ([]usermodel.User, error) {
+				*lookups++
+				var found []usermodel.User
+				for _, user := range users {
+					if slices.Contains(ids, user.ID) || slices.ContainsFunc(usernames, func(name string) bool { return strings.EqualFold(name, user.UserName) }) {
+						found = append(found, user)
+					}
+				}
+				return found, nil
+			},
+			GetRelationshipsFunc: func(userID string, targetIDs []string) ([]usermodel.RelationshipStatus, error) {
+				var statuses []usermodel.RelationshipStatus
+				for _, id := range targetIDs {
+					status := usermodel.RelationshipStatus{TargetID: id}
+					switch id {
+					case "d0lqa1k65b6s73dtmov0":
+						status.Following = true
+					case "d0lqa2c65b6s73dtmp00":
+						status.BlockedBy = true
+					}
+					statuses = append(statuses, status)
+				}
+				return statuses, nil
+			},
+			FollowFunc: func(follow usermodel.UserFollowers) (usermodel.UserFollowers, bool, error) {
+				return follow, true, nil
+			},
+			RequestFollowFunc: func(follow usermodel.UserFollowers) (usermodel.FollowRequest, bool, error) {
+				return usermodel.FollowRequest{}, true, nil
+			},
+		}
+	}
+
+	importRows := func(h handler.UserHandler, rows ...string) (*httptest.ResponseRecorder, []handler.ImportResult) {
+		body, _ := json.Marshal(map[string][]string{"users": rows})
+		req := httptest.NewRequest(http.MethodPost, "/following/import", strings.NewReader(string(body)))
+		req = authorized(req, followerID, "family-1")
+		rec := httptest.NewRecorder()
+
+		h.ImportFollowing(rec, req)
+
+		var response struct {
+			Results []handler.ImportResult `json:"results"`
+		}
+		_ = json.NewDecoder(rec.Body).Decode(&response)
+		return rec, response.Results
+	}
+
+	statuses := func(results []handler.ImportResult) []string {
+		var s []string
+		for _, result := range results {
+			s = append(s, result.Status)
+		}
+		return s
+	}
+
+	t.Run("Status of every row", func(t *testing.T) {
+		lookups := 0
+		h := newHandler(t, newStore(&lookups))
+
+		rec, results := importRows(h, "@Alice", "csvqda265b6s73dtmot0", "bob", "carol", "dave", "jackgris", "nobody", "  ")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, []string{"followed", "already_following", "requested", "already_following", "blocked", "self", "not_found", "invalid"}, statuses(results))
+		assert.Equal(t, "csvqda265b6s73dtmot0", results[0].UserID)
+		assert.Equal(t, 1, lookups, "every row is resolved with one query")
+		assert.Empty(t, rec.Header().Get("Retry-After"))
+	})
+
+	t.Run("Rows past the limit", func(t *testing.T) {
+		lookups := 0
+		h := newHandler(t, newStore(&lookups))
+
+		rec, results := importRows(h, "alice", "erin", "alice", "frank", "grace", "grace")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, []string{"followed", "followed", "already_following", "followed", "rate_limited", "rate_limited"}, statuses(results))
+		retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+		assert.NoError(t, err)
+		assert.InDelta(t, 3600, retryAfter, 2)
+
+		// The limit is used up, already followed users are still reported
+		rec, results = importRows(h, "carol", "grace")
+
+		assert.Equal(t, []string{"already_following", "rate_limited"}, statuses(results))
+		assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+	})
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/pkg/uuid"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// GetFollowers lists the users following the user in the path. The page size
+// is set with limit and the next page is requested with the next_cursor of
+// the previous response as cursor.
+func (u UserHandler) GetFollowers(w http.ResponseWriter, r *http.Request) {
+	u.listFollows(w, r, u.store.GetFollowers)
+}
+
+// GetFollowing lists the users followed by the user in the path, paginated
+// like GetFollowers.
+func (u UserHandler) GetFollowing(w http.ResponseWriter, r *http.Request) {
+	u.listFollows(w, r, u.store.GetFollowing)
+}
+
+func (u UserHandler) listFollows(w http.ResponseWriter, r *http.Request, list func(userID, cursor string, limit int) (usermodel.UserPage, error)) {
+	userID := r.PathValue("id")
+	if ok := uuid.IsValid(userID); !ok {
+		http.Error(w, "user id invalid", http.StatusBadRequest)
+		return
+	}
+
+	cursor := r.URL.Query().Get("cursor")
+	if cursor != "" && !uuid.IsValid(cursor) {
+		http.Error(w, "cursor invalid", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := pageSize(r.URL.Query().Get("limit"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := list(userID, cursor, limit)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to retrieve users: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(UserPageToJSON(page))
+}
+
+func pageSize(limit string) (int, error) {
+	if limit == "" {
+		return defaultPageSize, nil
+	}
+
+	size, err := strconv.Atoi(limit)
+	if err != nil || size < 1 || size > maxPageSize {
+		return 0, fmt.Errorf("limit must be a number between 1 and %d", maxPageSize)
+	}
+
+	return size, nil
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/jackgris/twitter-backend/auth/pkg/uuid"
+)
+
+// GetFollowRequests lists the users waiting for the caller to approve them,
+// paginated like GetFollowers.
+func (u UserHandler) GetFollowRequests(w http.ResponseWriter, r *http.Request) {
+	u.listOwn(w, r, u.store.GetFollowRequests)
+}
+
+// ApproveFollowRequest makes the user in the path a follower of the caller.
+func (u UserHandler) ApproveFollowRequest(w http.ResponseWriter, r *http.Request) {
+	userID, followerID, ok := followRequestInput(w, r)
+	if !ok {
+		return
+	}
+
+	follow, err := u.store.ApproveFollowRequest(userID, followerID)
+	if err != nil {
+		if errors.Is(err, userdb.ErrFollowRequestNotFound) {
+			http.Error(w, "Follow request not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	u.msgBroker.PublishMessages(relationshipsTopic, NewRelationship("user_followed", follow.FollowerID, follow.UserID))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(FollowerToJSON(follow))
+}
+
+// RejectFollowRequest removes the request of the user in the path.
+func (u UserHandler) RejectFollowRequest(w http.ResponseWriter, r *http.Request) {
+	userID, followerID, ok := followRequestInput(w, r)
+	if !ok {
+		return
+	}
+
+	err := u.store.RejectFollowRequest(userID, followerID)
+	if err != nil {
+		if errors.Is(err, userdb.ErrFollowRequestNotFound) {
+			http.Error(w, "Follow request not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func followRequestInput(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	userID, ok := actingUser(w, r, "")
+	if !ok {
+		return "", "", false
+	}
+
+	followerID := r.PathValue("id")
+	if ok := uuid.IsValid(followerID); !ok {
+		http.Error(w, "user id invalid", http.StatusBadRequest)
+		return "", "", false
+	}
+
+	return userID, followerID, true
+}
@@ -2,43 +2,158 @@ package handler
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/pkg/attempts"
 	"github.com/jackgris/twitter-backend/auth/pkg/logger"
+	"github.com/jackgris/twitter-backend/auth/pkg/mailer"
 	"github.com/jackgris/twitter-backend/auth/pkg/middleware"
 	"github.com/jackgris/twitter-backend/auth/pkg/msgbroker"
+	"github.com/jackgris/twitter-backend/auth/pkg/oidc"
+	"github.com/jackgris/twitter-backend/auth/pkg/ratelimit"
+	"github.com/jackgris/twitter-backend/auth/pkg/token"
+	"github.com/jackgris/twitter-backend/auth/pkg/uuid"
 )
 
 type UserHandler struct {
 	logs      *logger.Logger
 	store     Store
 	msgBroker *msgbroker.MsgBroker
+	tokens    *token.Issuer
+	keys      *middleware.KeySet
+	config    Config
 }
 
-func NewTweetHandler(store Store, msgBroker *msgbroker.MsgBroker, logs *logger.Logger) UserHandler {
+// Config holds the settings of the handlers main reads from the environment.
+type Config struct {
+	Mailer mailer.Mailer
+	// Signer signs the tokens sent by email and the state of OIDC logins
+	Signer *token.Signer
+	// VerifyEmailURL is the link sent to verify an email, the token is
+	// appended to it
+	VerifyEmailURL string
+	VerifyEmailTTL time.Duration
+	// VerificationEmails limits the verification emails a user can ask for
+	VerificationEmails ratelimit.Limiter
+	// ResetPasswordURL is the link sent to reset a password, the token is
+	// appended to it
+	ResetPasswordURL string
+	ResetPasswordTTL time.Duration
+	// ResetEmails and ResetIPs limit the reset emails sent per email and
+	// asked for per IP address
+	ResetEmails ratelimit.Limiter
+	ResetIPs    ratelimit.Limiter
+	// LoginAccounts and LoginIPs count the failed logins per account and per
+	// IP address
+	LoginAccounts attempts.Tracker
+	LoginIPs      attempts.Tracker
+	// AdminToken authorizes the admin routes, they are disabled when empty
+	AdminToken string
+	// OIDC is the external provider users can log in with, the OIDC routes
+	// are disabled when nil
+	OIDC *oidc.Provider
+	// MFAIssuer is the name authenticator apps show next to the codes
+	MFAIssuer string
+	// FollowImports limits the follows a user can import
+	FollowImports ratelimit.Limiter
+	// UsernameCooldown is how long users wait between username changes
+	UsernameCooldown time.Duration
+	// UsernameReservation is how long an old username keeps pointing to its
+	// user, and nobody else can take it
+	UsernameReservation time.Duration
+}
+
+func NewTweetHandler(store Store, msgBroker *msgbroker.MsgBroker, tokens *token.Issuer, config Config, logs *logger.Logger) UserHandler {
 	return UserHandler{
 		store:     store,
 		logs:      logs,
 		msgBroker: msgBroker,
+		tokens:    tokens,
+		keys:      middleware.NewStaticKeySet(tokens.PublicKeys()),
+		config:    config,
 	}
 }
 
-func NewHandler(store Store, msgBroker *msgbroker.MsgBroker, logs *logger.Logger) (*http.ServeMux, *UserHandler) {
+func NewHandler(store Store, msgBroker *msgbroker.MsgBroker, tokens *token.Issuer, config Config, logs *logger.Logger) (*http.ServeMux, *UserHandler) {
 	u := UserHandler{
 		store:     store,
 		logs:      logs,
 		msgBroker: msgBroker,
+		tokens:    tokens,
+		keys:      middleware.NewStaticKeySet(tokens.PublicKeys()),
+		config:    config,
+	}
+	u.keys.RequireClaims(tokens.Claims())
+	u.keys.RejectSuspended(store)
+	u.keys.CheckRoles(store)
+	u.keys.AcceptAPIKeys(apiKeyStore{store: store}, middleware.ScopeUsersRead, middleware.ScopeUsersWrite)
+
+	// account are the routes managing the account itself, like its sessions,
+	// which bots can't call with their API keys
+	account := func(next http.HandlerFunc) http.HandlerFunc {
+		return middleware.Authorize(middleware.RejectAPIKeys(next), u.keys)
 	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /helthz", middleware.LogResponse(healthCheckHandler, u.logs))
 	mux.HandleFunc("POST /create", middleware.LogResponse(u.CreateUser, u.logs))
 	mux.HandleFunc("GET /id/{id}", middleware.LogResponse(u.GetUserbyID, u.logs))
+	mux.HandleFunc("GET /id/{id}/followers", middleware.LogResponse(u.GetFollowers, u.logs))
+	mux.HandleFunc("GET /id/{id}/following", middleware.LogResponse(u.GetFollowing, u.logs))
+	mux.HandleFunc("GET /id/{id}/followers/export", middleware.LogResponse(middleware.Authorize(u.ExportFollowers, u.keys), u.logs))
+	mux.HandleFunc("GET /id/{id}/following/export", middleware.LogResponse(middleware.Authorize(u.ExportFollowing, u.keys), u.logs))
+	mux.HandleFunc("POST /following/import", middleware.LogResponse(middleware.Authorize(u.ImportFollowing, u.keys), u.logs))
+	mux.HandleFunc("GET /search/users", middleware.LogResponse(middleware.Identify(u.SearchUsers, u.keys), u.logs))
+	mux.HandleFunc("GET /suggestions", middleware.LogResponse(middleware.Authorize(u.GetSuggestions, u.keys), u.logs))
+	mux.HandleFunc("POST /suggestions/{id}/dismiss", middleware.LogResponse(middleware.Authorize(u.DismissSuggestion, u.keys), u.logs))
 	mux.HandleFunc("GET /name/{name}", middleware.LogResponse(u.GetUserbyUsername, u.logs))
-	mux.HandleFunc("DELETE /delete/{id}", middleware.LogResponse(u.Delete, u.logs))
-	mux.HandleFunc("POST /follow", middleware.LogResponse(u.Follow, u.logs))
-	mux.HandleFunc("DELETE /unfollow", middleware.LogResponse(u.Unfollow, u.logs))
-	mux.HandleFunc("PATCH /update", middleware.LogResponse(u.Update, u.logs))
+	mux.HandleFunc("DELETE /delete/{id}", middleware.LogResponse(account(u.Delete), u.logs))
+	mux.HandleFunc("POST /follow", middleware.LogResponse(middleware.Authorize(u.Follow, u.keys), u.logs))
+	mux.HandleFunc("DELETE /unfollow", middleware.LogResponse(middleware.Authorize(u.Unfollow, u.keys), u.logs))
+	mux.HandleFunc("GET /follow-requests", middleware.LogResponse(middleware.Authorize(u.GetFollowRequests, u.keys), u.logs))
+	mux.HandleFunc("POST /follow-requests/{id}/approve", middleware.LogResponse(middleware.Authorize(u.ApproveFollowRequest, u.keys), u.logs))
+	mux.HandleFunc("POST /follow-requests/{id}/reject", middleware.LogResponse(middleware.Authorize(u.RejectFollowRequest, u.keys), u.logs))
+	mux.HandleFunc("POST /block", middleware.LogResponse(middleware.Authorize(u.Block, u.keys), u.logs))
+	mux.HandleFunc("DELETE /block", middleware.LogResponse(middleware.Authorize(u.Unblock, u.keys), u.logs))
+	mux.HandleFunc("GET /blocked", middleware.LogResponse(middleware.Authorize(u.GetBlocked, u.keys), u.logs))
+	mux.HandleFunc("POST /mute", middleware.LogResponse(middleware.Authorize(u.Mute, u.keys), u.logs))
+	mux.HandleFunc("DELETE /mute", middleware.LogResponse(middleware.Authorize(u.Unmute, u.keys), u.logs))
+	mux.HandleFunc("GET /relationships", middleware.LogResponse(middleware.Authorize(u.GetRelationships, u.keys), u.logs))
+	mux.HandleFunc("GET /muted", middleware.LogResponse(middleware.Authorize(u.GetMuted, u.keys), u.logs))
+	mux.HandleFunc("PATCH /update", middleware.LogResponse(middleware.Authorize(u.Update, u.keys), u.logs))
+	mux.HandleFunc("PUT /username", middleware.LogResponse(middleware.Authorize(u.ChangeUsername, u.keys), u.logs))
+	mux.HandleFunc("POST /login", middleware.LogResponse(u.Login, u.logs))
+	mux.HandleFunc("POST /login/mfa", middleware.LogResponse(u.LoginMFA, u.logs))
+	mux.HandleFunc("POST /mfa/enroll", middleware.LogResponse(account(u.EnrollMFA), u.logs))
+	mux.HandleFunc("POST /mfa/confirm", middleware.LogResponse(account(u.ConfirmMFA), u.logs))
+	mux.HandleFunc("POST /mfa/disable", middleware.LogResponse(account(u.DisableMFA), u.logs))
+	mux.HandleFunc("POST /token/refresh", middleware.LogResponse(u.RefreshToken, u.logs))
+	mux.HandleFunc("POST /verify-email", middleware.LogResponse(u.VerifyEmail, u.logs))
+	mux.HandleFunc("POST /verify-email/resend", middleware.LogResponse(account(u.ResendVerificationEmail), u.logs))
+	mux.HandleFunc("POST /password/forgot", middleware.LogResponse(u.ForgotPassword, u.logs))
+	mux.HandleFunc("POST /password/reset", middleware.LogResponse(u.ResetPassword, u.logs))
+	mux.HandleFunc("POST /logout", middleware.LogResponse(u.Logout, u.logs))
+	mux.HandleFunc("GET /sessions", middleware.LogResponse(account(u.GetSessions), u.logs))
+	mux.HandleFunc("DELETE /sessions", middleware.LogResponse(account(u.RevokeAllSessions), u.logs))
+	mux.HandleFunc("DELETE /sessions/{id}", middleware.LogResponse(account(u.RevokeSession), u.logs))
+	mux.HandleFunc("POST /admin/unlock", middleware.LogResponse(u.adminOnly(u.Unlock, middleware.PermUnlockLogins), u.logs))
+	mux.HandleFunc("GET /admin/users/{id}/sessions", middleware.LogResponse(u.adminOnly(u.GetUserSessions, middleware.PermReadSessions), u.logs))
+	mux.HandleFunc("POST /admin/users/{id}/suspend", middleware.LogResponse(u.adminOnly(u.SuspendUser, middleware.PermSuspendUsers), u.logs))
+	mux.HandleFunc("POST /admin/users/{id}/unsuspend", middleware.LogResponse(u.adminOnly(u.UnsuspendUser, middleware.PermSuspendUsers), u.logs))
+	mux.HandleFunc("POST /admin/users/{id}/logout", middleware.LogResponse(u.adminOnly(u.LogoutUser, middleware.PermLogoutUsers), u.logs))
+	mux.HandleFunc("PUT /admin/users/{id}/role", middleware.LogResponse(u.adminOnly(u.SetUserRole, middleware.PermManageRoles), u.logs))
+	mux.HandleFunc("DELETE /admin/users/{id}", middleware.LogResponse(u.adminOnly(u.DeleteUser, middleware.PermDeleteUsers), u.logs))
+	mux.HandleFunc("POST /admin/bots", middleware.LogResponse(u.adminOnly(u.CreateBot, middleware.PermManageBots), u.logs))
+	mux.HandleFunc("POST /admin/bots/{id}/keys", middleware.LogResponse(u.adminOnly(u.CreateAPIKey, middleware.PermManageBots), u.logs))
+	mux.HandleFunc("GET /admin/bots/{id}/keys", middleware.LogResponse(u.adminOnly(u.GetAPIKeys, middleware.PermManageBots), u.logs))
+	mux.HandleFunc("DELETE /admin/bots/{id}/keys/{key}", middleware.LogResponse(u.adminOnly(u.RevokeAPIKey, middleware.PermManageBots), u.logs))
+	mux.HandleFunc("POST /api-keys/verify", middleware.LogResponse(u.VerifyAPIKey, u.logs))
+	mux.HandleFunc("GET /.well-known/jwks.json", middleware.LogResponse(u.JWKS, u.logs))
+	if config.OIDC != nil {
+		mux.HandleFunc("GET /oidc/login", middleware.LogResponse(u.OIDCLogin, u.logs))
+		mux.HandleFunc("GET /oidc/callback", middleware.LogResponse(u.OIDCCallback, u.logs))
+	}
 
 	return mux, &u
 }
@@ -47,12 +162,93 @@ func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// actingUser returns the ID of the user the request was authorized for.
+// Requests may still send the user ID in the body, but it has to be the same
+// user, nobody can act on behalf of someone else.
+func actingUser(w http.ResponseWriter, r *http.Request, userID string) (string, bool) {
+	claims, ok := middleware.ClaimsFromContext(r.Context())
+	if !ok {
+		http.Error(w, "missing access token", http.StatusUnauthorized)
+		return "", false
+	}
+
+	if userID == "" {
+		return claims.UserID, true
+	}
+
+	if ok := uuid.IsValid(userID); !ok {
+		http.Error(w, "user id invalid", http.StatusBadRequest)
+		return "", false
+	}
+
+	if userID != claims.UserID {
+		http.Error(w, "user id doesn't match the access token", http.StatusForbidden)
+		return "", false
+	}
+
+	return claims.UserID, true
+}
+
 type Store interface {
 	Create(user usermodel.User) (usermodel.User, error)
 	GetUserbyID(id string) (usermodel.User, error)
 	GetUserbyUsername(username string) (usermodel.User, error)
+	GetUserByLogin(login string) (usermodel.User, error)
+	GetUsersByIDOrUsername(ids, usernames []string) ([]usermodel.User, error)
 	Delete(id string) error
-	Follow(follow usermodel.UserFollowers) error
+	Follow(follow usermodel.UserFollowers) (usermodel.UserFollowers, bool, error)
 	Unfollow(follow usermodel.UserFollowers) error
-	Update(user usermodel.User) (usermodel.User, error)
+	Update(id string, patch usermodel.UserPatch, version int) (usermodel.User, []usermodel.UserFollowers, error)
+	GetFollowers(userID, cursor string, limit int) (usermodel.UserPage, error)
+	GetFollowing(userID, cursor string, limit int) (usermodel.UserPage, error)
+	FollowerIDs(userID string) ([]string, error)
+	SearchUsers(q, callerID, cursor string, limit int) (usermodel.UserPage, error)
+	TypeaheadUsers(q, callerID string, limit int) ([]usermodel.UserSummary, error)
+	VerifyEmail(id, email string) error
+	RequestFollow(follow usermodel.UserFollowers) (usermodel.FollowRequest, bool, error)
+	GetFollowRequests(userID, cursor string, limit int) (usermodel.UserPage, error)
+	ApproveFollowRequest(userID, followerID string) (usermodel.UserFollowers, error)
+	RejectFollowRequest(userID, followerID string) error
+	Block(rel usermodel.Relationship) (usermodel.Relationship, bool, error)
+	Unblock(rel usermodel.Relationship) error
+	Mute(rel usermodel.Relationship) (usermodel.Relationship, bool, error)
+	Unmute(rel usermodel.Relationship) error
+	GetBlocked(userID, cursor string, limit int) (usermodel.UserPage, error)
+	GetMuted(userID, cursor string, limit int) (usermodel.UserPage, error)
+	ListPlaintextPasswords(limit int) ([]usermodel.User, error)
+	ReplacePassword(id, old, hash, salt string) error
+	CreateSession(session usermodel.Session, rt usermodel.RefreshToken) error
+	RotateRefreshToken(hash string, next usermodel.RefreshToken, ip string) (usermodel.RefreshToken, error)
+	RevokeRefreshToken(hash string) error
+	CreatePasswordResetToken(rt usermodel.PasswordResetToken) error
+	ResetPassword(tokenHash, hash, salt string) (string, error)
+	GetUserByIdentity(issuer, subject string) (usermodel.User, error)
+	CreateUserWithIdentity(user usermodel.User, identity usermodel.UserIdentity, verified bool) (usermodel.User, error)
+	LinkIdentity(identity usermodel.UserIdentity) error
+	GetMFA(userID string) (usermodel.MFA, error)
+	EnrollMFA(userID, secret string) error
+	EnableMFA(userID string, step int64, recoveryHashes []string) error
+	UseMFAStep(userID string, step int64) error
+	UseRecoveryCode(userID, hash string) error
+	DisableMFA(userID string) error
+	IsSuspended(userID string) (bool, error)
+	SuspendUser(userID, reason string) error
+	UnsuspendUser(userID string) error
+	SetRole(userID, role string) error
+	Role(userID string) (string, error)
+	ChangeUsername(userID, username string, cooldown, reservation time.Duration) (usermodel.UsernameChange, error)
+	GetUserByOldUsername(username string) (usermodel.User, error)
+	ListSessions(userID string) ([]usermodel.Session, error)
+	RevokeSession(userID, sessionID string) error
+	RevokeOtherSessions(userID, sessionID string) error
+	RevokeAllSessions(userID string) error
+	GetSuggestions(userID string, limit int) ([]usermodel.Suggestion, error)
+	DismissSuggestion(userID, candidateID string) error
+	RefreshSuggestions(perUser, batch int) (int64, error)
+	GetRelationships(userID string, targetIDs []string) ([]usermodel.RelationshipStatus, error)
+	CreateBot(bot usermodel.User) (usermodel.User, error)
+	CreateAPIKey(key usermodel.APIKey) (usermodel.APIKey, error)
+	ListAPIKeys(userID string) ([]usermodel.APIKey, error)
+	RevokeAPIKey(userID, keyID string) error
+	VerifyAPIKey(hash string) (usermodel.APIKey, error)
 }
@@ -0,0 +1,118 @@
+package handler_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/internal/handler"
+	"github.com/jackgris/twitter-backend/auth/pkg/attempts"
+	"github.com/jackgris/twitter-backend/auth/pkg/logger"
+	"github.com/jackgris/twitter-backend/auth/pkg/mailer"
+	"github.com/jackgris/twitter-backend/auth/pkg/middleware"
+	"github.com/jackgris/twitter-backend/auth/pkg/msgbroker"
+	"github.com/jackgris/twitter-backend/auth/pkg/ratelimit"
+	"github.com/jackgris/twitter-backend/auth/pkg/token"
+	"github.com/stretchr/testify/assert"
+)
+
+// MockStore implements the methods the tests set, calling any other method
+// panics.
+type MockStore struct {
+	handler.Store
+	GetUserbyIDFunc              func(id string) (usermodel.User, error)
+	GetUserByLoginFunc           func(login string) (usermodel.User, error)
+	GetUsersByIDOrUsernameFunc   func(ids, usernames []string) ([]usermodel.User, error)
+	UpdateFunc                   func(id string, patch usermodel.UserPatch, version int) (usermodel.User, []usermodel.UserFollowers, error)
+	RevokeOtherSessionsFunc      func(userID, sessionID string) error
+	GetRelationshipsFunc         func(userID string, targetIDs []string) ([]usermodel.RelationshipStatus, error)
+	FollowFunc                   func(follow usermodel.UserFollowers) (usermodel.UserFollowers, bool, error)
+	RequestFollowFunc            func(follow usermodel.UserFollowers) (usermodel.FollowRequest, bool, error)
+	CreatePasswordResetTokenFunc func(rt usermodel.PasswordResetToken) error
+	GetMFAFunc                   func(userID string) (usermodel.MFA, error)
+	CreateSessionFunc            func(session usermodel.Session, rt usermodel.RefreshToken) error
+	UnsuspendUserFunc            func(userID string) error
+	RevokeAllSessionsFunc        func(userID string) error
+}
+
+func (m *MockStore) GetUserbyID(id string) (usermodel.User, error) {
+	return m.GetUserbyIDFunc(id)
+}
+func (m *MockStore) GetUserByLogin(login string) (usermodel.User, error) {
+	return m.GetUserByLoginFunc(login)
+}
+func (m *MockStore) GetUsersByIDOrUsername(ids, usernames []string) ([]usermodel.User, error) {
+	return m.GetUsersByIDOrUsernameFunc(ids, usernames)
+}
+func (m *MockStore) Update(id string, patch usermodel.UserPatch, version int) (usermodel.User, []usermodel.UserFollowers, error) {
+	return m.UpdateFunc(id, patch, version)
+}
+func (m *MockStore) RevokeOtherSessions(userID, sessionID string) error {
+	return m.RevokeOtherSessionsFunc(userID, sessionID)
+}
+
+func (m *MockStore) GetRelationships(userID string, targetIDs []string) ([]usermodel.RelationshipStatus, error) {
+	return m.GetRelationshipsFunc(userID, targetIDs)
+}
+func (m *MockStore) Follow(follow usermodel.UserFollowers) (usermodel.UserFollowers, bool, error) {
+	return m.FollowFunc(follow)
+}
+func (m *MockStore) RequestFollow(follow usermodel.UserFollowers) (usermodel.FollowRequest, bool, error) {
+	return m.RequestFollowFunc(follow)
+}
+func (m *MockStore) CreatePasswordResetToken(rt usermodel.PasswordResetToken) error {
+	return m.CreatePasswordResetTokenFunc(rt)
+}
+func (m *MockStore) GetMFA(userID string) (usermodel.MFA, error) {
+	return m.GetMFAFunc(userID)
+}
+func (m *MockStore) CreateSession(session usermodel.Session, rt usermodel.RefreshToken) error {
+	return m.CreateSessionFunc(session, rt)
+}
+func (m *MockStore) UnsuspendUser(userID string) error {
+	return m.UnsuspendUserFunc(userID)
+}
+func (m *MockStore) RevokeAllSessions(userID string) error {
+	return m.RevokeAllSessionsFunc(userID)
+}
+
+// newHandler returns a handler for store with an in-memory mailer, failed
+// logins tracker and limits: 3 imported follows, 2 password resets per email
+// and 3 per IP, and 2 verification emails per user. configure changes the
+// config before it is used.
+func newHandler(t *testing.T, store handler.Store, configure ...func(*handler.Config)) handler.UserHandler {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	tokens, err := token.NewIssuer([]token.Key{{ID: "key", Private: key}}, "", "twitter-backend-auth", "twitter-backend", time.Minute, time.Hour)
+	assert.NoError(t, err)
+
+	policy := attempts.Policy{Free: 3, BaseDelay: time.Minute, MaxDelay: time.Minute, LockoutAfter: 10, LockoutDuration: time.Hour, Window: time.Hour}
+	config := handler.Config{
+		Mailer:        mailer.NewMemory(),
+		Signer:        token.NewSigner([]byte("secret")),
+		LoginAccounts: attempts.NewMemory(policy),
+		LoginIPs:      attempts.NewMemory(policy),
+		FollowImports:      ratelimit.NewWindow(3, time.Hour),
+		ResetEmails:        ratelimit.NewWindow(2, time.Hour),
+		ResetIPs:           ratelimit.NewWindow(3, time.Hour),
+		VerificationEmails: ratelimit.NewWindow(2, time.Hour),
+	}
+	for _, f := range configure {
+		f(&config)
+	}
+
+	logs := logger.New(io.Discard)
+	return handler.NewTweetHandler(store, msgbroker.NewMockMsgBroker(logs), tokens, config, logs)
+}
+
+// authorized returns r as if Authorize accepted the access token of userID
+// in the session sessionID.
+func authorized(r *http.Request, userID, sessionID string) *http.Request {
+	return r.WithContext(middleware.ContextWithClaims(r.Context(), middleware.Claims{UserID: userID, SessionID: sessionID}))
+}
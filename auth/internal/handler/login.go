@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/jackgris/twitter-backend/auth/pkg/password"
+	"github.com/jackgris/twitter-backend/auth/pkg/token"
+	"github.com/jackgris/twitter-backend/auth/pkg/uuid"
+)
+
+// dummyHash is verified when the login does not match any user so unknown
+// accounts take as long to reject as wrong passwords.
+var dummyHash, _, _ = password.Hash("dummy password")
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (u UserHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Login    string `json:"login"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if input.Login == "" || input.Password == "" {
+		http.Error(w, "login and password are required", http.StatusBadRequest)
+		return
+	}
+
+	keys := loginKeys(r, input.Login)
+	if wait := u.loginWait(r.Context(), keys); wait > 0 {
+		tooManyAttempts(w, wait)
+		return
+	}
+
+	user, err := u.store.GetUserByLogin(input.Login)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+			return
+		}
+		_, _, _ = password.Verify(input.Password, dummyHash)
+		u.loginFailed(w, r, keys)
+		return
+	}
+
+	// Known users count their failures under their ID from here on
+	keys = userKeys(r, user.ID)
+	if wait := u.loginWait(r.Context(), keys); wait > 0 {
+		tooManyAttempts(w, wait)
+		return
+	}
+
+	ok, needsRehash, err := password.Verify(input.Password, user.Password)
+	if err != nil {
+		u.logs.Error(r.Context(), "auth service", "login: verifying password", err, "user ID", user.ID)
+		u.loginFailed(w, r, keys)
+		return
+	}
+	if !ok {
+		u.loginFailed(w, r, keys)
+		return
+	}
+
+	// The IP keeps its failures, otherwise logging in to their own account
+	// would let an attacker keep guessing the passwords of others
+	if err := u.config.LoginAccounts.Reset(r.Context(), keys.account); err != nil {
+		u.logs.Error(r.Context(), "auth service", "login: resetting failed attempts", err, "user ID", user.ID)
+	}
+
+	if needsRehash {
+		u.rehashPassword(r.Context(), user.ID, user.Password, input.Password)
+	}
+
+	u.logInOrChallenge(w, r, user)
+}
+
+// logIn issues the access token and a refresh token of a new token family
+// for user, which starts a new session. Suspended users can't log in.
+func (u UserHandler) logIn(w http.ResponseWriter, r *http.Request, user usermodel.User) {
+	if user.SuspendedAt != nil {
+		http.Error(w, "account suspended", http.StatusForbidden)
+		return
+	}
+
+	familyID := uuid.New()
+	accessToken, _, err := u.tokens.Issue(identity(user, familyID))
+	if err != nil {
+		http.Error(w, "Can't issue access token", http.StatusInternalServerError)
+		return
+	}
+
+	refresh, hash, expiresAt, err := u.tokens.IssueRefresh()
+	if err != nil {
+		http.Error(w, "Can't issue refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	session := usermodel.Session{
+		UserAgent: truncateRunes(r.UserAgent(), 512),
+		IP:        clientIP(r),
+	}
+	err = u.store.CreateSession(session, usermodel.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hash,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		http.Error(w, "Can't save refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	u.writeTokens(w, accessToken, refresh)
+}
+
+func (u UserHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if input.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	refresh, hash, expiresAt, err := u.tokens.IssueRefresh()
+	if err != nil {
+		http.Error(w, "Can't issue refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	next := usermodel.RefreshToken{
+		TokenHash: hash,
+		ExpiresAt: expiresAt,
+	}
+	old, err := u.store.RotateRefreshToken(token.HashOpaque(input.RefreshToken), next, clientIP(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, userdb.ErrRefreshTokenReused):
+			u.logs.Warn(r.Context(), "auth service", "refresh token reused, token family revoked")
+			http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		case errors.Is(err, userdb.ErrRefreshTokenNotFound),
+			errors.Is(err, userdb.ErrRefreshTokenExpired),
+			errors.Is(err, userdb.ErrRefreshTokenRevoked):
+			http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		default:
+			http.Error(w, "Can't rotate refresh token", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	user, err := u.store.GetUserbyID(old.UserID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		return
+	}
+
+	if user.SuspendedAt != nil {
+		http.Error(w, "account suspended", http.StatusForbidden)
+		return
+	}
+
+	accessToken, _, err := u.tokens.Issue(identity(user, old.FamilyID))
+	if err != nil {
+		http.Error(w, "Can't issue access token", http.StatusInternalServerError)
+		return
+	}
+
+	u.writeTokens(w, accessToken, refresh)
+}
+
+func (u UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if input.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	err := u.store.RevokeRefreshToken(token.HashOpaque(input.RefreshToken))
+	if err != nil && !errors.Is(err, userdb.ErrRefreshTokenNotFound) {
+		http.Error(w, "Can't revoke refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u UserHandler) writeTokens(w http.ResponseWriter, accessToken, refreshToken string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(u.tokens.TTL().Seconds()),
+		RefreshToken: refreshToken,
+	})
+}
+
+// identity is what the access token of user in the session says about them.
+func identity(user usermodel.User, sessionID string) token.Identity {
+	return token.Identity{
+		UserID:        user.ID,
+		Username:      user.UserName,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		Role:          user.Role,
+		SessionID:     sessionID,
+	}
+}
+
+// rehashPassword upgrades a plaintext or outdated hash after a successful
+// login. Failing here must not fail the login itself.
+func (u UserHandler) rehashPassword(ctx context.Context, userID, old, plain string) {
+	hash, salt, err := password.Hash(plain)
+	if err != nil {
+		u.logs.Error(ctx, "auth service", "login: rehashing password", err, "user ID", userID)
+		return
+	}
+
+	if err := u.store.ReplacePassword(userID, old, hash, salt); err != nil {
+		u.logs.Error(ctx, "auth service", "login: saving rehashed password", err, "user ID", userID)
+	}
+}
+
+// JWKS publishes the public keys access tokens are signed with.
+func (u UserHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(u.tokens.JWKS())
+}
@@ -0,0 +1,94 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/internal/handler"
+	"github.com/jackgris/twitter-backend/auth/pkg/password"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginAttempts(t *testing.T) {
+	hash, salt, err := password.Hash("Passw0rd!")
+	assert.NoError(t, err)
+	user := usermodel.User{ID: "csvqvamek44s73e2qf8g", UserName: "jackgris", Email: "jack@example.com", Password: hash, Salt: salt}
+
+	store := &MockStore{
+		GetUserByLoginFunc: func(login string) (usermodel.User, error) {
+			if strings.EqualFold(login, user.UserName) || strings.EqualFold(login, user.Email) {
+				return user, nil
+			}
+			return usermodel.User{}, pgx.ErrNoRows
+		},
+		GetMFAFunc: func(userID string) (usermodel.MFA, error) {
+			return usermodel.MFA{}, pgx.ErrNoRows
+		},
+		CreateSessionFunc: func(session usermodel.Session, rt usermodel.RefreshToken) error {
+			return nil
+		},
+	}
+
+	// Every request comes from its own IP, only the account is counted
+	requests := 0
+	login := func(h handler.UserHandler, login, pass string) int {
+		requests++
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"login":"`+login+`","password":"`+pass+`"}`))
+		req.Header.Set("X-Real-IP", "10.0.0."+strconv.Itoa(requests))
+		rec := httptest.NewRecorder()
+
+		h.Login(rec, req)
+		return rec.Code
+	}
+
+	unlock := func(h handler.UserHandler, login string) int {
+		req := httptest.NewRequest(http.MethodPost, "/admin/unlock", strings.NewReader(`{"login":"`+login+`"}`))
+		rec := httptest.NewRecorder()
+
+		h.Unlock(rec, req)
+		return rec.Code
+	}
+
+	t.Run("Username and email share the failures", func(t *testing.T) {
+		h := newHandler(t, store)
+
+		assert.Equal(t, http.StatusUnauthorized, login(h, "jackgris", "wrong"))
+		assert.Equal(t, http.StatusUnauthorized, login(h, "JackGris", "wrong"))
+		assert.Equal(t, http.StatusUnauthorized, login(h, "jack@example.com", "wrong"))
+		assert.Equal(t, http.StatusUnauthorized, login(h, "JACK@example.com", "wrong"))
+
+		// The right password has to wait too
+		assert.Equal(t, http.StatusTooManyRequests, login(h, "jackgris", "Passw0rd!"))
+	})
+
+	t.Run("Unlock by any login", func(t *testing.T) {
+		h := newHandler(t, store)
+
+		for range 4 {
+			login(h, "jackgris", "wrong")
+		}
+		assert.Equal(t, http.StatusTooManyRequests, login(h, "jack@example.com", "Passw0rd!"))
+
+		assert.Equal(t, http.StatusNoContent, unlock(h, "Jack@Example.com"))
+
+		assert.Equal(t, http.StatusOK, login(h, "jack@example.com", "Passw0rd!"))
+	})
+
+	t.Run("Unknown logins are counted by login", func(t *testing.T) {
+		h := newHandler(t, store)
+
+		for range 4 {
+			assert.Equal(t, http.StatusUnauthorized, login(h, "nobody", "wrong"))
+		}
+		assert.Equal(t, http.StatusTooManyRequests, login(h, "Nobody", "wrong"))
+		assert.Equal(t, http.StatusOK, login(h, "jackgris", "Passw0rd!"))
+
+		assert.Equal(t, http.StatusNoContent, unlock(h, "nobody"))
+		assert.Equal(t, http.StatusUnauthorized, login(h, "nobody", "wrong"))
+	})
+}
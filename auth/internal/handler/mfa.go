@@ -0,0 +1,362 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/jackgris/twitter-backend/auth/pkg/token"
+	"github.com/jackgris/twitter-backend/auth/pkg/totp"
+)
+
+const (
+	// mfaLoginPurpose binds the signed challenge tokens to the second step of
+	// the login.
+	mfaLoginPurpose = "mfa-login"
+	// mfaLoginTTL is how long the user has to enter the code after the
+	// password
+	mfaLoginTTL = 5 * time.Minute
+	// recoveryCodes is how many recovery codes a user gets
+	recoveryCodes = 10
+)
+
+var (
+	errMFACodeRequired = errors.New("code or recovery_code is required")
+	errMFACodeInvalid  = errors.New("invalid code")
+)
+
+// MFAChallengeResponse is the answer of a login whose password was right
+// when the user has two-factor authentication, the token is exchanged with a
+// code at /login/mfa for the access and refresh tokens.
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// EnrollMFA starts the two-factor enrollment of the logged user. The secret
+// is returned as an otpauth URI for authenticator apps, and two-factor
+// authentication is only enabled once ConfirmMFA gets a code generated with
+// it.
+func (u UserHandler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	userID, ok := actingUser(w, r, "")
+	if !ok {
+		return
+	}
+
+	user, err := u.store.GetUserbyID(userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		return
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		http.Error(w, "Can't generate two-factor secret", http.StatusInternalServerError)
+		return
+	}
+
+	if err := u.store.EnrollMFA(userID, secret); err != nil {
+		if errors.Is(err, userdb.ErrMFAEnabled) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, "Can't save two-factor secret", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}{
+		Secret:     secret,
+		OTPAuthURI: totp.URI(u.config.MFAIssuer, user.UserName, secret),
+	})
+}
+
+// ConfirmMFA enables two-factor authentication with a code of the enrolled
+// secret and returns the recovery codes. They are only shown this time.
+func (u UserHandler) ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := actingUser(w, r, "")
+	if !ok {
+		return
+	}
+
+	if input.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	mfa, err := u.store.GetMFA(userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Failed to retrieve two-factor settings", http.StatusInternalServerError)
+		return
+	}
+	if err != nil || mfa.EnabledAt != nil {
+		http.Error(w, userdb.ErrMFANotPending.Error(), http.StatusConflict)
+		return
+	}
+
+	step, ok := totp.Validate(mfa.Secret, input.Code, time.Now())
+	if !ok {
+		http.Error(w, errMFACodeInvalid.Error(), http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		http.Error(w, "Can't generate recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	if err := u.store.EnableMFA(userID, step, hashes); err != nil {
+		if errors.Is(err, userdb.ErrMFANotPending) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, "Can't enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	u.logs.Info(r.Context(), "auth service", "two-factor authentication enabled", "user ID", userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{
+		RecoveryCodes: codes,
+	})
+}
+
+// DisableMFA turns off two-factor authentication. It needs a current code or
+// a recovery code, an access token alone isn't enough.
+func (u UserHandler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := actingUser(w, r, "")
+	if !ok {
+		return
+	}
+
+	mfa, err := u.store.GetMFA(userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Failed to retrieve two-factor settings", http.StatusInternalServerError)
+		return
+	}
+	if err != nil || mfa.EnabledAt == nil {
+		http.Error(w, "two-factor authentication is not enabled", http.StatusConflict)
+		return
+	}
+
+	keys := mfaKeys(r, userID)
+	if wait := u.loginWait(r.Context(), keys); wait > 0 {
+		tooManyAttempts(w, wait)
+		return
+	}
+
+	if !u.secondFactor(w, r, keys, mfa, input.Code, input.RecoveryCode) {
+		return
+	}
+
+	if err := u.store.DisableMFA(userID); err != nil {
+		http.Error(w, "Can't disable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	u.logs.Info(r.Context(), "auth service", "two-factor authentication disabled", "user ID", userID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LoginMFA is the second step of the login of users with two-factor
+// authentication, it exchanges the challenge token and a code for the access
+// and refresh tokens.
+func (u UserHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if input.MFAToken == "" {
+		http.Error(w, "mfa_token is required", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := u.config.Signer.Verify(mfaLoginPurpose, input.MFAToken)
+	if err != nil {
+		http.Error(w, "invalid or expired mfa_token, log in again", http.StatusUnauthorized)
+		return
+	}
+
+	keys := mfaKeys(r, userID)
+	if wait := u.loginWait(r.Context(), keys); wait > 0 {
+		tooManyAttempts(w, wait)
+		return
+	}
+
+	mfa, err := u.store.GetMFA(userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Failed to retrieve two-factor settings", http.StatusInternalServerError)
+		return
+	}
+	if err != nil || mfa.EnabledAt == nil {
+		// Disabled after the password step, log in again
+		http.Error(w, "invalid or expired mfa_token, log in again", http.StatusUnauthorized)
+		return
+	}
+
+	if !u.secondFactor(w, r, keys, mfa, input.Code, input.RecoveryCode) {
+		return
+	}
+
+	if err := u.config.LoginAccounts.Reset(r.Context(), keys.account); err != nil {
+		u.logs.Error(r.Context(), "auth service", "login: resetting failed attempts", err, "user ID", userID)
+	}
+
+	user, err := u.store.GetUserbyID(userID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		return
+	}
+
+	u.logIn(w, r, user)
+}
+
+// logInOrChallenge finishes the login of user when they don't have two-factor
+// authentication, and otherwise answers with the challenge for the code.
+func (u UserHandler) logInOrChallenge(w http.ResponseWriter, r *http.Request, user usermodel.User) {
+	if user.SuspendedAt != nil {
+		http.Error(w, "account suspended", http.StatusForbidden)
+		return
+	}
+
+	mfa, err := u.store.GetMFA(user.ID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Failed to retrieve two-factor settings", http.StatusInternalServerError)
+		return
+	}
+	if err != nil || mfa.EnabledAt == nil {
+		u.logIn(w, r, user)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    u.config.Signer.Sign(mfaLoginPurpose, user.ID, time.Now().Add(mfaLoginTTL)),
+		ExpiresIn:   int(mfaLoginTTL.Seconds()),
+	})
+}
+
+// secondFactor checks the code or recovery code of the user and uses it up.
+// Wrong codes count as failed logins. It answers the request and returns
+// false when the check fails.
+func (u UserHandler) secondFactor(w http.ResponseWriter, r *http.Request, keys attemptKeys, mfa usermodel.MFA, code, recoveryCode string) bool {
+	var err error
+	switch {
+	case code != "":
+		step, ok := totp.Validate(mfa.Secret, code, time.Now())
+		if !ok {
+			err = errMFACodeInvalid
+			break
+		}
+		err = u.store.UseMFAStep(mfa.UserID, step)
+	case recoveryCode != "":
+		err = u.store.UseRecoveryCode(mfa.UserID, token.HashOpaque(normalizeRecoveryCode(recoveryCode)))
+		if err == nil {
+			u.logs.Info(r.Context(), "auth service", "recovery code used", "user ID", mfa.UserID)
+		}
+	default:
+		http.Error(w, errMFACodeRequired.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errMFACodeInvalid),
+		errors.Is(err, userdb.ErrMFACodeUsed),
+		errors.Is(err, userdb.ErrRecoveryCodeInvalid):
+		u.recordFailure(r.Context(), keys)
+		http.Error(w, errMFACodeInvalid.Error(), http.StatusUnauthorized)
+	default:
+		http.Error(w, "Can't check the code", http.StatusInternalServerError)
+	}
+	return false
+}
+
+// mfaKeys counts the failed codes of a user apart from their failed
+// passwords, guessing a code needs the password first.
+func mfaKeys(r *http.Request, userID string) attemptKeys {
+	return attemptKeys{
+		account: mfaKey(userID),
+		ip:      ipKey(clientIP(r)),
+	}
+}
+
+func mfaKey(userID string) string {
+	return "mfa:" + userID
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryCodes returns the recovery codes shown to the user, like
+// "abcde-fghij", and the hashes stored.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodes)
+	hashes := make([]string, recoveryCodes)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(recoveryEncoding.EncodeToString(b))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = token.HashOpaque(code)
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode accepts recovery codes typed in upper case or without
+// the dash.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -7,18 +7,27 @@ import (
 )
 
 type User struct {
-	ID             string          `json:"id"`
-	UserName       string          `json:"username"`
-	Email          string          `json:"email"`
-	Password       string          `json:"-"`
-	FollowerCount  int             `json:"follower_count"`
-	FollowingCount int             `json:"following_count"`
-	Salt           string          `json:"-"`
-	Token          string          `json:"-"`
-	DateCreated    time.Time       `json:"date_created"`
-	EncodedDate    string          `json:"-"`
-	Followers      []UserFollowers `json:"followers"`
-	Following      []UserFollowers `json:"following"`
+	ID             string    `json:"id"`
+	UserName       string    `json:"username"`
+	Email          string    `json:"email"`
+	Password       string    `json:"-"`
+	FollowerCount  int       `json:"follower_count"`
+	FollowingCount int       `json:"following_count"`
+	Salt           string    `json:"-"`
+	Token          string    `json:"-"`
+	DateCreated    time.Time `json:"date_created"`
+	EncodedDate    string    `json:"-"`
+	Version        int       `json:"version"`
+	Protected      bool      `json:"protected"`
+	EmailVerified  bool      `json:"email_verified"`
+	DisplayName    string    `json:"display_name"`
+	Bio            string    `json:"bio"`
+	AvatarURL      string    `json:"avatar_url"`
+	Location       string    `json:"location"`
+	Website        string    `json:"website"`
+	// RedirectedFrom is the old username the user was found by, when they
+	// changed it recently
+	RedirectedFrom string `json:"redirected_from,omitempty"`
 }
 
 type UserFollowers struct {
@@ -39,23 +48,17 @@ func UserToJSON(user usermodel.User) User {
 		Token:          user.Token,
 		DateCreated:    user.DateCreated,
 		EncodedDate:    user.EncodedDate,
-		Followers:      followersToJSON(user.Followers),
-		Following:      followersToJSON(user.Following),
+		Version:        user.Version,
+		Protected:      user.Protected,
+		EmailVerified:  user.EmailVerifiedAt != nil,
+		DisplayName:    user.DisplayName,
+		Bio:            user.Bio,
+		AvatarURL:      user.AvatarURL,
+		Location:       user.Location,
+		Website:        user.Website,
 	}
 }
 
-func followersToJSON(followers []usermodel.UserFollowers) []UserFollowers {
-	var convertedFollowers []UserFollowers
-	for _, follower := range followers {
-		convertedFollowers = append(convertedFollowers, UserFollowers{
-			ID:         follower.ID,
-			UserID:     follower.UserID,
-			FollowerID: follower.FollowerID,
-		})
-	}
-	return convertedFollowers
-}
-
 func FollowerToJSON(follower usermodel.UserFollowers) UserFollowers {
 	return UserFollowers{
 		ID:         follower.ID,
@@ -63,3 +66,178 @@ func FollowerToJSON(follower usermodel.UserFollowers) UserFollowers {
 		FollowerID: follower.FollowerID,
 	}
 }
+
+type UserSummary struct {
+	ID             string `json:"id"`
+	UserName       string `json:"username"`
+	DisplayName    string `json:"display_name"`
+	AvatarURL      string `json:"avatar_url"`
+	FollowerCount  int    `json:"follower_count"`
+	FollowingCount int    `json:"following_count"`
+}
+
+type UserPage struct {
+	Users      []UserSummary `json:"users"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+func UserSummaryToJSON(user usermodel.UserSummary) UserSummary {
+	return UserSummary{
+		ID:             user.ID,
+		UserName:       user.UserName,
+		DisplayName:    user.DisplayName,
+		AvatarURL:      user.AvatarURL,
+		FollowerCount:  user.FollowerCount,
+		FollowingCount: user.FollowingCount,
+	}
+}
+
+func UserPageToJSON(page usermodel.UserPage) UserPage {
+	users := make([]UserSummary, 0, len(page.Users))
+	for _, user := range page.Users {
+		users = append(users, UserSummaryToJSON(user))
+	}
+
+	return UserPage{
+		Users:      users,
+		NextCursor: page.NextCursor,
+	}
+}
+
+type Relationship struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	TargetID  string    `json:"target_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func RelationshipToJSON(rel usermodel.Relationship) Relationship {
+	return Relationship{
+		ID:        rel.ID,
+		UserID:    rel.UserID,
+		TargetID:  rel.TargetID,
+		CreatedAt: rel.CreatedAt,
+	}
+}
+
+type FollowRequest struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	FollowerID string    `json:"follower_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func FollowRequestToJSON(request usermodel.FollowRequest) FollowRequest {
+	return FollowRequest{
+		ID:         request.ID,
+		UserID:     request.UserID,
+		FollowerID: request.FollowerID,
+		CreatedAt:  request.CreatedAt,
+	}
+}
+
+type Session struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+func SessionToJSON(session usermodel.Session) Session {
+	return Session{
+		ID:         session.ID,
+		UserAgent:  session.UserAgent,
+		IP:         session.IP,
+		CreatedAt:  session.CreatedAt,
+		LastUsedAt: session.LastUsedAt,
+	}
+}
+
+type Suggestion struct {
+	User             UserSummary `json:"user"`
+	Score            float64     `json:"score"`
+	FriendsOfFriends int         `json:"friends_of_friends"`
+	MutualFollowers  int         `json:"mutual_followers"`
+}
+
+func SuggestionToJSON(suggestion usermodel.Suggestion) Suggestion {
+	return Suggestion{
+		User:             UserSummaryToJSON(suggestion.User),
+		Score:            suggestion.Score,
+		FriendsOfFriends: suggestion.FriendsOfFriends,
+		MutualFollowers:  suggestion.MutualFollowers,
+	}
+}
+
+type RelationshipStatus struct {
+	TargetID              string `json:"target_id"`
+	Following             bool   `json:"following"`
+	FollowedBy            bool   `json:"followed_by"`
+	FollowRequested       bool   `json:"follow_requested"`
+	FollowRequestReceived bool   `json:"follow_request_received"`
+	Blocking              bool   `json:"blocking"`
+	BlockedBy             bool   `json:"blocked_by"`
+	Muting                bool   `json:"muting"`
+}
+
+func RelationshipStatusToJSON(status usermodel.RelationshipStatus) RelationshipStatus {
+	return RelationshipStatus{
+		TargetID:              status.TargetID,
+		Following:             status.Following,
+		FollowedBy:            status.FollowedBy,
+		FollowRequested:       status.FollowRequested,
+		FollowRequestReceived: status.FollowRequestReceived,
+		Blocking:              status.Blocking,
+		BlockedBy:             status.BlockedBy,
+		Muting:                status.Muting,
+	}
+}
+
+type UsernameChange struct {
+	UserID        string    `json:"user_id"`
+	OldUsername   string    `json:"old_username"`
+	Username      string    `json:"username"`
+	ReservedUntil time.Time `json:"reserved_until"`
+	NextChangeAt  time.Time `json:"next_change_at"`
+}
+
+func UsernameChangeToJSON(change usermodel.UsernameChange) UsernameChange {
+	return UsernameChange{
+		UserID:        change.UserID,
+		OldUsername:   change.OldUsername,
+		Username:      change.NewUsername,
+		ReservedUntil: change.ReservedUntil,
+		NextChangeAt:  change.NextChangeAt,
+	}
+}
+
+type APIKey struct {
+	ID     string   `json:"id"`
+	UserID string   `json:"user_id"`
+	Name   string   `json:"name"`
+	Prefix string   `json:"prefix"`
+	Scopes []string `json:"scopes"`
+	// Key is only sent once, when the key is created
+	Key        string     `json:"key,omitempty"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+func APIKeyToJSON(key usermodel.APIKey) APIKey {
+	return APIKey{
+		ID:         key.ID,
+		UserID:     key.UserID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		CreatedBy:  key.CreatedBy,
+		CreatedAt:  key.CreatedAt,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+	}
+}
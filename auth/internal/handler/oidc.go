@@ -0,0 +1,255 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/jackgris/twitter-backend/auth/pkg/oidc"
+	"github.com/jackgris/twitter-backend/auth/pkg/password"
+	"github.com/jackgris/twitter-backend/auth/pkg/token"
+)
+
+const (
+	// oidcLoginPurpose binds the signed login cookie to the OIDC login.
+	oidcLoginPurpose = "oidc-login"
+	oidcLoginCookie  = "oidc_login"
+	// oidcLoginTTL is how long the user has to log in with the provider
+	oidcLoginTTL = 10 * time.Minute
+)
+
+// OIDCLogin sends the user to log in with the external provider. The state,
+// nonce and PKCE verifier of the login are kept in a signed cookie until the
+// provider sends the user back to OIDCCallback.
+func (u UserHandler) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	var values [3]string
+	for i := range values {
+		value, err := token.NewOpaque()
+		if err != nil {
+			http.Error(w, "Can't start login", http.StatusInternalServerError)
+			return
+		}
+		values[i] = value
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	expiresAt := time.Now().Add(oidcLoginTTL)
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcLoginCookie,
+		Value:    u.config.Signer.Sign(oidcLoginPurpose, state+" "+nonce+" "+verifier, expiresAt),
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   secureRequest(r),
+		// Lax so the cookie is sent when the provider redirects back
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, u.config.OIDC.AuthCodeURL(state, nonce, verifier), http.StatusFound)
+}
+
+// OIDCCallback finishes the login with the external provider. The first
+// login of an identity links it to the user with the same verified email, or
+// creates a new user. The user gets our own access and refresh tokens, or the
+// two-factor challenge when they enabled it.
+func (u UserHandler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	// The cookie is single use
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcLoginCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   secureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if r.URL.Query().Get("error") != "" {
+		http.Error(w, "login refused by the provider", http.StatusUnauthorized)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcLoginCookie)
+	if err != nil {
+		http.Error(w, "login expired, start again", http.StatusBadRequest)
+		return
+	}
+
+	value, err := u.config.Signer.Verify(oidcLoginPurpose, cookie.Value)
+	if err != nil {
+		http.Error(w, "login expired, start again", http.StatusBadRequest)
+		return
+	}
+
+	parts := strings.Split(value, " ")
+	state := r.URL.Query().Get("state")
+	if len(parts) != 3 || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(state)) != 1 {
+		http.Error(w, "invalid login state", http.StatusBadRequest)
+		return
+	}
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	id, err := u.config.OIDC.Exchange(r.Context(), code, parts[2], parts[1])
+	if err != nil {
+		u.logs.Error(r.Context(), "auth service", "oidc: exchanging code", err)
+		if errors.Is(err, oidc.ErrExchange) || errors.Is(err, oidc.ErrInvalidIDToken) {
+			http.Error(w, "login with the provider failed", http.StatusUnauthorized)
+		} else {
+			http.Error(w, "Can't finish login", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	user, err := u.oidcUser(r, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, errOIDCEmailMissing):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, userdb.ErrEmailTaken):
+			http.Error(w, "an account with this email already exists, log in with its password", http.StatusConflict)
+		default:
+			u.logs.Error(r.Context(), "auth service", "oidc: finding user", err, "subject", id.Subject)
+			http.Error(w, "Can't finish login", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	u.logInOrChallenge(w, r, user)
+}
+
+var errOIDCEmailMissing = errors.New("the provider didn't share an email")
+
+// oidcUser returns the user linked to the identity, linking or creating one
+// on its first login.
+func (u UserHandler) oidcUser(r *http.Request, id oidc.IDToken) (usermodel.User, error) {
+	issuer := u.config.OIDC.Issuer()
+
+	user, err := u.store.GetUserByIdentity(issuer, id.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return usermodel.User{}, err
+	}
+
+	if id.Email == "" {
+		return usermodel.User{}, errOIDCEmailMissing
+	}
+
+	identity := usermodel.UserIdentity{Issuer: issuer, Subject: id.Subject, Email: id.Email}
+
+	// Only link an existing account when both sides proved they own the
+	// email, otherwise anyone could take over an account by registering its
+	// email with the provider
+	existing, err := u.store.GetUserByLogin(id.Email)
+	if err == nil {
+		if !id.EmailVerified || existing.EmailVerifiedAt == nil || !strings.EqualFold(existing.Email, id.Email) {
+			return usermodel.User{}, userdb.ErrEmailTaken
+		}
+		identity.UserID = existing.ID
+		if err := u.store.LinkIdentity(identity); err != nil {
+			return usermodel.User{}, err
+		}
+		return existing, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return usermodel.User{}, err
+	}
+
+	// The password is random and never shown, the user can set one with a
+	// password reset
+	secret, err := token.NewOpaque()
+	if err != nil {
+		return usermodel.User{}, err
+	}
+	hash, salt, err := password.Hash(secret)
+	if err != nil {
+		return usermodel.User{}, err
+	}
+
+	base := oidcUsername(id)
+	for attempt := 0; ; attempt++ {
+		name := base
+		if attempt > 0 {
+			name = usernameWithSuffix(base)
+		}
+
+		user, err = u.store.CreateUserWithIdentity(usermodel.User{
+			UserName:    name,
+			Email:       id.Email,
+			Password:    hash,
+			Salt:        salt,
+			DisplayName: truncateRunes(id.Name, 50),
+		}, identity, id.EmailVerified)
+		if errors.Is(err, userdb.ErrUsernameTaken) && attempt < 5 {
+			continue
+		}
+		if errors.Is(err, userdb.ErrIdentityTaken) {
+			// Another request finished the first login meanwhile
+			return u.store.GetUserByIdentity(issuer, id.Subject)
+		}
+		if err != nil {
+			return usermodel.User{}, err
+		}
+
+		if !id.EmailVerified {
+			if err := u.sendVerificationEmail(r.Context(), user); err != nil {
+				u.logs.Error(r.Context(), "auth service", "sending verification email", err, "user ID", user.ID)
+			}
+		}
+		return user, nil
+	}
+}
+
+// oidcUsername makes a valid username out of the preferred username, the
+// name or the email of the identity.
+func oidcUsername(id oidc.IDToken) string {
+	local, _, _ := strings.Cut(id.Email, "@")
+	for _, candidate := range []string{id.PreferredUsername, id.Name, local} {
+		var b strings.Builder
+		for _, r := range candidate {
+			if r < utf8.RuneSelf && (r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+				b.WriteRune(r)
+			}
+		}
+		if name := b.String(); name != "" {
+			return truncateRunes(name, 15)
+		}
+	}
+	return "user"
+}
+
+// usernameWithSuffix adds 4 random digits to name keeping it within 15
+// characters.
+func usernameWithSuffix(name string) string {
+	n, err := rand.Int(rand.Reader, big.NewInt(10000))
+	if err != nil {
+		n = big.NewInt(time.Now().UnixNano() % 10000)
+	}
+	return truncateRunes(name, 11) + strings.Repeat("0", 4-len(n.String())) + n.String()
+}
+
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max])
+}
+
+// secureRequest tells if the client reached us over HTTPS, directly or
+// through the proxy.
+func secureRequest(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/jackgris/twitter-backend/auth/pkg/password"
+)
+
+// MigratePlaintextPasswords hashes every password that was stored in
+// plaintext before hashing was introduced. It runs in batches until no
+// plaintext rows are left.
+func (u *UserHandler) MigratePlaintextPasswords() {
+	ctx := context.Background()
+	migrated := 0
+	for {
+		users, err := u.store.ListPlaintextPasswords(100)
+		if err != nil {
+			u.logs.Error(ctx, "auth service", "password migration: listing plaintext passwords", err)
+			return
+		}
+		if len(users) == 0 {
+			break
+		}
+
+		for _, user := range users {
+			hash, salt, err := password.Hash(user.Password)
+			if err != nil {
+				u.logs.Error(ctx, "auth service", "password migration: hashing password", err, "user ID", user.ID)
+				return
+			}
+			if err := u.store.ReplacePassword(user.ID, user.Password, hash, salt); err != nil {
+				u.logs.Error(ctx, "auth service", "password migration: saving password", err, "user ID", user.ID)
+				return
+			}
+			migrated++
+		}
+	}
+
+	if migrated > 0 {
+		u.logs.Info(ctx, "auth service", "password migration", "hashed passwords", migrated)
+	}
+}
@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/jackgris/twitter-backend/auth/pkg/mailer"
+	"github.com/jackgris/twitter-backend/auth/pkg/password"
+	"github.com/jackgris/twitter-backend/auth/pkg/token"
+	"github.com/jackgris/twitter-backend/auth/pkg/validator"
+)
+
+// ForgotPassword emails a password reset link to the user with the given
+// email. It answers 202 Accepted before looking the user up, whether they
+// exist or not, so neither the answer nor its timing tells who has an
+// account. Too many requests from an IP address get 429 Too Many Requests,
+// emails past their limit are dropped.
+func (u UserHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	v := validator.New()
+	validator.ValidateEmail(v, input.Email)
+	if !v.Valid() {
+		http.Error(w, validationError(v), http.StatusBadRequest)
+		return
+	}
+
+	// Errors of the limiters are logged and let the request through, like
+	// the failed logins
+	taken, resetAt, err := u.config.ResetIPs.Take(r.Context(), "reset:ip:"+clientIP(r), 1)
+	if err != nil {
+		u.logs.Error(r.Context(), "auth service", "forgot password: taking from the limit", err)
+	} else if taken == 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(resetAt).Seconds())+1))
+		http.Error(w, "too many password resets, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	taken, _, err = u.config.ResetEmails.Take(r.Context(), "reset:email:"+strings.ToLower(input.Email), 1)
+	if err != nil {
+		u.logs.Error(r.Context(), "auth service", "forgot password: taking from the limit", err)
+	}
+	if err == nil && taken == 0 {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	go u.forgotPassword(context.WithoutCancel(r.Context()), input.Email)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// forgotPassword sends the reset email when a user has email. It runs after
+// ForgotPassword answered, its errors are only logged.
+func (u UserHandler) forgotPassword(ctx context.Context, email string) {
+	user, err := u.store.GetUserByLogin(email)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+	case err != nil:
+		u.logs.Error(ctx, "auth service", "forgot password: retrieving user", err)
+	default:
+		if err := u.sendPasswordReset(ctx, user); err != nil {
+			u.logs.Error(ctx, "auth service", "forgot password: sending reset email", err, "user ID", user.ID)
+		}
+	}
+}
+
+// ResetPassword sets a new password with the token of a reset email. It logs
+// the user out of every session.
+func (u UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if input.Token == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	v := validator.New()
+	validator.ValidatePassword(v, input.Password)
+	if !v.Valid() {
+		http.Error(w, validationError(v), http.StatusBadRequest)
+		return
+	}
+
+	hash, salt, err := password.Hash(input.Password)
+	if err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	userID, err := u.store.ResetPassword(token.HashOpaque(input.Token), hash, salt)
+	if err != nil {
+		switch {
+		case errors.Is(err, userdb.ErrResetTokenNotFound),
+			errors.Is(err, userdb.ErrResetTokenExpired),
+			errors.Is(err, userdb.ErrResetTokenUsed):
+			http.Error(w, "invalid or expired token", http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to reset password: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	u.logs.Info(r.Context(), "auth service", "password reset", "user ID", userID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u UserHandler) sendPasswordReset(ctx context.Context, user usermodel.User) error {
+	reset, err := token.NewOpaque()
+	if err != nil {
+		return err
+	}
+
+	err = u.store.CreatePasswordResetToken(usermodel.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: token.HashOpaque(reset),
+		ExpiresAt: time.Now().Add(u.config.ResetPasswordTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	return u.config.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: "Hi " + user.UserName + ",\n\n" +
+			"Open the link below to choose a new password:\n\n" +
+			u.config.ResetPasswordURL + url.QueryEscape(reset) + "\n\n" +
+			"The link expires in " + u.config.ResetPasswordTTL.String() + ". " +
+			"If you didn't ask for it you can ignore this email.\n",
+	})
+}
@@ -0,0 +1,100 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/internal/handler"
+	"github.com/jackgris/twitter-backend/auth/pkg/mailer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForgotPassword(t *testing.T) {
+	user := usermodel.User{ID: "csvqvamek44s73e2qf8g", UserName: "jackgris", Email: "jack@example.com"}
+
+	setup := func() (handler.UserHandler, *mailer.Memory, *sync.WaitGroup) {
+		mail := mailer.NewMemory()
+		// lookups waits for the requests that look the user up after
+		// answering, a lookup that wasn't expected panics
+		lookups := &sync.WaitGroup{}
+		store := &MockStore{
+			GetUserByLoginFunc: func(login string) (usermodel.User, error) {
+				defer lookups.Done()
+				if login != user.Email {
+					return usermodel.User{}, pgx.ErrNoRows
+				}
+				return user, nil
+			},
+			CreatePasswordResetTokenFunc: func(rt usermodel.PasswordResetToken) error {
+				return nil
+			},
+		}
+		h := newHandler(t, store, func(config *handler.Config) {
+			config.Mailer = mail
+			config.ResetPasswordTTL = time.Hour
+		})
+		return h, mail, lookups
+	}
+
+	forgot := func(h handler.UserHandler, email, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/password/forgot", strings.NewReader(`{"email":"`+email+`"}`))
+		req.Header.Set("X-Real-IP", ip)
+		rec := httptest.NewRecorder()
+
+		h.ForgotPassword(rec, req)
+		return rec
+	}
+
+	t.Run("Known and unknown emails get the same answer", func(t *testing.T) {
+		h, mail, lookups := setup()
+
+		lookups.Add(2)
+		known := forgot(h, user.Email, "10.0.0.1")
+		unknown := forgot(h, "nobody@example.com", "10.0.0.1")
+		lookups.Wait()
+
+		assert.Equal(t, http.StatusAccepted, known.Code)
+		assert.Equal(t, http.StatusAccepted, unknown.Code)
+		assert.Eventually(t, func() bool { return len(mail.Messages()) == 1 }, time.Second, 10*time.Millisecond)
+		assert.Equal(t, user.Email, mail.Messages()[0].To)
+	})
+
+	t.Run("Emails past their limit are dropped", func(t *testing.T) {
+		h, mail, lookups := setup()
+
+		lookups.Add(2)
+		codes := []int{}
+		for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+			codes = append(codes, forgot(h, user.Email, ip).Code)
+		}
+		lookups.Wait()
+
+		assert.Equal(t, []int{http.StatusAccepted, http.StatusAccepted, http.StatusAccepted}, codes)
+		assert.Eventually(t, func() bool { return len(mail.Messages()) == 2 }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Too many requests from an IP", func(t *testing.T) {
+		h, _, lookups := setup()
+
+		lookups.Add(3)
+		for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+			assert.Equal(t, http.StatusAccepted, forgot(h, email, "10.0.0.1").Code)
+		}
+		lookups.Wait()
+
+		rec := forgot(h, "d@example.com", "10.0.0.1")
+
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+		lookups.Add(1)
+		assert.Equal(t, http.StatusAccepted, forgot(h, "d@example.com", "10.0.0.2").Code)
+		lookups.Wait()
+	})
+}
@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/jackgris/twitter-backend/auth/pkg/uuid"
+)
+
+// Block blocks the user in the body. Follows between both users are removed
+// and the other services are told through a user_blocked event.
+func (u UserHandler) Block(w http.ResponseWriter, r *http.Request) {
+	rel, ok := relationshipInput(w, r)
+	if !ok {
+		return
+	}
+
+	rel, created, err := u.store.Block(rel)
+	if err != nil {
+		relationshipError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		u.msgBroker.PublishMessages(relationshipsTopic, NewRelationship("user_blocked", rel.UserID, rel.TargetID))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(RelationshipToJSON(rel))
+}
+
+func (u UserHandler) Unblock(w http.ResponseWriter, r *http.Request) {
+	rel, ok := relationshipInput(w, r)
+	if !ok {
+		return
+	}
+
+	if err := u.store.Unblock(rel); err != nil {
+		relationshipError(w, err)
+		return
+	}
+
+	u.msgBroker.PublishMessages(relationshipsTopic, NewRelationship("user_unblocked", rel.UserID, rel.TargetID))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Mute hides the tweets of the user in the body from the timeline of the
+// caller, the muted user isn't told.
+func (u UserHandler) Mute(w http.ResponseWriter, r *http.Request) {
+	rel, ok := relationshipInput(w, r)
+	if !ok {
+		return
+	}
+
+	rel, created, err := u.store.Mute(rel)
+	if err != nil {
+		relationshipError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		u.msgBroker.PublishMessages(relationshipsTopic, NewRelationship("user_muted", rel.UserID, rel.TargetID))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(RelationshipToJSON(rel))
+}
+
+func (u UserHandler) Unmute(w http.ResponseWriter, r *http.Request) {
+	rel, ok := relationshipInput(w, r)
+	if !ok {
+		return
+	}
+
+	if err := u.store.Unmute(rel); err != nil {
+		relationshipError(w, err)
+		return
+	}
+
+	u.msgBroker.PublishMessages(relationshipsTopic, NewRelationship("user_unmuted", rel.UserID, rel.TargetID))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetBlocked lists the users blocked by the caller, paginated like
+// GetFollowers.
+func (u UserHandler) GetBlocked(w http.ResponseWriter, r *http.Request) {
+	u.listOwn(w, r, u.store.GetBlocked)
+}
+
+// GetMuted lists the users muted by the caller, paginated like GetFollowers.
+func (u UserHandler) GetMuted(w http.ResponseWriter, r *http.Request) {
+	u.listOwn(w, r, u.store.GetMuted)
+}
+
+// listOwn lists users like listFollows, but for the caller only. Who someone
+// blocks or mutes is private.
+func (u UserHandler) listOwn(w http.ResponseWriter, r *http.Request, list func(userID, cursor string, limit int) (usermodel.UserPage, error)) {
+	userID, ok := actingUser(w, r, "")
+	if !ok {
+		return
+	}
+
+	r.SetPathValue("id", userID)
+	u.listFollows(w, r, list)
+}
+
+func relationshipInput(w http.ResponseWriter, r *http.Request) (usermodel.Relationship, bool) {
+	var input struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return usermodel.Relationship{}, false
+	}
+
+	userID, ok := actingUser(w, r, "")
+	if !ok {
+		return usermodel.Relationship{}, false
+	}
+
+	if input.UserID == "" {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return usermodel.Relationship{}, false
+	}
+
+	if ok := uuid.IsValid(input.UserID); !ok {
+		http.Error(w, "user id invalid", http.StatusBadRequest)
+		return usermodel.Relationship{}, false
+	}
+
+	if input.UserID == userID {
+		http.Error(w, userdb.ErrSelfRelation.Error(), http.StatusBadRequest)
+		return usermodel.Relationship{}, false
+	}
+
+	return usermodel.Relationship{UserID: userID, TargetID: input.UserID}, true
+}
+
+func relationshipError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, userdb.ErrUserNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+	case errors.Is(err, userdb.ErrBlockNotFound), errors.Is(err, userdb.ErrMuteNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, userdb.ErrSelfRelation):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// maxRelationshipTargets is how many users GetRelationships answers for in
+// one call.
+const maxRelationshipTargets = 100
+
+// GetRelationships tells how the caller relates to up to 100 users, given as
+// comma separated IDs in targets, so clients can show "Follows you" or
+// "Requested" without downloading follower lists. source defaults to the
+// caller and can't be anybody else, mutes and blocks are private.
+func (u UserHandler) GetRelationships(w http.ResponseWriter, r *http.Request) {
+	source, ok := actingUser(w, r, r.URL.Query().Get("source"))
+	if !ok {
+		return
+	}
+
+	var targets []string
+	seen := make(map[string]bool)
+	for _, id := range strings.Split(r.URL.Query().Get("targets"), ",") {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		if ok := uuid.IsValid(id); !ok {
+			http.Error(w, fmt.Sprintf("target id %q invalid", id), http.StatusBadRequest)
+			return
+		}
+		seen[id] = true
+		targets = append(targets, id)
+	}
+
+	if len(targets) == 0 {
+		http.Error(w, "targets is required", http.StatusBadRequest)
+		return
+	}
+	if len(targets) > maxRelationshipTargets {
+		http.Error(w, fmt.Sprintf("targets can have a maximum of %d ids", maxRelationshipTargets), http.StatusBadRequest)
+		return
+	}
+
+	statuses, err := u.store.GetRelationships(source, targets)
+	if err != nil {
+		u.logs.Error(r.Context(), "auth service", "listing relationships", err, "user ID", source)
+		http.Error(w, "Failed to retrieve relationships", http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Source        string               `json:"source"`
+		Relationships []RelationshipStatus `json:"relationships"`
+	}{
+		Source:        source,
+		Relationships: make([]RelationshipStatus, 0, len(statuses)),
+	}
+	for _, status := range statuses {
+		response.Relationships = append(response.Relationships, RelationshipStatusToJSON(status))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
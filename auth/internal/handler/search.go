@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/jackgris/twitter-backend/auth/pkg/middleware"
+)
+
+const (
+	maxSearchLength        = 50
+	defaultTypeaheadLength = 5
+	maxTypeaheadLength     = 10
+)
+
+// SearchUsers finds users by username, matching prefixes and similar names.
+// With typeahead=true only a handful of prefix matches are returned, fast
+// enough to search while the user types. Otherwise the results are paginated
+// like the followers listings.
+func (u UserHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(q) > maxSearchLength {
+		http.Error(w, fmt.Sprintf("q must have a maximum of %d characters", maxSearchLength), http.StatusBadRequest)
+		return
+	}
+
+	// Anonymous users can search too, they just don't get the users they
+	// follow ranked first
+	var callerID string
+	if claims, ok := middleware.ClaimsFromContext(r.Context()); ok {
+		callerID = claims.UserID
+	}
+
+	var page usermodel.UserPage
+	var err error
+	if r.URL.Query().Get("typeahead") == "true" {
+		limit := defaultTypeaheadLength
+		if l := r.URL.Query().Get("limit"); l != "" {
+			limit, err = strconv.Atoi(l)
+			if err != nil || limit < 1 || limit > maxTypeaheadLength {
+				http.Error(w, fmt.Sprintf("limit must be a number between 1 and %d", maxTypeaheadLength), http.StatusBadRequest)
+				return
+			}
+		}
+
+		page.Users, err = u.store.TypeaheadUsers(q, callerID, limit)
+	} else {
+		limit, sizeErr := pageSize(r.URL.Query().Get("limit"))
+		if sizeErr != nil {
+			http.Error(w, sizeErr.Error(), http.StatusBadRequest)
+			return
+		}
+
+		page, err = u.store.SearchUsers(q, callerID, r.URL.Query().Get("cursor"), limit)
+	}
+	if err != nil {
+		if errors.Is(err, userdb.ErrInvalidCursor) {
+			http.Error(w, "cursor invalid", http.StatusBadRequest)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to search users: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(UserPageToJSON(page))
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/jackgris/twitter-backend/auth/pkg/uuid"
+)
+
+// GetSessions lists where the caller is logged in.
+func (u UserHandler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := actingUser(w, r, "")
+	if !ok {
+		return
+	}
+
+	u.writeSessions(w, r, userID)
+}
+
+// GetUserSessions lists where a user is logged in, for the support staff.
+func (u UserHandler) GetUserSessions(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("id")
+	if ok := uuid.IsValid(userID); !ok {
+		http.Error(w, "user id invalid", http.StatusBadRequest)
+		return
+	}
+
+	u.writeSessions(w, r, userID)
+}
+
+func (u UserHandler) writeSessions(w http.ResponseWriter, r *http.Request, userID string) {
+	sessions, err := u.store.ListSessions(userID)
+	if err != nil {
+		u.logs.Error(r.Context(), "auth service", "listing sessions", err, "user ID", userID)
+		http.Error(w, "Failed to retrieve sessions", http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Sessions []Session `json:"sessions"`
+	}{
+		Sessions: make([]Session, 0, len(sessions)),
+	}
+	for _, session := range sessions {
+		response.Sessions = append(response.Sessions, SessionToJSON(session))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// RevokeSession logs the caller out of one of their sessions. Its access
+// token keeps working until it expires, but it can't be refreshed.
+func (u UserHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := actingUser(w, r, "")
+	if !ok {
+		return
+	}
+
+	sessionID := r.PathValue("id")
+	if ok := uuid.IsValid(sessionID); !ok {
+		http.Error(w, "session id invalid", http.StatusBadRequest)
+		return
+	}
+
+	err := u.store.RevokeSession(userID, sessionID)
+	if err != nil {
+		if errors.Is(err, userdb.ErrSessionNotFound) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Can't revoke session", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeAllSessions logs the caller out everywhere, including the session of
+// the request.
+func (u UserHandler) RevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := actingUser(w, r, "")
+	if !ok {
+		return
+	}
+
+	if err := u.store.RevokeAllSessions(userID); err != nil {
+		http.Error(w, "Can't revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	u.logs.Info(r.Context(), "auth service", "logged out everywhere", "user ID", userID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/jackgris/twitter-backend/auth/pkg/uuid"
+)
+
+const (
+	defaultSuggestions = 10
+	// suggestionsPerUser is how many suggestions are precomputed for each
+	// user, and so the most that can be asked for
+	suggestionsPerUser = 50
+	// suggestionsBatch is how many users are refreshed in each transaction
+	suggestionsBatch = 500
+)
+
+// GetSuggestions returns users the caller may want to follow, ranked by how
+// many users they follow follow them, the followers they share and their
+// popularity.
+func (u UserHandler) GetSuggestions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := actingUser(w, r, "")
+	if !ok {
+		return
+	}
+
+	limit := defaultSuggestions
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > suggestionsPerUser {
+			http.Error(w, fmt.Sprintf("limit must be a number between 1 and %d", suggestionsPerUser), http.StatusBadRequest)
+			return
+		}
+	}
+
+	suggestions, err := u.store.GetSuggestions(userID, limit)
+	if err != nil {
+		u.logs.Error(r.Context(), "auth service", "listing suggestions", err, "user ID", userID)
+		http.Error(w, "Failed to retrieve suggestions", http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Suggestions []Suggestion `json:"suggestions"`
+	}{
+		Suggestions: make([]Suggestion, 0, len(suggestions)),
+	}
+	for _, suggestion := range suggestions {
+		response.Suggestions = append(response.Suggestions, SuggestionToJSON(suggestion))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// DismissSuggestion stops suggesting a user to the caller.
+func (u UserHandler) DismissSuggestion(w http.ResponseWriter, r *http.Request) {
+	userID, ok := actingUser(w, r, "")
+	if !ok {
+		return
+	}
+
+	candidateID := r.PathValue("id")
+	if ok := uuid.IsValid(candidateID); !ok {
+		http.Error(w, "user id invalid", http.StatusBadRequest)
+		return
+	}
+
+	err := u.store.DismissSuggestion(userID, candidateID)
+	if err != nil {
+		if errors.Is(err, userdb.ErrUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Can't dismiss suggestion", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RefreshSuggestions recomputes the suggestions of every user right away and
+// then every interval, until the process ends.
+func (u *UserHandler) RefreshSuggestions(interval time.Duration) {
+	ctx := context.Background()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		saved, err := u.store.RefreshSuggestions(suggestionsPerUser, suggestionsBatch)
+		if err != nil {
+			u.logs.Error(ctx, "auth service", "suggestions: refreshing", err)
+		} else {
+			u.logs.Info(ctx, "auth service", "suggestions refreshed", "suggestions", saved, "took", time.Since(start).String())
+		}
+
+		<-ticker.C
+	}
+}
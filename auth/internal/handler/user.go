@@ -2,61 +2,70 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"unicode/utf8"
+	"strconv"
+	"strings"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/jackgris/twitter-backend/auth/pkg/middleware"
+	"github.com/jackgris/twitter-backend/auth/pkg/password"
 	"github.com/jackgris/twitter-backend/auth/pkg/uuid"
 	"github.com/jackgris/twitter-backend/auth/pkg/validator"
 )
 
 func (u UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		UserName string `json:"user_name"`
-		Password string `json:"password"`
-		Email    string `json:"email"`
+		UserName    string `json:"user_name"`
+		Password    string `json:"password"`
+		Email       string `json:"email"`
+		DisplayName string `json:"display_name"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
 		return
 	}
 
-	if input.Password == "" {
-		http.Error(w, "user_name and password are required", http.StatusBadRequest)
-		return
-	}
-
-	if utf8.RuneCountInString(input.Password) < 4 {
-		http.Error(w, "password size should have a minimun of 4 characters", http.StatusBadRequest)
-		return
-	}
-
 	v := validator.New()
 	validator.ValidateEmail(v, input.Email)
 	validator.ValidateName(v, input.UserName)
+	validator.ValidatePassword(v, input.Password)
+	validator.ValidateDisplayName(v, input.DisplayName)
 	if !v.Valid() {
-		err := ""
-		for key, value := range v.Errors {
-			err += key + " " + value + " "
-		}
+		http.Error(w, validationError(v), http.StatusBadRequest)
+		return
+	}
 
-		http.Error(w, err, http.StatusBadRequest)
+	hash, salt, err := password.Hash(input.Password)
+	if err != nil {
+		http.Error(w, "Can't hash user password", http.StatusInternalServerError)
 		return
 	}
 
 	user := usermodel.User{
-		UserName: input.UserName,
-		Password: input.Password,
-		Email:    input.Email,
+		UserName:    input.UserName,
+		Password:    hash,
+		Salt:        salt,
+		Email:       input.Email,
+		DisplayName: input.DisplayName,
 	}
-	user, err := u.store.Create(user)
+	user, err = u.store.Create(user)
 	if err != nil {
+		if errors.Is(err, userdb.ErrUsernameTaken) || errors.Is(err, userdb.ErrEmailTaken) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		http.Error(w, "Can't save user in database", http.StatusBadRequest)
 		return
 	}
 
+	if err := u.sendVerificationEmail(r.Context(), user); err != nil {
+		u.logs.Error(r.Context(), "auth service", "sending verification email", err, "user ID", user.ID)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	_ = json.NewEncoder(w).Encode(UserToJSON(user))
@@ -64,10 +73,8 @@ func (u UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func (u UserHandler) Delete(w http.ResponseWriter, r *http.Request) {
-	userID := r.PathValue("id")
-
-	if ok := uuid.IsValid(userID); !ok {
-		http.Error(w, "user id invalid", http.StatusBadRequest)
+	userID, ok := actingUser(w, r, r.PathValue("id"))
+	if !ok {
 		return
 	}
 
@@ -77,6 +84,8 @@ func (u UserHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	u.msgBroker.PublishMessages(usersTopic, NewUserDeleted(userID))
+
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -93,8 +102,13 @@ func (u UserHandler) Follow(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if input.UserID == "" || input.FollowerID == "" {
-		http.Error(w, "user_id and follower_id are required", http.StatusBadRequest)
+	followerID, ok := actingUser(w, r, input.FollowerID)
+	if !ok {
+		return
+	}
+
+	if input.UserID == "" {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
 		return
 	}
 
@@ -103,26 +117,71 @@ func (u UserHandler) Follow(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if ok := uuid.IsValid(input.FollowerID); !ok {
-		http.Error(w, "follower id invalid", http.StatusBadRequest)
+	if input.UserID == followerID {
+		http.Error(w, userdb.ErrSelfFollow.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := u.store.GetUserbyID(input.UserID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to retrieve user: %v", err), http.StatusInternalServerError)
+		}
 		return
 	}
 
 	follow := usermodel.UserFollowers{
 		UserID:     input.UserID,
-		FollowerID: input.FollowerID,
+		FollowerID: followerID,
+	}
+
+	// Protected users approve their followers, the follow waits as a request
+	if user.Protected {
+		request, _, err := u.store.RequestFollow(follow)
+		if err == nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			_ = json.NewEncoder(w).Encode(FollowRequestToJSON(request))
+			return
+		}
+		if !errors.Is(err, userdb.ErrAlreadyFollowing) {
+			followError(w, err)
+			return
+		}
 	}
-	err = u.store.Follow(follow)
+
+	follow, created, err := u.store.Follow(follow)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		followError(w, err)
 		return
 	}
 
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		u.msgBroker.PublishMessages(relationshipsTopic, NewRelationship("user_followed", follow.FollowerID, follow.UserID))
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(FollowerToJSON(follow))
 }
 
+func followError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, userdb.ErrUserNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+	case errors.Is(err, userdb.ErrSelfFollow):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, userdb.ErrBlocked):
+		http.Error(w, "you can't follow this user", http.StatusForbidden)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
 func (u UserHandler) Unfollow(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		UserID     string `json:"user_id"`
@@ -135,31 +194,37 @@ func (u UserHandler) Unfollow(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if input.UserID == "" || input.FollowerID == "" {
-		http.Error(w, "user_id and follower_id are required", http.StatusBadRequest)
+	followerID, ok := actingUser(w, r, input.FollowerID)
+	if !ok {
 		return
 	}
 
-	if ok := uuid.IsValid(input.UserID); !ok {
-		http.Error(w, "user id invalid", http.StatusBadRequest)
+	if input.UserID == "" {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
 		return
 	}
 
-	if ok := uuid.IsValid(input.FollowerID); !ok {
-		http.Error(w, "follower id invalid", http.StatusBadRequest)
+	if ok := uuid.IsValid(input.UserID); !ok {
+		http.Error(w, "user id invalid", http.StatusBadRequest)
 		return
 	}
 
 	follow := usermodel.UserFollowers{
 		UserID:     input.UserID,
-		FollowerID: input.FollowerID,
+		FollowerID: followerID,
 	}
 	err = u.store.Unfollow(follow)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if errors.Is(err, userdb.ErrFollowNotFound) {
+			http.Error(w, "Follow not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 
+	u.msgBroker.PublishMessages(relationshipsTopic, NewRelationship("user_unfollowed", follow.FollowerID, follow.UserID))
+
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write([]byte("Unfollow successful"))
 }
@@ -186,8 +251,9 @@ func (u UserHandler) GetUserbyID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(user))
+	w.WriteHeader(http.StatusOK)
 	_ = json.NewEncoder(w).Encode(UserToJSON(user))
 }
 
@@ -198,9 +264,16 @@ func (u UserHandler) GetUserbyUsername(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A username changed recently still finds its user, telling the client
+	// where it was redirected from
+	var redirectedFrom string
 	user, err := u.store.GetUserbyUsername(name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		user, err = u.store.GetUserByOldUsername(name)
+		redirectedFrom = name
+	}
 	if err != nil {
-		if err == pgx.ErrNoRows {
+		if errors.Is(err, pgx.ErrNoRows) {
 			http.Error(w, "User not found", http.StatusNotFound)
 		} else {
 			http.Error(w, fmt.Sprintf("Failed to retrieve user: %v", err), http.StatusInternalServerError)
@@ -208,60 +281,250 @@ func (u UserHandler) GetUserbyUsername(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	v := validator.New()
-	validator.ValidateName(v, name)
-	if !v.Valid() {
-		err := ""
-		for key, value := range v.Errors {
-			err += key + " " + value + " "
-		}
+	response := UserToJSON(user)
+	response.RedirectedFrom = redirectedFrom
 
-		http.Error(w, err, http.StatusBadRequest)
-		return
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(user))
+	if redirectedFrom != "" {
+		w.Header().Set("Content-Location", "/name/"+user.UserName)
 	}
-
 	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(UserToJSON(user))
+	_ = json.NewEncoder(w).Encode(response)
 }
 
+// Update applies a JSON Merge Patch (RFC 7396) to the profile of the user in
+// the access token. Sending the version from the ETag in If-Match makes the
+// update fail with 412 if the profile changed in the meantime. Changing the
+// email or password needs current_password, and a new password logs out every
+// other session.
 func (u UserHandler) Update(w http.ResponseWriter, r *http.Request) {
-
-	var input map[string]interface{}
+	var input map[string]json.RawMessage
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
 		return
 	}
 
-	userID, ok := input["id"].(string)
-	if !ok || userID == "" {
-		http.Error(w, "id parameter is required", http.StatusBadRequest)
+	var id string
+	if raw, ok := input["id"]; ok {
+		if err := json.Unmarshal(raw, &id); err != nil {
+			http.Error(w, "id must be a string", http.StatusBadRequest)
+			return
+		}
+	}
+	userID, ok := actingUser(w, r, id)
+	if !ok {
+		return
+	}
+
+	version, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if ok := uuid.IsValid(userID); !ok {
-		http.Error(w, "user id invalid", http.StatusBadRequest)
+	// API keys can't change the credentials of their bot, with them the bot
+	// could log in and get around the scopes
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+	apiKey := claims.APIKeyID != ""
+
+	var patch usermodel.UserPatch
+	var currentPassword string
+	v := validator.New()
+	for field, raw := range input {
+		if field == "protected" {
+			var protected *bool
+			if err := json.Unmarshal(raw, &protected); err != nil {
+				http.Error(w, field+" must be a boolean", http.StatusBadRequest)
+				return
+			}
+			v.Check(protected != nil, field, "can't be removed")
+			patch.Protected = protected
+			continue
+		}
+
+		var value *string
+		if field != "id" {
+			if err := json.Unmarshal(raw, &value); err != nil {
+				http.Error(w, field+" must be a string", http.StatusBadRequest)
+				return
+			}
+		}
+
+		switch field {
+		case "id":
+		case "current_password":
+			currentPassword = *orEmpty(value)
+		case "username":
+			// Renames keep the old username, see ChangeUsername
+			v.AddError(field, "can't be updated here, use PUT /username")
+		case "email":
+			v.Check(!apiKey, field, "can't be updated with an API key")
+			v.Check(value != nil, field, "can't be removed")
+			if value != nil {
+				validator.ValidateEmail(v, *value)
+			}
+			patch.Email = value
+		case "password":
+			v.Check(!apiKey, field, "can't be updated with an API key")
+			v.Check(value != nil, field, "can't be removed")
+			if value != nil {
+				validator.ValidatePassword(v, *value)
+			}
+			patch.Password = value
+		// The profile fields are optional, null removes them
+		case "display_name":
+			patch.DisplayName = orEmpty(value)
+			validator.ValidateDisplayName(v, *patch.DisplayName)
+		case "bio":
+			patch.Bio = orEmpty(value)
+			validator.ValidateText(v, field, *patch.Bio, 160)
+		case "location":
+			patch.Location = orEmpty(value)
+			validator.ValidateText(v, field, *patch.Location, 30)
+		case "avatar_url":
+			patch.AvatarURL = orEmpty(value)
+			validator.ValidateURL(v, field, *patch.AvatarURL)
+		case "website":
+			patch.Website = orEmpty(value)
+			validator.ValidateURL(v, field, *patch.Website)
+		default:
+			v.AddError(field, "can't be updated")
+		}
+	}
+	// The credentials need the current password too, a stolen access token
+	// mustn't be enough to take over the account
+	credentials := patch.Email != nil || patch.Password != nil
+	v.Check(!credentials || currentPassword != "", "current_password", "must be provided to change the email or password")
+	if !v.Valid() {
+		http.Error(w, validationError(v), http.StatusBadRequest)
 		return
 	}
-	// TODO
-	user := usermodel.User{
-		// UserName       string
-		// Email          string
-		// Password       string
-		// FollowerCount  int
-		// FollowingCount int
-		// Salt           string
-		// Token          string
-		// DateCreated    time.Time
-		// EncodedDate    string
-	}
-	updatedUser, err := u.store.Update(user)
+
+	if patch == (usermodel.UserPatch{}) {
+		http.Error(w, "nothing to update", http.StatusBadRequest)
+		return
+	}
+
+	if credentials && !u.confirmPassword(w, r, userID, currentPassword) {
+		return
+	}
+
+	if patch.Password != nil {
+		hash, salt, err := password.Hash(*patch.Password)
+		if err != nil {
+			http.Error(w, "Can't hash user password", http.StatusInternalServerError)
+			return
+		}
+		patch.Password = &hash
+		patch.Salt = &salt
+	}
+
+	updatedUser, approved, err := u.store.Update(userID, patch, version)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to update user: %v", err), http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, userdb.ErrVersionConflict):
+			http.Error(w, "user was modified, fetch it again and retry", http.StatusPreconditionFailed)
+		case errors.Is(err, userdb.ErrUsernameTaken), errors.Is(err, userdb.ErrEmailTaken):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, pgx.ErrNoRows):
+			http.Error(w, "User not found", http.StatusNotFound)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to update user: %v", err), http.StatusInternalServerError)
+		}
 		return
 	}
 
+	// Whoever knew the old password is logged out, except from this session
+	if patch.Password != nil {
+		if err := u.store.RevokeOtherSessions(updatedUser.ID, claims.SessionID); err != nil {
+			u.logs.Error(r.Context(), "auth service", "revoking other sessions", err, "user ID", updatedUser.ID)
+		}
+	}
+
+	if patch.Email != nil {
+		if err := u.sendVerificationEmail(r.Context(), updatedUser); err != nil {
+			u.logs.Error(r.Context(), "auth service", "sending verification email", err, "user ID", updatedUser.ID)
+		}
+	}
+
+	if patch.Protected != nil {
+		u.msgBroker.PublishMessages(usersTopic, NewUserProtection(updatedUser.ID, updatedUser.Protected))
+	}
+	// Going public approves the pending follow requests
+	for _, follow := range approved {
+		u.msgBroker.PublishMessages(relationshipsTopic, NewRelationship("user_followed", follow.FollowerID, follow.UserID))
+	}
+
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(updatedUser))
 	w.WriteHeader(http.StatusOK)
-	_ = json.NewEncoder(w).Encode(updatedUser)
+	_ = json.NewEncoder(w).Encode(UserToJSON(updatedUser))
+}
+
+// confirmPassword checks current is the password of the user, and answers
+// 403 Forbidden when it isn't. Wrong passwords count as failed logins, so
+// they can't be guessed here either.
+func (u UserHandler) confirmPassword(w http.ResponseWriter, r *http.Request, userID, current string) bool {
+	user, err := u.store.GetUserbyID(userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return false
+		}
+		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		return false
+	}
+
+	keys := userKeys(r, user.ID)
+	if wait := u.loginWait(r.Context(), keys); wait > 0 {
+		tooManyAttempts(w, wait)
+		return false
+	}
+
+	ok, _, err := password.Verify(current, user.Password)
+	if err != nil || !ok {
+		u.recordFailure(r.Context(), keys)
+		http.Error(w, "current_password is wrong", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// orEmpty returns value, or an empty string when value is nil.
+func orEmpty(value *string) *string {
+	if value == nil {
+		return new(string)
+	}
+	return value
+}
+
+func validationError(v *validator.Validator) string {
+	err := ""
+	for key, value := range v.Errors {
+		err += key + " " + value + " "
+	}
+	return err
+}
+
+func etag(user usermodel.User) string {
+	return `"` + strconv.Itoa(user.Version) + `"`
+}
+
+// parseIfMatch returns the user version in an If-Match header, or 0 when the
+// header is empty or "*" and any version can be updated.
+func parseIfMatch(header string) (int, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+
+	header = strings.TrimPrefix(header, "W/")
+	version, err := strconv.Atoi(strings.Trim(header, `"`))
+	if err != nil || version < 1 {
+		return 0, errors.New("If-Match must be the ETag of the user")
+	}
+
+	return version, nil
 }
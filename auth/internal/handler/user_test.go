@@ -0,0 +1,97 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/jackgris/twitter-backend/auth/pkg/password"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdate(t *testing.T) {
+	const userID = "csvqvamek44s73e2qf8g"
+
+	hash, salt, err := password.Hash("Old-passw0rd!")
+	assert.NoError(t, err)
+	user := usermodel.User{ID: userID, UserName: "jackgris", Email: "old@example.com", Password: hash, Salt: salt}
+
+	tests := []struct {
+		name          string
+		body          string
+		updateErr     error
+		expectedCode  int
+		expectUpdate  bool
+		expectRevoked bool
+	}{
+		{name: "Profile without password", body: `{"bio":"Go developer"}`, expectedCode: http.StatusOK, expectUpdate: true},
+		{name: "Email without current password", body: `{"email":"new@example.com"}`, expectedCode: http.StatusBadRequest},
+		{name: "Password without current password", body: `{"password":"New-passw0rd!"}`, expectedCode: http.StatusBadRequest},
+		{name: "Wrong current password", body: `{"email":"new@example.com","current_password":"wrong"}`, expectedCode: http.StatusForbidden},
+		{name: "Email with current password", body: `{"email":"new@example.com","current_password":"Old-passw0rd!"}`, expectedCode: http.StatusOK, expectUpdate: true},
+		{name: "Password logs out the other sessions", body: `{"password":"New-passw0rd!","current_password":"Old-passw0rd!"}`, expectedCode: http.StatusOK, expectUpdate: true, expectRevoked: true},
+		{name: "Email taken", body: `{"email":"taken@example.com","current_password":"Old-passw0rd!"}`, updateErr: userdb.ErrEmailTaken, expectedCode: http.StatusConflict, expectUpdate: true},
+		{name: "Version conflict", body: `{"bio":"Go developer"}`, updateErr: userdb.ErrVersionConflict, expectedCode: http.StatusPreconditionFailed, expectUpdate: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			updated, revoked := false, ""
+			store := &MockStore{
+				GetUserbyIDFunc: func(id string) (usermodel.User, error) {
+					return user, nil
+				},
+				UpdateFunc: func(id string, patch usermodel.UserPatch, version int) (usermodel.User, []usermodel.UserFollowers, error) {
+					updated = true
+					if test.updateErr != nil {
+						return usermodel.User{}, nil, test.updateErr
+					}
+					return user, nil, nil
+				},
+				RevokeOtherSessionsFunc: func(userID, sessionID string) error {
+					revoked = sessionID
+					return nil
+				},
+			}
+			h := newHandler(t, store)
+
+			req := httptest.NewRequest(http.MethodPatch, "/update", strings.NewReader(test.body))
+			req = authorized(req, userID, "family-1")
+			rec := httptest.NewRecorder()
+
+			h.Update(rec, req)
+
+			assert.Equal(t, test.expectedCode, rec.Code, rec.Body.String())
+			assert.Equal(t, test.expectUpdate, updated)
+			if test.expectRevoked {
+				assert.Equal(t, "family-1", revoked, "the session of the request is kept")
+			} else {
+				assert.Empty(t, revoked)
+			}
+		})
+	}
+
+	t.Run("Wrong current passwords count as failed logins", func(t *testing.T) {
+		store := &MockStore{
+			GetUserbyIDFunc: func(id string) (usermodel.User, error) {
+				return user, nil
+			},
+		}
+		h := newHandler(t, store)
+
+		codes := []int{}
+		for range 5 {
+			req := httptest.NewRequest(http.MethodPatch, "/update", strings.NewReader(`{"password":"New-passw0rd!","current_password":"wrong"}`))
+			req = authorized(req, userID, "family-1")
+			rec := httptest.NewRecorder()
+
+			h.Update(rec, req)
+			codes = append(codes, rec.Code)
+		}
+
+		assert.Equal(t, []int{http.StatusForbidden, http.StatusForbidden, http.StatusForbidden, http.StatusForbidden, http.StatusTooManyRequests}, codes)
+	})
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/jackgris/twitter-backend/auth/pkg/validator"
+)
+
+// ChangeUsername renames the caller. The old username keeps finding them in
+// GET /name/{name} and nobody else can take it for UsernameReservation, and
+// the next change has to wait UsernameCooldown. The access token keeps the
+// old username until it is refreshed.
+func (u UserHandler) ChangeUsername(w http.ResponseWriter, r *http.Request) {
+	userID, ok := actingUser(w, r, "")
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	v := validator.New()
+	validator.ValidateName(v, input.Username)
+	if !v.Valid() {
+		http.Error(w, validationError(v), http.StatusBadRequest)
+		return
+	}
+
+	change, err := u.store.ChangeUsername(userID, input.Username, u.config.UsernameCooldown, u.config.UsernameReservation)
+	if err != nil {
+		switch {
+		case errors.Is(err, userdb.ErrUsernameCooldown):
+			seconds := int(time.Until(change.NextChangeAt).Seconds()) + 1
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			http.Error(w, "username changed too recently, try again later", http.StatusTooManyRequests)
+		case errors.Is(err, userdb.ErrUsernameUnchanged):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, userdb.ErrUsernameTaken):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, userdb.ErrUserNotFound):
+			http.Error(w, "User not found", http.StatusNotFound)
+		default:
+			u.logs.Error(r.Context(), "auth service", "changing username", err, "user ID", userID)
+			http.Error(w, "Can't change username", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	u.msgBroker.PublishMessages(usersTopic, NewUserRenamed(userID, change.OldUsername, change.NewUsername))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(UsernameChangeToJSON(change))
+}
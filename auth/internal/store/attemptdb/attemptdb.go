@@ -0,0 +1,91 @@
+// Package attemptdb keeps the failed login attempts in Postgres, so every
+// replica of the auth service sees the same counters.
+package attemptdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackgris/twitter-backend/auth/internal/store"
+	"github.com/jackgris/twitter-backend/auth/pkg/attempts"
+)
+
+// Store is an attempts.Tracker. Trackers with different policies can share
+// the table as long as their keys don't collide.
+type Store struct {
+	db     store.PgxIface
+	policy attempts.Policy
+}
+
+var _ attempts.Tracker = (*Store)(nil)
+
+func NewStore(db store.PgxIface, policy attempts.Policy) *Store {
+	return &Store{
+		db:     db,
+		policy: policy,
+	}
+}
+
+func (s *Store) Wait(ctx context.Context, key string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                SELECT failures, last_failure_at FROM login_attempts WHERE key = $1
+        `
+	var failures int
+	var lastFailure time.Time
+	err := s.db.QueryRow(ctx, query, key).Scan(&failures, &lastFailure)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to fetch login attempts: %w", err)
+	}
+
+	now := time.Now()
+	if s.policy.Expired(lastFailure, now) {
+		return 0, nil
+	}
+
+	return s.policy.Wait(failures, lastFailure, now), nil
+}
+
+func (s *Store) Fail(ctx context.Context, key string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*400)
+	defer cancel()
+
+	// Counting happens in a single statement so concurrent failures on
+	// different replicas are all counted
+	now := time.Now()
+	query := `
+                INSERT INTO login_attempts (key, failures, last_failure_at)
+                VALUES ($1, 1, $2)
+                ON CONFLICT (key) DO UPDATE SET
+                    failures = CASE WHEN login_attempts.last_failure_at < $3 THEN 1 ELSE login_attempts.failures + 1 END,
+                    last_failure_at = $2
+                RETURNING failures
+        `
+	var failures int
+	err := s.db.QueryRow(ctx, query, key, now, now.Add(-s.policy.Window)).Scan(&failures)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record login attempt: %w", err)
+	}
+
+	return s.policy.Delay(failures), nil
+}
+
+func (s *Store) Reset(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*400)
+	defer cancel()
+
+	_, err := s.db.Exec(ctx, `DELETE FROM login_attempts WHERE key = $1`, key)
+	if err != nil {
+		return fmt.Errorf("failed to reset login attempts: %w", err)
+	}
+
+	return nil
+}
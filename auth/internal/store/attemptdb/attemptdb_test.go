@@ -0,0 +1,76 @@
+package attemptdb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackgris/twitter-backend/auth/internal/store/attemptdb"
+	"github.com/jackgris/twitter-backend/auth/pkg/attempts"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var policy = attempts.Policy{
+	Free:            3,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutAfter:    10,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+func TestWait(t *testing.T) {
+	columns := []string{"failures", "last_failure_at"}
+
+	t.Run("Locked out", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectQuery("SELECT failures, last_failure_at").
+			WithArgs("account:jack").
+			WillReturnRows(pgxmock.NewRows(columns).AddRow(10, time.Now()))
+
+		store := attemptdb.NewStore(mock, policy)
+		wait, err := store.Wait(context.Background(), "account:jack")
+
+		assert.NoError(t, err)
+		assert.InDelta(t, 15*time.Minute, wait, float64(time.Second))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Forgotten failures", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectQuery("SELECT failures, last_failure_at").
+			WithArgs("account:jack").
+			WillReturnRows(pgxmock.NewRows(columns).AddRow(10, time.Now().Add(-2*time.Hour)))
+
+		store := attemptdb.NewStore(mock, policy)
+		wait, err := store.Wait(context.Background(), "account:jack")
+
+		assert.NoError(t, err)
+		assert.Zero(t, wait)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestFail(t *testing.T) {
+	mock, err := pgxmock.NewConn()
+	assert.NoError(t, err)
+	defer mock.Close(context.Background())
+
+	mock.ExpectQuery("INSERT INTO login_attempts").
+		WithArgs("ip:10.0.0.1", pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"failures"}).AddRow(5))
+
+	store := attemptdb.NewStore(mock, policy)
+	delay, err := store.Fail(context.Background(), "ip:10.0.0.1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Second, delay)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
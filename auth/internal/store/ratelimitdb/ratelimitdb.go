@@ -0,0 +1,80 @@
+// Package ratelimitdb keeps the rate limits in Postgres, so every replica of
+// the auth service shares them.
+package ratelimitdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackgris/twitter-backend/auth/internal/store"
+	"github.com/jackgris/twitter-backend/auth/pkg/ratelimit"
+)
+
+// Store is a ratelimit.Limiter letting each key take up to limit actions
+// every period. Limiters with different limits can share the table as long
+// as their keys don't collide.
+type Store struct {
+	db     store.PgxIface
+	limit  int
+	period time.Duration
+}
+
+var _ ratelimit.Limiter = (*Store)(nil)
+
+func NewStore(db store.PgxIface, limit int, period time.Duration) *Store {
+	return &Store{
+		db:     db,
+		limit:  limit,
+		period: period,
+	}
+}
+
+func (s *Store) Take(ctx context.Context, key string, n int) (int, time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*400)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	// The row is locked until the commit, so concurrent requests on
+	// different replicas can't take the same actions
+	now := time.Now()
+	query := `
+                INSERT INTO rate_limits (key, window_start, used)
+                VALUES ($1, $2, 0)
+                ON CONFLICT (key) DO UPDATE SET key = EXCLUDED.key
+                RETURNING window_start, used
+        `
+	var start time.Time
+	var used int
+	err = tx.QueryRow(ctx, query, key, now).Scan(&start, &used)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to fetch rate limit: %w", err)
+	}
+
+	if now.Sub(start) >= s.period {
+		start, used = now, 0
+	}
+	taken := max(min(n, s.limit-used), 0)
+
+	query = `
+                UPDATE rate_limits SET window_start = $2, used = $3 WHERE key = $1
+        `
+	_, err = tx.Exec(ctx, query, key, start, used+taken)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to update rate limit: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return taken, start.Add(s.period), nil
+}
@@ -0,0 +1,86 @@
+package ratelimitdb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackgris/twitter-backend/auth/internal/store/ratelimitdb"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTake(t *testing.T) {
+	columns := []string{"window_start", "used"}
+
+	t.Run("Take what is left", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		start := time.Now().Add(-10 * time.Minute)
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO rate_limits").
+			WithArgs("import:user-1", pgxmock.AnyArg()).
+			WillReturnRows(pgxmock.NewRows(columns).AddRow(start, 8))
+		mock.ExpectExec("UPDATE rate_limits SET window_start").
+			WithArgs("import:user-1", start, 10).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectCommit()
+
+		store := ratelimitdb.NewStore(mock, 10, time.Hour)
+		taken, reset, err := store.Take(context.Background(), "import:user-1", 5)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, taken)
+		assert.Equal(t, start.Add(time.Hour), reset)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Nothing left", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		start := time.Now().Add(-10 * time.Minute)
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO rate_limits").
+			WithArgs("import:user-1", pgxmock.AnyArg()).
+			WillReturnRows(pgxmock.NewRows(columns).AddRow(start, 10))
+		mock.ExpectExec("UPDATE rate_limits SET window_start").
+			WithArgs("import:user-1", start, 10).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectCommit()
+
+		store := ratelimitdb.NewStore(mock, 10, time.Hour)
+		taken, reset, err := store.Take(context.Background(), "import:user-1", 1)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, taken)
+		assert.Equal(t, start.Add(time.Hour), reset)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("A new window starts", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO rate_limits").
+			WithArgs("import:user-1", pgxmock.AnyArg()).
+			WillReturnRows(pgxmock.NewRows(columns).AddRow(time.Now().Add(-2*time.Hour), 10))
+		mock.ExpectExec("UPDATE rate_limits SET window_start").
+			WithArgs("import:user-1", pgxmock.AnyArg(), 3).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectCommit()
+
+		store := ratelimitdb.NewStore(mock, 10, time.Hour)
+		taken, reset, err := store.Take(context.Background(), "import:user-1", 3)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 3, taken)
+		assert.InDelta(t, time.Hour, time.Until(reset), float64(time.Second))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
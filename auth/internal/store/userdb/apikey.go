@@ -0,0 +1,183 @@
+package userdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/pkg/uuid"
+)
+
+var (
+	ErrNotBot         = errors.New("user not found or not a bot account")
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	ErrInvalidAPIKey  = errors.New("invalid, expired or revoked API key")
+)
+
+// CreateBot creates a bot account. Bots have no email and nobody knows
+// their password, they use API keys instead of logging in.
+func (s *Store) CreateBot(bot usermodel.User) (usermodel.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	reserved, err := usernameReserved(ctx, s.db, bot.UserName, "")
+	if err != nil {
+		return usermodel.User{}, err
+	}
+	if reserved {
+		return usermodel.User{}, ErrUsernameReserved
+	}
+
+	// The email is unique and required, bots get one that can't receive
+	// mail, RFC 2606 reserves .invalid
+	query := `
+                INSERT INTO users (id, username, email, password, salt, token, date_created, encoded_date, display_name, email_verified_at, bot)
+                VALUES ($1, $2, $1 || '@bots.invalid', $3, $4, '', $5, '', $6, $5, true)
+                RETURNING id, username, email, date_created, version, email_verified_at, display_name
+        `
+	var user usermodel.User
+	err = s.db.QueryRow(ctx, query, uuid.New(), bot.UserName, bot.Password, bot.Salt, time.Now(), bot.DisplayName).Scan(
+		&user.ID,
+		&user.UserName,
+		&user.Email,
+		&user.DateCreated,
+		&user.Version,
+		&user.EmailVerifiedAt,
+		&user.DisplayName)
+	if err != nil {
+		if err := uniqueViolation(err); err != nil {
+			return usermodel.User{}, err
+		}
+		return usermodel.User{}, fmt.Errorf("failed to insert bot: %w", err)
+	}
+
+	return user, nil
+}
+
+// CreateAPIKey stores the key of a bot account, ErrNotBot is returned for
+// users who aren't bots.
+func (s *Store) CreateAPIKey(key usermodel.APIKey) (usermodel.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	key.ID = uuid.New()
+	key.CreatedAt = time.Now()
+
+	query := `
+                INSERT INTO api_keys (id, user_id, name, prefix, key_hash, scopes, created_by, created_at, expires_at)
+                SELECT $1, id, $3, $4, $5, $6, $7, $8, $9 FROM users
+                WHERE id = $2 AND bot
+        `
+	tag, err := s.db.Exec(ctx, query, key.ID, key.UserID, key.Name, key.Prefix, key.KeyHash, key.Scopes, key.CreatedBy, key.CreatedAt, key.ExpiresAt)
+	if err != nil {
+		return usermodel.APIKey{}, fmt.Errorf("failed to insert API key: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return usermodel.APIKey{}, ErrNotBot
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys returns the keys of the bot, revoked and expired ones too, the
+// newest first.
+func (s *Store) ListAPIKeys(userID string) ([]usermodel.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                SELECT id, user_id, name, prefix, scopes, created_by, created_at, expires_at, last_used_at, revoked_at
+                FROM api_keys
+                WHERE user_id = $1
+                ORDER BY created_at DESC
+        `
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []usermodel.APIKey{}
+	for rows.Next() {
+		var key usermodel.APIKey
+		err := rows.Scan(
+			&key.ID,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			&key.Scopes,
+			&key.CreatedBy,
+			&key.CreatedAt,
+			&key.ExpiresAt,
+			&key.LastUsedAt,
+			&key.RevokedAt)
+		if err != nil {
+			return nil, fmt.Errorf("row scanning failed: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows iteration failed: %w", rows.Err())
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey revokes a key of the bot, keys already revoked aren't found.
+func (s *Store) RevokeAPIKey(userID, keyID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                UPDATE api_keys SET revoked_at = $3
+                WHERE user_id = $1 AND id = $2 AND revoked_at IS NULL
+        `
+	tag, err := s.db.Exec(ctx, query, userID, keyID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+// VerifyAPIKey returns the key with hash, if it is neither revoked nor
+// expired, and records it was used.
+func (s *Store) VerifyAPIKey(hash string) (usermodel.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                UPDATE api_keys k SET last_used_at = $2
+                FROM users u
+                WHERE k.key_hash = $1 AND u.id = k.user_id
+                        AND k.revoked_at IS NULL AND (k.expires_at IS NULL OR k.expires_at > $2)
+                RETURNING k.id, k.user_id, u.username, k.name, k.prefix, k.scopes, k.expires_at, k.last_used_at
+        `
+	var key usermodel.APIKey
+	err := s.db.QueryRow(ctx, query, hash, time.Now()).Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Username,
+		&key.Name,
+		&key.Prefix,
+		&key.Scopes,
+		&key.ExpiresAt,
+		&key.LastUsedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return usermodel.APIKey{}, ErrInvalidAPIKey
+		}
+		return usermodel.APIKey{}, fmt.Errorf("failed to verify API key: %w", err)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,175 @@
+package userdb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateBot(t *testing.T) {
+	mock, err := pgxmock.NewConn()
+	assert.NoError(t, err)
+	defer mock.Close(context.Background())
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT EXISTS").
+		WithArgs("deploybot", "", pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery("INSERT INTO users").
+		WithArgs(pgxmock.AnyArg(), "deploybot", "hash", "salt", pgxmock.AnyArg(), "Deploy bot").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "username", "email", "date_created", "version", "email_verified_at", "display_name"}).
+			AddRow("bot-1", "deploybot", "bot-1@bots.invalid", now, 1, &now, "Deploy bot"))
+
+	store := userdb.NewStore(mock)
+	bot, err := store.CreateBot(usermodel.User{UserName: "deploybot", Password: "hash", Salt: "salt", DisplayName: "Deploy bot"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "bot-1", bot.ID)
+	assert.Equal(t, "bot-1@bots.invalid", bot.Email)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	key := usermodel.APIKey{
+		UserID:    "bot-1",
+		Name:      "deploys",
+		Prefix:    "twk_0123abcd",
+		KeyHash:   "hash",
+		Scopes:    []string{"tweet:write"},
+		CreatedBy: "admin-1",
+	}
+
+	t.Run("Create OK", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectExec("INSERT INTO api_keys").
+			WithArgs(pgxmock.AnyArg(), "bot-1", "deploys", "twk_0123abcd", "hash", []string{"tweet:write"}, "admin-1", pgxmock.AnyArg(), (*time.Time)(nil)).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+		store := userdb.NewStore(mock)
+		created, err := store.CreateAPIKey(key)
+
+		assert.NoError(t, err)
+		assert.NotEmpty(t, created.ID)
+		assert.False(t, created.CreatedAt.IsZero())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Create for a user who isn't a bot", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectExec("INSERT INTO api_keys").
+			WithArgs(pgxmock.AnyArg(), "bot-1", "deploys", "twk_0123abcd", "hash", []string{"tweet:write"}, "admin-1", pgxmock.AnyArg(), (*time.Time)(nil)).
+			WillReturnResult(pgxmock.NewResult("INSERT", 0))
+
+		store := userdb.NewStore(mock)
+		_, err = store.CreateAPIKey(key)
+
+		assert.ErrorIs(t, err, userdb.ErrNotBot)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestListAPIKeys(t *testing.T) {
+	mock, err := pgxmock.NewConn()
+	assert.NoError(t, err)
+	defer mock.Close(context.Background())
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT id, user_id, name, prefix, scopes").
+		WithArgs("bot-1").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "user_id", "name", "prefix", "scopes", "created_by", "created_at", "expires_at", "last_used_at", "revoked_at"}).
+			AddRow("key-2", "bot-1", "reads", "twk_89efabcd", []string{"timeline:read"}, "admin-1", now, (*time.Time)(nil), &now, (*time.Time)(nil)).
+			AddRow("key-1", "bot-1", "deploys", "twk_0123abcd", []string{"tweet:write"}, "admin-1", now.Add(-time.Hour), (*time.Time)(nil), (*time.Time)(nil), &now))
+
+	store := userdb.NewStore(mock)
+	keys, err := store.ListAPIKeys("bot-1")
+
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	assert.Equal(t, []string{"timeline:read"}, keys[0].Scopes)
+	assert.NotNil(t, keys[1].RevokedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	t.Run("Revoke OK", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectExec("UPDATE api_keys SET revoked_at").
+			WithArgs("bot-1", "key-1", pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+		store := userdb.NewStore(mock)
+		err = store.RevokeAPIKey("bot-1", "key-1")
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Revoke unknown key", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectExec("UPDATE api_keys SET revoked_at").
+			WithArgs("bot-1", "key-1", pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+		store := userdb.NewStore(mock)
+		err = store.RevokeAPIKey("bot-1", "key-1")
+
+		assert.ErrorIs(t, err, userdb.ErrAPIKeyNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestVerifyAPIKey(t *testing.T) {
+	t.Run("Verify OK", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		now := time.Now()
+		mock.ExpectQuery("UPDATE api_keys k SET last_used_at").
+			WithArgs("hash", pgxmock.AnyArg()).
+			WillReturnRows(pgxmock.NewRows([]string{"id", "user_id", "username", "name", "prefix", "scopes", "expires_at", "last_used_at"}).
+				AddRow("key-1", "bot-1", "deploybot", "deploys", "twk_0123abcd", []string{"tweet:write"}, (*time.Time)(nil), &now))
+
+		store := userdb.NewStore(mock)
+		key, err := store.VerifyAPIKey("hash")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "deploybot", key.Username)
+		assert.Equal(t, []string{"tweet:write"}, key.Scopes)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Verify revoked or expired key", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectQuery("UPDATE api_keys k SET last_used_at").
+			WithArgs("hash", pgxmock.AnyArg()).
+			WillReturnError(pgx.ErrNoRows)
+
+		store := userdb.NewStore(mock)
+		_, err = store.VerifyAPIKey("hash")
+
+		assert.ErrorIs(t, err, userdb.ErrInvalidAPIKey)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,106 @@
+package userdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+)
+
+// GetFollowers returns a page of the users following userID, most recent
+// follows first. Passing the NextCursor of a page returns the next one.
+func (s *Store) GetFollowers(userID, cursor string, limit int) (usermodel.UserPage, error) {
+	query := `
+                SELECT uf.id, u.id, u.username, u.display_name, u.avatar_url, u.follower_count, u.following_count
+                FROM user_followers uf
+                JOIN users u ON u.id = uf.follower_id
+                WHERE uf.user_id = $1 AND ($2 = '' OR uf.id < $2)
+                ORDER BY uf.id DESC
+                LIMIT $3
+        `
+	return s.userPage(query, userID, cursor, limit)
+}
+
+// GetFollowing returns a page of the users userID follows, most recent
+// follows first. Passing the NextCursor of a page returns the next one.
+func (s *Store) GetFollowing(userID, cursor string, limit int) (usermodel.UserPage, error) {
+	query := `
+                SELECT uf.id, u.id, u.username, u.display_name, u.avatar_url, u.follower_count, u.following_count
+                FROM user_followers uf
+                JOIN users u ON u.id = uf.user_id
+                WHERE uf.follower_id = $1 AND ($2 = '' OR uf.id < $2)
+                ORDER BY uf.id DESC
+                LIMIT $3
+        `
+	return s.userPage(query, userID, cursor, limit)
+}
+
+// userPage runs a listing query asking for one row more than limit, which
+// tells if there is a next page without counting. The first column must be
+// the ID of the follow, block or mute the page is sorted by, the cursor is
+// the last one returned, xids sort by creation time.
+func (s *Store) userPage(query, userID, cursor string, limit int) (usermodel.UserPage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	rows, err := s.db.Query(ctx, query, userID, cursor, limit+1)
+	if err != nil {
+		return usermodel.UserPage{}, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	page := usermodel.UserPage{Users: []usermodel.UserSummary{}}
+	var lastID string
+	for rows.Next() {
+		var edgeID string
+		var user usermodel.UserSummary
+		if err := rows.Scan(&edgeID, &user.ID, &user.UserName, &user.DisplayName, &user.AvatarURL, &user.FollowerCount, &user.FollowingCount); err != nil {
+			return usermodel.UserPage{}, fmt.Errorf("failed to scan user: %w", err)
+		}
+
+		if len(page.Users) == limit {
+			page.NextCursor = lastID
+			break
+		}
+		page.Users = append(page.Users, user)
+		lastID = edgeID
+	}
+	if err := rows.Err(); err != nil {
+		return usermodel.UserPage{}, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	if len(page.Users) == 0 && cursor == "" {
+		var exists bool
+		err := s.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, userID).Scan(&exists)
+		if err != nil {
+			return usermodel.UserPage{}, fmt.Errorf("failed to fetch user: %w", err)
+		}
+		if !exists {
+			return usermodel.UserPage{}, pgx.ErrNoRows
+		}
+	}
+
+	return page, nil
+}
+
+// FollowerIDs returns the ID of every follower of userID, used to fan out
+// their tweets.
+func (s *Store) FollowerIDs(userID string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	rows, err := s.db.Query(ctx, `SELECT follower_id FROM user_followers WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list followers: %w", err)
+	}
+
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to list followers: %w", err)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,209 @@
+package userdb_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetFollowers(t *testing.T) {
+	columns := []string{"id", "id", "username", "display_name", "avatar_url", "follower_count", "following_count"}
+
+	t.Run("First page has a next cursor", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectQuery("SELECT uf.id, u.id, u.username").
+			WithArgs("user-1", "", 3).
+			WillReturnRows(pgxmock.NewRows(columns).
+				AddRow("follow-3", "user-4", "carol", "Carol", "", 1, 2).
+				AddRow("follow-2", "user-3", "bob", "Bob", "", 0, 1).
+				AddRow("follow-1", "user-2", "alice", "Alice", "", 5, 1))
+
+		store := userdb.NewStore(mock)
+		page, err := store.GetFollowers("user-1", "", 2)
+
+		assert.NoError(t, err)
+		assert.Len(t, page.Users, 2)
+		assert.Equal(t, "carol", page.Users[0].UserName)
+		assert.Equal(t, "follow-2", page.NextCursor)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Last page has no cursor", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectQuery("SELECT uf.id, u.id, u.username").
+			WithArgs("user-1", "follow-2", 3).
+			WillReturnRows(pgxmock.NewRows(columns).
+				AddRow("follow-1", "user-2", "alice", "Alice", "", 5, 1))
+
+		store := userdb.NewStore(mock)
+		page, err := store.GetFollowers("user-1", "follow-2", 2)
+
+		assert.NoError(t, err)
+		assert.Len(t, page.Users, 1)
+		assert.Empty(t, page.NextCursor)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Unknown user", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectQuery("SELECT uf.id, u.id, u.username").
+			WithArgs("user-1", "", 21).
+			WillReturnRows(pgxmock.NewRows(columns))
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs("user-1").
+			WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(false))
+
+		store := userdb.NewStore(mock)
+		_, err = store.GetFollowers("user-1", "", 20)
+
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestFollow(t *testing.T) {
+	follow := usermodel.UserFollowers{UserID: "user-1", FollowerID: "user-2"}
+
+	t.Run("New follow updates both counters", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs("user-1", "user-2").
+			WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery("INSERT INTO user_followers").
+			WithArgs(pgxmock.AnyArg(), "user-1", "user-2").
+			WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow("follow-1"))
+		mock.ExpectExec("UPDATE users SET follower_count").
+			WithArgs("user-1", 1).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectExec("UPDATE users SET following_count").
+			WithArgs("user-2", 1).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectCommit()
+
+		store := userdb.NewStore(mock)
+		got, created, err := store.Follow(follow)
+
+		assert.NoError(t, err)
+		assert.True(t, created)
+		assert.Equal(t, "follow-1", got.ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Repeated follow returns the existing one", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs("user-1", "user-2").
+			WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery("INSERT INTO user_followers").
+			WithArgs(pgxmock.AnyArg(), "user-1", "user-2").
+			WillReturnRows(pgxmock.NewRows([]string{"id"}))
+		mock.ExpectQuery("SELECT id FROM user_followers").
+			WithArgs("user-1", "user-2").
+			WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow("follow-1"))
+		mock.ExpectRollback()
+
+		store := userdb.NewStore(mock)
+		got, created, err := store.Follow(follow)
+
+		assert.NoError(t, err)
+		assert.False(t, created)
+		assert.Equal(t, "follow-1", got.ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Blocked", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs("user-1", "user-2").
+			WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectRollback()
+
+		store := userdb.NewStore(mock)
+		_, _, err = store.Follow(follow)
+
+		assert.ErrorIs(t, err, userdb.ErrBlocked)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Self follow", func(t *testing.T) {
+		store := userdb.NewStore(nil)
+		_, _, err := store.Follow(usermodel.UserFollowers{UserID: "user-1", FollowerID: "user-1"})
+
+		assert.ErrorIs(t, err, userdb.ErrSelfFollow)
+	})
+}
+
+func TestUnfollow(t *testing.T) {
+	follow := usermodel.UserFollowers{UserID: "user-1", FollowerID: "user-2"}
+
+	t.Run("Unfollow updates both counters", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM user_followers").
+			WithArgs("user-1", "user-2").
+			WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		mock.ExpectExec("UPDATE users SET follower_count").
+			WithArgs("user-1", -1).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectExec("UPDATE users SET following_count").
+			WithArgs("user-2", -1).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectCommit()
+
+		store := userdb.NewStore(mock)
+		err = store.Unfollow(follow)
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Missing follow", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM user_followers").
+			WithArgs("user-1", "user-2").
+			WillReturnResult(pgxmock.NewResult("DELETE", 0))
+		mock.ExpectExec("DELETE FROM follow_requests").
+			WithArgs("user-1", "user-2").
+			WillReturnResult(pgxmock.NewResult("DELETE", 0))
+		mock.ExpectRollback()
+
+		store := userdb.NewStore(mock)
+		err = store.Unfollow(follow)
+
+		assert.ErrorIs(t, err, userdb.ErrFollowNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
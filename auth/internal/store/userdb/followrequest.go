@@ -0,0 +1,201 @@
+package userdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/pkg/uuid"
+)
+
+var (
+	ErrAlreadyFollowing      = errors.New("already following")
+	ErrFollowRequestNotFound = errors.New("follow request not found")
+)
+
+// RequestFollow asks the protected user follow.UserID to approve
+// follow.FollowerID as follower. Requesting twice returns the pending request
+// and created false, ErrAlreadyFollowing is returned when it was approved.
+func (s *Store) RequestFollow(follow usermodel.UserFollowers) (usermodel.FollowRequest, bool, error) {
+	if follow.UserID == follow.FollowerID {
+		return usermodel.FollowRequest{}, false, ErrSelfFollow
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return usermodel.FollowRequest{}, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	blocked, err := blockedBetween(ctx, tx, follow.UserID, follow.FollowerID)
+	if err != nil {
+		return usermodel.FollowRequest{}, false, err
+	}
+	if blocked {
+		return usermodel.FollowRequest{}, false, ErrBlocked
+	}
+
+	var following bool
+	query := `
+                SELECT EXISTS (SELECT 1 FROM user_followers WHERE user_id = $1 AND follower_id = $2)
+        `
+	err = tx.QueryRow(ctx, query, follow.UserID, follow.FollowerID).Scan(&following)
+	if err != nil {
+		return usermodel.FollowRequest{}, false, fmt.Errorf("failed to fetch follow: %w", err)
+	}
+	if following {
+		return usermodel.FollowRequest{}, false, ErrAlreadyFollowing
+	}
+
+	request := usermodel.FollowRequest{UserID: follow.UserID, FollowerID: follow.FollowerID}
+	query = `
+                INSERT INTO follow_requests (id, user_id, follower_id, created_at) VALUES ($1, $2, $3, $4)
+                ON CONFLICT (user_id, follower_id) DO NOTHING
+                RETURNING id, created_at
+        `
+	err = tx.QueryRow(ctx, query, uuid.New(), follow.UserID, follow.FollowerID, time.Now()).Scan(&request.ID, &request.CreatedAt)
+	created := true
+	if errors.Is(err, pgx.ErrNoRows) {
+		created = false
+		query = `
+                        SELECT id, created_at FROM follow_requests WHERE user_id = $1 AND follower_id = $2
+                `
+		err = tx.QueryRow(ctx, query, follow.UserID, follow.FollowerID).Scan(&request.ID, &request.CreatedAt)
+	}
+	if err != nil {
+		var pgErr *pgconn.PgError
+		// 23503 is foreign_key_violation
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return usermodel.FollowRequest{}, false, ErrUserNotFound
+		}
+		return usermodel.FollowRequest{}, false, fmt.Errorf("failed to insert follow request: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return usermodel.FollowRequest{}, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return request, created, nil
+}
+
+// GetFollowRequests returns a page of the users waiting for userID to
+// approve them, most recent first.
+func (s *Store) GetFollowRequests(userID, cursor string, limit int) (usermodel.UserPage, error) {
+	query := `
+                SELECT fr.id, u.id, u.username, u.display_name, u.avatar_url, u.follower_count, u.following_count
+                FROM follow_requests fr
+                JOIN users u ON u.id = fr.follower_id
+                WHERE fr.user_id = $1 AND ($2 = '' OR fr.id < $2)
+                ORDER BY fr.id DESC
+                LIMIT $3
+        `
+	return s.userPage(query, userID, cursor, limit)
+}
+
+// ApproveFollowRequest turns the request of followerID into a follow of
+// userID, updating the counters of both users like Follow.
+func (s *Store) ApproveFollowRequest(userID, followerID string) (usermodel.UserFollowers, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return usermodel.UserFollowers{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	if err := deleteFollowRequest(ctx, tx, userID, followerID); err != nil {
+		return usermodel.UserFollowers{}, err
+	}
+
+	follow := usermodel.UserFollowers{UserID: userID, FollowerID: followerID}
+	query := `
+                INSERT INTO user_followers (id, user_id, follower_id) VALUES ($1, $2, $3)
+                RETURNING id
+        `
+	err = tx.QueryRow(ctx, query, uuid.New(), userID, followerID).Scan(&follow.ID)
+	if err != nil {
+		return usermodel.UserFollowers{}, fmt.Errorf("failed to insert follow: %w", err)
+	}
+
+	if err := updateFollowCounts(ctx, tx, follow, 1); err != nil {
+		return usermodel.UserFollowers{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return usermodel.UserFollowers{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return follow, nil
+}
+
+// approveFollowRequests turns every pending request to follow userID into a
+// follow, like ApproveFollowRequest, and returns the new follows.
+func approveFollowRequests(ctx context.Context, tx pgx.Tx, userID string) ([]usermodel.UserFollowers, error) {
+	rows, err := tx.Query(ctx, `DELETE FROM follow_requests WHERE user_id = $1 RETURNING follower_id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete follow requests: %w", err)
+	}
+	followerIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete follow requests: %w", err)
+	}
+
+	follows := []usermodel.UserFollowers{}
+	for _, followerID := range followerIDs {
+		follow := usermodel.UserFollowers{UserID: userID, FollowerID: followerID}
+		query := `
+                        INSERT INTO user_followers (id, user_id, follower_id) VALUES ($1, $2, $3)
+                        ON CONFLICT (user_id, follower_id) DO NOTHING
+                        RETURNING id
+                `
+		err := tx.QueryRow(ctx, query, uuid.New(), userID, followerID).Scan(&follow.ID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert follow: %w", err)
+		}
+
+		if err := updateFollowCounts(ctx, tx, follow, 1); err != nil {
+			return nil, err
+		}
+		follows = append(follows, follow)
+	}
+
+	return follows, nil
+}
+
+// RejectFollowRequest removes the request of followerID to follow userID.
+func (s *Store) RejectFollowRequest(userID, followerID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	return deleteFollowRequest(ctx, s.db, userID, followerID)
+}
+
+func deleteFollowRequest(ctx context.Context, db execer, userID, followerID string) error {
+	query := `
+                DELETE FROM follow_requests WHERE user_id = $1 AND follower_id = $2
+        `
+	tag, err := db.Exec(ctx, query, userID, followerID)
+	if err != nil {
+		return fmt.Errorf("failed to delete follow request: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrFollowRequestNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package userdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/pkg/uuid"
+)
+
+var ErrIdentityTaken = errors.New("identity already linked to a user")
+
+// GetUserByIdentity returns the user linked to the subject of issuer, or
+// pgx.ErrNoRows when the identity isn't linked yet.
+func (s *Store) GetUserByIdentity(issuer, subject string) (usermodel.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                SELECT u.id, u.username, u.email, u.password, u.follower_count, u.following_count, u.salt, u.token, u.date_created, u.encoded_date, u.version, u.protected, u.email_verified_at, u.display_name, u.bio, u.avatar_url, u.location, u.website, u.role, u.suspended_at
+                FROM user_identities i
+                JOIN users u ON u.id = i.user_id
+                WHERE i.issuer = $1 AND i.subject = $2
+        `
+
+	var user usermodel.User
+	err := s.db.QueryRow(ctx, query, issuer, subject).Scan(
+		&user.ID,
+		&user.UserName,
+		&user.Email,
+		&user.Password,
+		&user.FollowerCount,
+		&user.FollowingCount,
+		&user.Salt,
+		&user.Token,
+		&user.DateCreated,
+		&user.EncodedDate,
+		&user.Version,
+		&user.Protected,
+		&user.EmailVerifiedAt,
+		&user.DisplayName,
+		&user.Bio,
+		&user.AvatarURL,
+		&user.Location,
+		&user.Website,
+		&user.Role,
+		&user.SuspendedAt)
+	if err != nil {
+		return usermodel.User{}, err
+	}
+
+	return user, nil
+}
+
+// CreateUserWithIdentity creates user linked to identity in one transaction,
+// for the first login of someone with an OpenID Connect provider. The email
+// is marked as verified when verified is true.
+func (s *Store) CreateUserWithIdentity(user usermodel.User, identity usermodel.UserIdentity, verified bool) (usermodel.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return usermodel.User{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	newUser, err := insertUser(ctx, tx, user)
+	if err != nil {
+		return usermodel.User{}, err
+	}
+
+	if verified {
+		now := time.Now()
+		_, err = tx.Exec(ctx, `UPDATE users SET email_verified_at = $2 WHERE id = $1`, newUser.ID, now)
+		if err != nil {
+			return usermodel.User{}, fmt.Errorf("failed to verify email: %w", err)
+		}
+		newUser.EmailVerifiedAt = &now
+	}
+
+	query := `
+                INSERT INTO user_identities (id, user_id, issuer, subject, email, created_at)
+                VALUES ($1, $2, $3, $4, $5, $6)
+        `
+	_, err = tx.Exec(ctx, query, uuid.New(), newUser.ID, identity.Issuer, identity.Subject, identity.Email, time.Now())
+	if err != nil {
+		// 23505 is unique_violation, someone else logged in first with the
+		// same identity
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return usermodel.User{}, ErrIdentityTaken
+		}
+		return usermodel.User{}, fmt.Errorf("failed to insert user identity: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return usermodel.User{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return newUser, nil
+}
+
+// LinkIdentity links identity to an existing user.
+func (s *Store) LinkIdentity(identity usermodel.UserIdentity) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                INSERT INTO user_identities (id, user_id, issuer, subject, email, created_at)
+                VALUES ($1, $2, $3, $4, $5, $6)
+        `
+	_, err := s.db.Exec(ctx, query, uuid.New(), identity.UserID, identity.Issuer, identity.Subject, identity.Email, time.Now())
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrIdentityTaken
+		}
+		return fmt.Errorf("failed to insert user identity: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package userdb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateUserWithIdentity(t *testing.T) {
+	columns := []string{"id", "username", "email", "password", "follower_count", "following_count", "salt", "token", "date_created", "encoded_date", "version", "protected", "email_verified_at", "display_name", "bio", "avatar_url", "location", "website"}
+	user := usermodel.User{UserName: "jack", Email: "jack@mail.com", Password: "hash", DisplayName: "Jack"}
+	identity := usermodel.UserIdentity{Issuer: "https://issuer", Subject: "sub-1", Email: "jack@mail.com"}
+	insertArgs := []any{pgxmock.AnyArg(), "jack", "jack@mail.com", "hash", 0, 0, "", "", pgxmock.AnyArg(), "", "Jack"}
+	userRow := func() *pgxmock.Rows {
+		return pgxmock.NewRows(columns).
+			AddRow("user-1", "jack", "jack@mail.com", "hash", 0, 0, "", "", time.Now(), "", 1, false, nil, "Jack", "", "", "", "")
+	}
+
+	t.Run("Create OK", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs("jack", "", pgxmock.AnyArg()).
+			WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery("INSERT INTO users").
+			WithArgs(insertArgs...).
+			WillReturnRows(userRow())
+		mock.ExpectExec("UPDATE users SET email_verified_at").
+			WithArgs("user-1", pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectExec("INSERT INTO user_identities").
+			WithArgs(pgxmock.AnyArg(), "user-1", "https://issuer", "sub-1", "jack@mail.com", pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		mock.ExpectCommit()
+
+		store := userdb.NewStore(mock)
+		created, err := store.CreateUserWithIdentity(user, identity, true)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "user-1", created.ID)
+		assert.NotNil(t, created.EmailVerifiedAt)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Identity already linked", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs("jack", "", pgxmock.AnyArg()).
+			WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery("INSERT INTO users").
+			WithArgs(insertArgs...).
+			WillReturnRows(userRow())
+		mock.ExpectExec("INSERT INTO user_identities").
+			WithArgs(pgxmock.AnyArg(), "user-1", "https://issuer", "sub-1", "jack@mail.com", pgxmock.AnyArg()).
+			WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "user_identities_issuer_subject_key"})
+		mock.ExpectRollback()
+
+		store := userdb.NewStore(mock)
+		_, err = store.CreateUserWithIdentity(user, identity, false)
+
+		assert.ErrorIs(t, err, userdb.ErrIdentityTaken)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Email taken", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs("jack", "", pgxmock.AnyArg()).
+			WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery("INSERT INTO users").
+			WithArgs(insertArgs...).
+			WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "users_email_key"})
+		mock.ExpectRollback()
+
+		store := userdb.NewStore(mock)
+		_, err = store.CreateUserWithIdentity(user, identity, false)
+
+		assert.ErrorIs(t, err, userdb.ErrEmailTaken)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,183 @@
+package userdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/pkg/uuid"
+)
+
+var (
+	ErrMFAEnabled          = errors.New("two-factor authentication already enabled")
+	ErrMFANotPending       = errors.New("no two-factor enrollment to confirm")
+	ErrMFACodeUsed         = errors.New("two-factor code already used")
+	ErrRecoveryCodeInvalid = errors.New("recovery code invalid or already used")
+)
+
+// GetMFA returns the second factor of the user, enabled or waiting for its
+// confirmation, or pgx.ErrNoRows when the user has none.
+func (s *Store) GetMFA(userID string) (usermodel.MFA, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                SELECT user_id, secret, created_at, enabled_at, last_step
+                FROM user_mfa
+                WHERE user_id = $1
+        `
+	var mfa usermodel.MFA
+	err := s.db.QueryRow(ctx, query, userID).Scan(&mfa.UserID, &mfa.Secret, &mfa.CreatedAt, &mfa.EnabledAt, &mfa.LastStep)
+	if err != nil {
+		return usermodel.MFA{}, err
+	}
+
+	return mfa, nil
+}
+
+// EnrollMFA saves a new secret for the user waiting for its confirmation,
+// replacing a previous enrollment that wasn't confirmed. It returns
+// ErrMFAEnabled when the user already has two-factor authentication.
+func (s *Store) EnrollMFA(userID, secret string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                INSERT INTO user_mfa (user_id, secret, created_at)
+                VALUES ($1, $2, $3)
+                ON CONFLICT (user_id) DO UPDATE
+                SET secret = EXCLUDED.secret, created_at = EXCLUDED.created_at, last_step = 0
+                WHERE user_mfa.enabled_at IS NULL
+        `
+	tag, err := s.db.Exec(ctx, query, userID, secret, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to save two-factor secret: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrMFAEnabled
+	}
+
+	return nil
+}
+
+// EnableMFA confirms the enrollment of the user with a code of the given
+// time step, and replaces their recovery codes with the given hashes.
+func (s *Store) EnableMFA(userID string, step int64, recoveryHashes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	query := `
+                UPDATE user_mfa SET enabled_at = $2, last_step = $3
+                WHERE user_id = $1 AND enabled_at IS NULL
+        `
+	tag, err := tx.Exec(ctx, query, userID, time.Now(), step)
+	if err != nil {
+		return fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrMFANotPending
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	for _, hash := range recoveryHashes {
+		_, err = tx.Exec(ctx, `INSERT INTO mfa_recovery_codes (id, user_id, code_hash) VALUES ($1, $2, $3)`, uuid.New(), userID, hash)
+		if err != nil {
+			return fmt.Errorf("failed to insert recovery code: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// UseMFAStep records a code of the given time step was used. It returns
+// ErrMFACodeUsed when a code of that step or a later one was already used,
+// so a code seen by someone else can't be replayed.
+func (s *Store) UseMFAStep(userID string, step int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                UPDATE user_mfa SET last_step = $2
+                WHERE user_id = $1 AND last_step < $2
+        `
+	tag, err := s.db.Exec(ctx, query, userID, step)
+	if err != nil {
+		return fmt.Errorf("failed to save two-factor code step: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrMFACodeUsed
+	}
+
+	return nil
+}
+
+// UseRecoveryCode uses up the recovery code of the user with the given hash.
+func (s *Store) UseRecoveryCode(userID, hash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                UPDATE mfa_recovery_codes SET used_at = $3
+                WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+        `
+	tag, err := s.db.Exec(ctx, query, userID, hash, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrRecoveryCodeInvalid
+	}
+
+	return nil
+}
+
+// DisableMFA removes the second factor of the user and their recovery codes.
+func (s *Store) DisableMFA(userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	_, err = tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete two-factor secret: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package userdb_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnrollMFA(t *testing.T) {
+	t.Run("Enroll OK", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectExec("INSERT INTO user_mfa").
+			WithArgs("user-1", "SECRET", pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+		store := userdb.NewStore(mock)
+		err = store.EnrollMFA("user-1", "SECRET")
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Already enabled", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectExec("INSERT INTO user_mfa").
+			WithArgs("user-1", "SECRET", pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("INSERT", 0))
+
+		store := userdb.NewStore(mock)
+		err = store.EnrollMFA("user-1", "SECRET")
+
+		assert.ErrorIs(t, err, userdb.ErrMFAEnabled)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestEnableMFA(t *testing.T) {
+	t.Run("Enable OK", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE user_mfa SET enabled_at").
+			WithArgs("user-1", pgxmock.AnyArg(), int64(42)).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectExec("DELETE FROM mfa_recovery_codes").
+			WithArgs("user-1").
+			WillReturnResult(pgxmock.NewResult("DELETE", 0))
+		for _, hash := range []string{"hash-1", "hash-2"} {
+			mock.ExpectExec("INSERT INTO mfa_recovery_codes").
+				WithArgs(pgxmock.AnyArg(), "user-1", hash).
+				WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		}
+		mock.ExpectCommit()
+
+		store := userdb.NewStore(mock)
+		err = store.EnableMFA("user-1", 42, []string{"hash-1", "hash-2"})
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Nothing to confirm", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE user_mfa SET enabled_at").
+			WithArgs("user-1", pgxmock.AnyArg(), int64(42)).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+		mock.ExpectRollback()
+
+		store := userdb.NewStore(mock)
+		err = store.EnableMFA("user-1", 42, []string{"hash-1"})
+
+		assert.ErrorIs(t, err, userdb.ErrMFANotPending)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUseMFAStep(t *testing.T) {
+	t.Run("New step", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectExec("UPDATE user_mfa SET last_step").
+			WithArgs("user-1", int64(43)).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+		store := userdb.NewStore(mock)
+		assert.NoError(t, store.UseMFAStep("user-1", 43))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Replayed step", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectExec("UPDATE user_mfa SET last_step").
+			WithArgs("user-1", int64(43)).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+		store := userdb.NewStore(mock)
+		assert.ErrorIs(t, store.UseMFAStep("user-1", 43), userdb.ErrMFACodeUsed)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUseRecoveryCode(t *testing.T) {
+	mock, err := pgxmock.NewConn()
+	assert.NoError(t, err)
+	defer mock.Close(context.Background())
+
+	mock.ExpectExec("UPDATE mfa_recovery_codes SET used_at").
+		WithArgs("user-1", "hash-1", pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+	store := userdb.NewStore(mock)
+	assert.ErrorIs(t, store.UseRecoveryCode("user-1", "hash-1"), userdb.ErrRecoveryCodeInvalid)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
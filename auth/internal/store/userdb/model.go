@@ -7,18 +7,24 @@ import (
 )
 
 type User struct {
-	ID             string
-	UserName       string
-	Email          string
-	Password       string
-	FollowerCount  int
-	FollowingCount int
-	Salt           string
-	Token          string
-	DateCreated    time.Time
-	EncodedDate    string
-	Followers      []UserFollowers
-	Following      []UserFollowers
+	ID              string
+	UserName        string
+	Email           string
+	Password        string
+	FollowerCount   int
+	FollowingCount  int
+	Salt            string
+	Token           string
+	DateCreated     time.Time
+	EncodedDate     string
+	Version         int
+	Protected       bool
+	EmailVerifiedAt *time.Time
+	DisplayName     string
+	Bio             string
+	AvatarURL       string
+	Location        string
+	Website         string
 }
 
 type UserFollowers struct {
@@ -29,18 +35,24 @@ type UserFollowers struct {
 
 func UserToModel(user User) usermodel.User {
 	return usermodel.User{
-		ID:             user.ID,
-		UserName:       user.UserName,
-		Email:          user.Email,
-		Password:       user.Password,
-		FollowerCount:  user.FollowerCount,
-		FollowingCount: user.FollowingCount,
-		Salt:           user.Salt,
-		Token:          user.Token,
-		DateCreated:    user.DateCreated,
-		EncodedDate:    user.EncodedDate,
-		Followers:      FollowersToModel(user.Followers),
-		Following:      FollowersToModel(user.Following),
+		ID:              user.ID,
+		UserName:        user.UserName,
+		Email:           user.Email,
+		Password:        user.Password,
+		FollowerCount:   user.FollowerCount,
+		FollowingCount:  user.FollowingCount,
+		Salt:            user.Salt,
+		Token:           user.Token,
+		DateCreated:     user.DateCreated,
+		EncodedDate:     user.EncodedDate,
+		Version:         user.Version,
+		Protected:       user.Protected,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		DisplayName:     user.DisplayName,
+		Bio:             user.Bio,
+		AvatarURL:       user.AvatarURL,
+		Location:        user.Location,
+		Website:         user.Website,
 	}
 }
 
@@ -0,0 +1,129 @@
+package userdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// IsSuspended reports whether the user is suspended. Unknown users aren't.
+func (s *Store) IsSuspended(userID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND suspended_at IS NOT NULL)
+        `
+	var suspended bool
+	err := s.db.QueryRow(ctx, query, userID).Scan(&suspended)
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch suspension: %w", err)
+	}
+
+	return suspended, nil
+}
+
+// SuspendUser suspends the user and logs them out everywhere in one
+// transaction. Suspending a suspended user only updates the reason.
+func (s *Store) SuspendUser(userID, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	now := time.Now()
+	query := `
+                UPDATE users SET suspended_at = COALESCE(suspended_at, $2), suspension_reason = $3
+                WHERE id = $1
+        `
+	tag, err := tx.Exec(ctx, query, userID, now, reason)
+	if err != nil {
+		return fmt.Errorf("failed to suspend user: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	query = `
+                UPDATE refresh_tokens SET revoked_at = $2
+                WHERE user_id = $1 AND revoked_at IS NULL
+        `
+	_, err = tx.Exec(ctx, query, userID, now)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// UnsuspendUser lifts the suspension of the user. They have to log in again.
+func (s *Store) UnsuspendUser(userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                UPDATE users SET suspended_at = NULL, suspension_reason = ''
+                WHERE id = $1
+        `
+	tag, err := s.db.Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to unsuspend user: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// SetRole changes the role of the user. Their access tokens carry the old
+// role until they are refreshed, Role tells the current one.
+func (s *Store) SetRole(userID, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                UPDATE users SET role = $2
+                WHERE id = $1
+        `
+	tag, err := s.db.Exec(ctx, query, userID, role)
+	if err != nil {
+		return fmt.Errorf("failed to update role: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// Role returns the current role of the user. Unknown users are regular
+// users.
+func (s *Store) Role(userID string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                SELECT COALESCE((SELECT role FROM users WHERE id = $1), 'user')
+        `
+	var role string
+	err := s.db.QueryRow(ctx, query, userID).Scan(&role)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch role: %w", err)
+	}
+
+	return role, nil
+}
@@ -0,0 +1,85 @@
+package userdb_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuspendUser(t *testing.T) {
+	t.Run("Suspend OK", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users SET suspended_at").
+			WithArgs("user-1", pgxmock.AnyArg(), "spam").
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectExec("UPDATE refresh_tokens SET revoked_at").
+			WithArgs("user-1", pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 2))
+		mock.ExpectCommit()
+
+		store := userdb.NewStore(mock)
+		err = store.SuspendUser("user-1", "spam")
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Suspend unknown user", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users SET suspended_at").
+			WithArgs("user-1", pgxmock.AnyArg(), "spam").
+			WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+		mock.ExpectRollback()
+
+		store := userdb.NewStore(mock)
+		err = store.SuspendUser("user-1", "spam")
+
+		assert.ErrorIs(t, err, userdb.ErrUserNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestIsSuspended(t *testing.T) {
+	mock, err := pgxmock.NewConn()
+	assert.NoError(t, err)
+	defer mock.Close(context.Background())
+
+	mock.ExpectQuery("SELECT EXISTS").
+		WithArgs("user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(true))
+
+	store := userdb.NewStore(mock)
+	suspended, err := store.IsSuspended("user-1")
+
+	assert.NoError(t, err)
+	assert.True(t, suspended)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRole(t *testing.T) {
+	mock, err := pgxmock.NewConn()
+	assert.NoError(t, err)
+	defer mock.Close(context.Background())
+
+	mock.ExpectQuery("SELECT COALESCE").
+		WithArgs("user-1").
+		WillReturnRows(pgxmock.NewRows([]string{"role"}).AddRow("moderator"))
+
+	store := userdb.NewStore(mock)
+	role, err := store.Role("user-1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "moderator", role)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,96 @@
+package userdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/pkg/uuid"
+)
+
+var (
+	ErrResetTokenNotFound = errors.New("password reset token not found")
+	ErrResetTokenExpired  = errors.New("password reset token expired")
+	ErrResetTokenUsed     = errors.New("password reset token already used")
+)
+
+func (s *Store) CreatePasswordResetToken(rt usermodel.PasswordResetToken) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                INSERT INTO password_reset_tokens (id, user_id, token_hash, created_at, expires_at)
+                VALUES ($1, $2, $3, $4, $5)
+        `
+	_, err := s.db.Exec(ctx, query, uuid.New(), rt.UserID, rt.TokenHash, time.Now(), rt.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert password reset token: %w", err)
+	}
+
+	return nil
+}
+
+// ResetPassword sets the password of the user the token with the given hash
+// was issued to. The token and every other reset token of the user are used
+// up, and all the refresh tokens of the user revoked, so whoever knew the old
+// password is logged out. It returns the ID of the user.
+func (s *Store) ResetPassword(tokenHash, hash, salt string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	query := `
+                SELECT id, user_id, expires_at, used_at
+                FROM password_reset_tokens
+                WHERE token_hash = $1
+                FOR UPDATE
+        `
+	var rt usermodel.PasswordResetToken
+	err = tx.QueryRow(ctx, query, tokenHash).Scan(&rt.ID, &rt.UserID, &rt.ExpiresAt, &rt.UsedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrResetTokenNotFound
+		}
+		return "", fmt.Errorf("failed to fetch password reset token: %w", err)
+	}
+
+	if rt.UsedAt != nil {
+		return "", ErrResetTokenUsed
+	}
+
+	now := time.Now()
+	if now.After(rt.ExpiresAt) {
+		return "", ErrResetTokenExpired
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE users SET password = $2, salt = $3, version = version + 1 WHERE id = $1`, rt.UserID, hash, salt)
+	if err != nil {
+		return "", fmt.Errorf("failed to update password: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE password_reset_tokens SET used_at = $2 WHERE user_id = $1 AND used_at IS NULL`, rt.UserID, now)
+	if err != nil {
+		return "", fmt.Errorf("failed to use password reset tokens: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE refresh_tokens SET revoked_at = $2 WHERE user_id = $1 AND revoked_at IS NULL`, rt.UserID, now)
+	if err != nil {
+		return "", fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return rt.UserID, nil
+}
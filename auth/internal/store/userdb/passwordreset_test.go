@@ -0,0 +1,83 @@
+package userdb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResetPassword(t *testing.T) {
+	columns := []string{"id", "user_id", "expires_at", "used_at"}
+
+	t.Run("Reset OK", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id, user_id, expires_at, used_at").
+			WithArgs("token-hash").
+			WillReturnRows(pgxmock.NewRows(columns).
+				AddRow("rt0", "user-1", time.Now().Add(time.Hour), nil))
+		mock.ExpectExec("UPDATE users SET password").
+			WithArgs("user-1", "hash", "salt").
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectExec("UPDATE password_reset_tokens SET used_at").
+			WithArgs("user-1", pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectExec("UPDATE refresh_tokens SET revoked_at").
+			WithArgs("user-1", pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 3))
+		mock.ExpectCommit()
+
+		store := userdb.NewStore(mock)
+		userID, err := store.ResetPassword("token-hash", "hash", "salt")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "user-1", userID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Used token", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		usedAt := time.Now().Add(-time.Minute)
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id, user_id, expires_at, used_at").
+			WithArgs("token-hash").
+			WillReturnRows(pgxmock.NewRows(columns).
+				AddRow("rt0", "user-1", time.Now().Add(time.Hour), &usedAt))
+		mock.ExpectRollback()
+
+		store := userdb.NewStore(mock)
+		_, err = store.ResetPassword("token-hash", "hash", "salt")
+
+		assert.ErrorIs(t, err, userdb.ErrResetTokenUsed)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Expired token", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id, user_id, expires_at, used_at").
+			WithArgs("token-hash").
+			WillReturnRows(pgxmock.NewRows(columns).
+				AddRow("rt0", "user-1", time.Now().Add(-time.Hour), nil))
+		mock.ExpectRollback()
+
+		store := userdb.NewStore(mock)
+		_, err = store.ResetPassword("token-hash", "hash", "salt")
+
+		assert.ErrorIs(t, err, userdb.ErrResetTokenExpired)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
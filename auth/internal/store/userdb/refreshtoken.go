@@ -0,0 +1,163 @@
+package userdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/pkg/uuid"
+)
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenExpired  = errors.New("refresh token expired")
+	ErrRefreshTokenRevoked  = errors.New("refresh token revoked")
+	ErrRefreshTokenReused   = errors.New("refresh token reused")
+)
+
+func (s *Store) CreateRefreshToken(rt usermodel.RefreshToken) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, created_at, expires_at)
+                VALUES ($1, $2, $3, $4, $5, $6)
+        `
+	_, err := s.db.Exec(ctx, query,
+		uuid.New(),
+		rt.UserID,
+		rt.FamilyID,
+		rt.TokenHash,
+		time.Now(),
+		rt.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// RotateRefreshToken exchanges the token with the given hash for next, which
+// joins the same family. Presenting a token that was already rotated means it
+// leaked, so the whole family is revoked and ErrRefreshTokenReused returned.
+// The returned token is the one that was exchanged. The session of the token
+// is marked as used from ip.
+func (s *Store) RotateRefreshToken(hash string, next usermodel.RefreshToken, ip string) (usermodel.RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return usermodel.RefreshToken{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	query := `
+                SELECT id, user_id, family_id, token_hash, created_at, expires_at, rotated_at, revoked_at
+                FROM refresh_tokens
+                WHERE token_hash = $1
+                FOR UPDATE
+        `
+	var rt usermodel.RefreshToken
+	err = tx.QueryRow(ctx, query, hash).Scan(
+		&rt.ID,
+		&rt.UserID,
+		&rt.FamilyID,
+		&rt.TokenHash,
+		&rt.CreatedAt,
+		&rt.ExpiresAt,
+		&rt.RotatedAt,
+		&rt.RevokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return usermodel.RefreshToken{}, ErrRefreshTokenNotFound
+		}
+		return usermodel.RefreshToken{}, fmt.Errorf("failed to fetch refresh token: %w", err)
+	}
+
+	if rt.RevokedAt != nil {
+		return usermodel.RefreshToken{}, ErrRefreshTokenRevoked
+	}
+
+	now := time.Now()
+	if rt.RotatedAt != nil {
+		if err := revokeFamily(ctx, tx, rt.FamilyID, now); err != nil {
+			return usermodel.RefreshToken{}, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return usermodel.RefreshToken{}, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return usermodel.RefreshToken{}, ErrRefreshTokenReused
+	}
+
+	if now.After(rt.ExpiresAt) {
+		return usermodel.RefreshToken{}, ErrRefreshTokenExpired
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE refresh_tokens SET rotated_at = $2 WHERE id = $1`, rt.ID, now)
+	if err != nil {
+		return usermodel.RefreshToken{}, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	insertQuery := `
+                INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, created_at, expires_at)
+                VALUES ($1, $2, $3, $4, $5, $6)
+        `
+	_, err = tx.Exec(ctx, insertQuery, uuid.New(), rt.UserID, rt.FamilyID, next.TokenHash, now, next.ExpiresAt)
+	if err != nil {
+		return usermodel.RefreshToken{}, fmt.Errorf("failed to insert refresh token: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE user_sessions SET last_used_at = $2, ip = $3 WHERE id = $1`, rt.FamilyID, now, ip)
+	if err != nil {
+		return usermodel.RefreshToken{}, fmt.Errorf("failed to update session: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return usermodel.RefreshToken{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return rt, nil
+}
+
+// RevokeRefreshToken revokes the family of the token with the given hash, so
+// neither it nor any token rotated from the same login can be used again.
+func (s *Store) RevokeRefreshToken(hash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	var familyID string
+	err := s.db.QueryRow(ctx, `SELECT family_id FROM refresh_tokens WHERE token_hash = $1`, hash).Scan(&familyID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrRefreshTokenNotFound
+		}
+		return fmt.Errorf("failed to fetch refresh token: %w", err)
+	}
+
+	return revokeFamily(ctx, s.db, familyID, time.Now())
+}
+
+type execer interface {
+	Exec(context.Context, string, ...any) (pgconn.CommandTag, error)
+}
+
+func revokeFamily(ctx context.Context, db execer, familyID string, now time.Time) error {
+	query := `
+               UPDATE refresh_tokens SET revoked_at = $2 WHERE family_id = $1 AND revoked_at IS NULL
+        `
+	_, err := db.Exec(ctx, query, familyID, now)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package userdb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotateRefreshToken(t *testing.T) {
+	columns := []string{"id", "user_id", "family_id", "token_hash", "created_at", "expires_at", "rotated_at", "revoked_at"}
+	next := usermodel.RefreshToken{TokenHash: "next-hash", ExpiresAt: time.Now().Add(time.Hour)}
+
+	t.Run("Rotate OK", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id, user_id, family_id").
+			WithArgs("old-hash").
+			WillReturnRows(pgxmock.NewRows(columns).
+				AddRow("ct0", "user-1", "family-1", "old-hash", time.Now(), time.Now().Add(time.Hour), nil, nil))
+		mock.ExpectExec("UPDATE refresh_tokens SET rotated_at").
+			WithArgs("ct0", pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectExec("INSERT INTO refresh_tokens").
+			WithArgs(pgxmock.AnyArg(), "user-1", "family-1", "next-hash", pgxmock.AnyArg(), next.ExpiresAt).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		mock.ExpectExec("UPDATE user_sessions SET last_used_at").
+			WithArgs("family-1", pgxmock.AnyArg(), "10.0.0.1").
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectCommit()
+
+		store := userdb.NewStore(mock)
+		old, err := store.RotateRefreshToken("old-hash", next, "10.0.0.1")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "user-1", old.UserID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Reuse revokes the family", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		rotatedAt := time.Now().Add(-time.Minute)
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id, user_id, family_id").
+			WithArgs("old-hash").
+			WillReturnRows(pgxmock.NewRows(columns).
+				AddRow("ct0", "user-1", "family-1", "old-hash", time.Now(), time.Now().Add(time.Hour), &rotatedAt, nil))
+		mock.ExpectExec("UPDATE refresh_tokens SET revoked_at").
+			WithArgs("family-1", pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 2))
+		mock.ExpectCommit()
+
+		store := userdb.NewStore(mock)
+		_, err = store.RotateRefreshToken("old-hash", next, "10.0.0.1")
+
+		assert.ErrorIs(t, err, userdb.ErrRefreshTokenReused)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Expired token", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id, user_id, family_id").
+			WithArgs("old-hash").
+			WillReturnRows(pgxmock.NewRows(columns).
+				AddRow("ct0", "user-1", "family-1", "old-hash", time.Now(), time.Now().Add(-time.Hour), nil, nil))
+		mock.ExpectRollback()
+
+		store := userdb.NewStore(mock)
+		_, err = store.RotateRefreshToken("old-hash", next, "10.0.0.1")
+
+		assert.ErrorIs(t, err, userdb.ErrRefreshTokenExpired)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
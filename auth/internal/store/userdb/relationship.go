@@ -0,0 +1,248 @@
+package userdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/pkg/uuid"
+)
+
+var (
+	ErrBlocked       = errors.New("user blocked")
+	ErrBlockNotFound = errors.New("block not found")
+	ErrMuteNotFound  = errors.New("mute not found")
+	ErrSelfRelation  = errors.New("users can't block or mute themselves")
+)
+
+// Block makes rel.UserID block rel.TargetID. The follows and follow requests
+// between both users are removed in the same transaction and can't be
+// created again while the block exists. Blocking twice returns the existing
+// block and created false.
+func (s *Store) Block(rel usermodel.Relationship) (usermodel.Relationship, bool, error) {
+	if rel.UserID == rel.TargetID {
+		return usermodel.Relationship{}, false, ErrSelfRelation
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return usermodel.Relationship{}, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	rel, created, err := addRelationship(ctx, tx, "user_blocks", rel)
+	if err != nil || !created {
+		return rel, false, err
+	}
+
+	for _, follow := range []usermodel.UserFollowers{
+		{UserID: rel.UserID, FollowerID: rel.TargetID},
+		{UserID: rel.TargetID, FollowerID: rel.UserID},
+	} {
+		query := `
+                        DELETE FROM user_followers WHERE user_id = $1 AND follower_id = $2
+                `
+		tag, err := tx.Exec(ctx, query, follow.UserID, follow.FollowerID)
+		if err != nil {
+			return usermodel.Relationship{}, false, fmt.Errorf("failed to delete follow: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			continue
+		}
+		if err := updateFollowCounts(ctx, tx, follow, -1); err != nil {
+			return usermodel.Relationship{}, false, err
+		}
+	}
+
+	query := `
+                DELETE FROM follow_requests
+                WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1)
+        `
+	if _, err := tx.Exec(ctx, query, rel.UserID, rel.TargetID); err != nil {
+		return usermodel.Relationship{}, false, fmt.Errorf("failed to delete follow requests: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return usermodel.Relationship{}, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return rel, true, nil
+}
+
+// Unblock removes the block, ErrBlockNotFound is returned when there is none.
+func (s *Store) Unblock(rel usermodel.Relationship) error {
+	return s.removeRelationship("user_blocks", rel, ErrBlockNotFound)
+}
+
+// Mute hides the tweets of rel.TargetID from the timeline of rel.UserID
+// without them knowing. Muting twice returns the existing mute and created
+// false.
+func (s *Store) Mute(rel usermodel.Relationship) (usermodel.Relationship, bool, error) {
+	if rel.UserID == rel.TargetID {
+		return usermodel.Relationship{}, false, ErrSelfRelation
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	return addRelationship(ctx, s.db, "user_mutes", rel)
+}
+
+// Unmute removes the mute, ErrMuteNotFound is returned when there is none.
+func (s *Store) Unmute(rel usermodel.Relationship) error {
+	return s.removeRelationship("user_mutes", rel, ErrMuteNotFound)
+}
+
+// GetBlocked returns a page of the users blocked by userID, most recent
+// first.
+func (s *Store) GetBlocked(userID, cursor string, limit int) (usermodel.UserPage, error) {
+	query := `
+                SELECT r.id, u.id, u.username, u.display_name, u.avatar_url, u.follower_count, u.following_count
+                FROM user_blocks r
+                JOIN users u ON u.id = r.target_id
+                WHERE r.user_id = $1 AND ($2 = '' OR r.id < $2)
+                ORDER BY r.id DESC
+                LIMIT $3
+        `
+	return s.userPage(query, userID, cursor, limit)
+}
+
+// GetMuted returns a page of the users muted by userID, most recent first.
+func (s *Store) GetMuted(userID, cursor string, limit int) (usermodel.UserPage, error) {
+	query := `
+                SELECT r.id, u.id, u.username, u.display_name, u.avatar_url, u.follower_count, u.following_count
+                FROM user_mutes r
+                JOIN users u ON u.id = r.target_id
+                WHERE r.user_id = $1 AND ($2 = '' OR r.id < $2)
+                ORDER BY r.id DESC
+                LIMIT $3
+        `
+	return s.userPage(query, userID, cursor, limit)
+}
+
+type queryRower interface {
+	QueryRow(context.Context, string, ...interface{}) pgx.Row
+}
+
+// addRelationship inserts rel in table, user_blocks or user_mutes, or returns
+// the existing row with created false.
+func addRelationship(ctx context.Context, db queryRower, table string, rel usermodel.Relationship) (usermodel.Relationship, bool, error) {
+	query := `
+                INSERT INTO ` + table + ` (id, user_id, target_id, created_at) VALUES ($1, $2, $3, $4)
+                ON CONFLICT (user_id, target_id) DO NOTHING
+                RETURNING id, created_at
+        `
+	err := db.QueryRow(ctx, query, uuid.New(), rel.UserID, rel.TargetID, time.Now()).Scan(&rel.ID, &rel.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		query = `
+                        SELECT id, created_at FROM ` + table + ` WHERE user_id = $1 AND target_id = $2
+                `
+		err = db.QueryRow(ctx, query, rel.UserID, rel.TargetID).Scan(&rel.ID, &rel.CreatedAt)
+		if err != nil {
+			return usermodel.Relationship{}, false, fmt.Errorf("failed to fetch %s: %w", table, err)
+		}
+		return rel, false, nil
+	}
+	if err != nil {
+		var pgErr *pgconn.PgError
+		// 23503 is foreign_key_violation
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return usermodel.Relationship{}, false, ErrUserNotFound
+		}
+		return usermodel.Relationship{}, false, fmt.Errorf("failed to insert %s: %w", table, err)
+	}
+
+	return rel, true, nil
+}
+
+func (s *Store) removeRelationship(table string, rel usermodel.Relationship, notFound error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                DELETE FROM ` + table + ` WHERE user_id = $1 AND target_id = $2
+        `
+	tag, err := s.db.Exec(ctx, query, rel.UserID, rel.TargetID)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %w", table, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound
+	}
+
+	return nil
+}
+
+// blockedBetween reports whether any of the users blocked the other.
+func blockedBetween(ctx context.Context, db queryRower, userID, otherID string) (bool, error) {
+	query := `
+                SELECT EXISTS (
+                    SELECT 1 FROM user_blocks
+                    WHERE (user_id = $1 AND target_id = $2) OR (user_id = $2 AND target_id = $1)
+                )
+        `
+	var blocked bool
+	if err := db.QueryRow(ctx, query, userID, otherID).Scan(&blocked); err != nil {
+		return false, fmt.Errorf("failed to fetch blocks: %w", err)
+	}
+
+	return blocked, nil
+}
+
+// GetRelationships returns how userID relates to each of the targets, in the
+// order given, with a single query. Targets that don't exist are left out.
+func (s *Store) GetRelationships(userID string, targetIDs []string) ([]usermodel.RelationshipStatus, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                SELECT t.id,
+                    EXISTS (SELECT 1 FROM user_followers f WHERE f.user_id = t.id AND f.follower_id = $1),
+                    EXISTS (SELECT 1 FROM user_followers f WHERE f.user_id = $1 AND f.follower_id = t.id),
+                    EXISTS (SELECT 1 FROM follow_requests fr WHERE fr.user_id = t.id AND fr.follower_id = $1),
+                    EXISTS (SELECT 1 FROM follow_requests fr WHERE fr.user_id = $1 AND fr.follower_id = t.id),
+                    EXISTS (SELECT 1 FROM user_blocks b WHERE b.user_id = $1 AND b.target_id = t.id),
+                    EXISTS (SELECT 1 FROM user_blocks b WHERE b.user_id = t.id AND b.target_id = $1),
+                    EXISTS (SELECT 1 FROM user_mutes m WHERE m.user_id = $1 AND m.target_id = t.id)
+                FROM unnest($2::text[]) WITH ORDINALITY AS t(id, position)
+                JOIN users u ON u.id = t.id
+                ORDER BY t.position
+        `
+	rows, err := s.db.Query(ctx, query, userID, targetIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query relationships: %w", err)
+	}
+	defer rows.Close()
+
+	statuses := []usermodel.RelationshipStatus{}
+	for rows.Next() {
+		var status usermodel.RelationshipStatus
+		err := rows.Scan(
+			&status.TargetID,
+			&status.Following,
+			&status.FollowedBy,
+			&status.FollowRequested,
+			&status.FollowRequestReceived,
+			&status.Blocking,
+			&status.BlockedBy,
+			&status.Muting)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan relationship: %w", err)
+		}
+		statuses = append(statuses, status)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read relationships: %w", err)
+	}
+
+	return statuses, nil
+}
@@ -0,0 +1,114 @@
+package userdb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlock(t *testing.T) {
+	rel := usermodel.Relationship{UserID: "user-1", TargetID: "user-2"}
+
+	t.Run("Block removes follows both ways", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO user_blocks").
+			WithArgs(pgxmock.AnyArg(), "user-1", "user-2", pgxmock.AnyArg()).
+			WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow("block-1", time.Now()))
+		// user-2 follows user-1
+		mock.ExpectExec("DELETE FROM user_followers").
+			WithArgs("user-1", "user-2").
+			WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		mock.ExpectExec("UPDATE users SET follower_count").
+			WithArgs("user-1", -1).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectExec("UPDATE users SET following_count").
+			WithArgs("user-2", -1).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		// user-1 doesn't follow user-2
+		mock.ExpectExec("DELETE FROM user_followers").
+			WithArgs("user-2", "user-1").
+			WillReturnResult(pgxmock.NewResult("DELETE", 0))
+		mock.ExpectExec("DELETE FROM follow_requests").
+			WithArgs("user-1", "user-2").
+			WillReturnResult(pgxmock.NewResult("DELETE", 0))
+		mock.ExpectCommit()
+
+		store := userdb.NewStore(mock)
+		got, created, err := store.Block(rel)
+
+		assert.NoError(t, err)
+		assert.True(t, created)
+		assert.Equal(t, "block-1", got.ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Repeated block returns the existing one", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO user_blocks").
+			WithArgs(pgxmock.AnyArg(), "user-1", "user-2", pgxmock.AnyArg()).
+			WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}))
+		mock.ExpectQuery("SELECT id, created_at FROM user_blocks").
+			WithArgs("user-1", "user-2").
+			WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow("block-1", time.Now()))
+		mock.ExpectRollback()
+
+		store := userdb.NewStore(mock)
+		got, created, err := store.Block(rel)
+
+		assert.NoError(t, err)
+		assert.False(t, created)
+		assert.Equal(t, "block-1", got.ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUnmute(t *testing.T) {
+	mock, err := pgxmock.NewConn()
+	assert.NoError(t, err)
+	defer mock.Close(context.Background())
+
+	mock.ExpectExec("DELETE FROM user_mutes").
+		WithArgs("user-1", "user-2").
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+
+	store := userdb.NewStore(mock)
+	err = store.Unmute(usermodel.Relationship{UserID: "user-1", TargetID: "user-2"})
+
+	assert.ErrorIs(t, err, userdb.ErrMuteNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetRelationships(t *testing.T) {
+	mock, err := pgxmock.NewConn()
+	assert.NoError(t, err)
+	defer mock.Close(context.Background())
+
+	targets := []string{"user-2", "user-3", "missing"}
+	mock.ExpectQuery("FROM unnest").
+		WithArgs("user-1", targets).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "following", "followed_by", "follow_requested", "follow_request_received", "blocking", "blocked_by", "muting"}).
+			AddRow("user-2", true, true, false, false, false, false, true).
+			AddRow("user-3", false, false, true, false, false, false, false))
+
+	store := userdb.NewStore(mock)
+	statuses, err := store.GetRelationships("user-1", targets)
+
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 2)
+	assert.Equal(t, usermodel.RelationshipStatus{TargetID: "user-2", Following: true, FollowedBy: true, Muting: true}, statuses[0])
+	assert.True(t, statuses[1].FollowRequested)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,165 @@
+package userdb
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// searchCursor is the position of the last user of a page in the ranking of
+// SearchUsers. The next page starts after it, however deep it is.
+type searchCursor struct {
+	Exact         bool    `json:"e"`
+	Followed      bool    `json:"f"`
+	Prefix        bool    `json:"p"`
+	FollowerCount int     `json:"c"`
+	Similarity    float32 `json:"s"`
+	ID            string  `json:"i"`
+}
+
+func (c searchCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSearchCursor(cursor string) (searchCursor, error) {
+	var c searchCursor
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || json.Unmarshal(b, &c) != nil || c.ID == "" {
+		return searchCursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// SearchUsers returns a page of the users whose username or display name
+// starts with or looks like q, ignoring case. Exact matches come first, then
+// users the caller follows, prefix matches, popular users and the closest
+// fuzzy matches. Suspended users and users who blocked the caller are left
+// out. callerID is empty for anonymous searches. The cursor is opaque to
+// clients, it holds the ranking of the last user returned.
+func (s *Store) SearchUsers(q, callerID, cursor string, limit int) (usermodel.UserPage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	var after searchCursor
+	if cursor != "" {
+		var err error
+		after, err = decodeSearchCursor(cursor)
+		if err != nil {
+			return usermodel.UserPage{}, err
+		}
+	}
+
+	q = strings.ToLower(q)
+	query := `
+                SELECT id, username, display_name, avatar_url, follower_count, following_count, exact, followed, prefix, similarity
+                FROM (
+                        SELECT u.id, u.username, u.display_name, u.avatar_url, u.follower_count, u.following_count,
+                               lower(u.username) = $1 AS exact,
+                               EXISTS (SELECT 1 FROM user_followers f WHERE f.user_id = u.id AND f.follower_id = $3) AS followed,
+                               (lower(u.username) LIKE $2 ESCAPE '\' OR lower(u.display_name) LIKE $2 ESCAPE '\') AS prefix,
+                               GREATEST(similarity(lower(u.username), $1), similarity(lower(u.display_name), $1)) AS similarity
+                        FROM users u
+                        WHERE (lower(u.username) LIKE $2 ESCAPE '\' OR lower(u.username) % $1
+                               OR lower(u.display_name) LIKE $2 ESCAPE '\' OR lower(u.display_name) % $1)
+                        AND u.suspended_at IS NULL
+                        AND NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.user_id = u.id AND b.target_id = $3)
+                ) m
+                WHERE $4 = '' OR (exact, followed, prefix, follower_count, similarity, id) < ($5, $6, $7, $8, $9, $4)
+                ORDER BY exact DESC, followed DESC, prefix DESC, follower_count DESC, similarity DESC, id DESC
+                LIMIT $10
+        `
+	rows, err := s.db.Query(ctx, query, q, likePrefix(q), callerID,
+		after.ID, after.Exact, after.Followed, after.Prefix, after.FollowerCount, after.Similarity, limit+1)
+	if err != nil {
+		return usermodel.UserPage{}, fmt.Errorf("failed to search users: %w", err)
+	}
+	defer rows.Close()
+
+	page := usermodel.UserPage{Users: []usermodel.UserSummary{}}
+	var last searchCursor
+	for rows.Next() {
+		var user usermodel.UserSummary
+		var rank searchCursor
+		err := rows.Scan(&user.ID, &user.UserName, &user.DisplayName, &user.AvatarURL, &user.FollowerCount, &user.FollowingCount,
+			&rank.Exact, &rank.Followed, &rank.Prefix, &rank.Similarity)
+		if err != nil {
+			return usermodel.UserPage{}, fmt.Errorf("failed to scan user: %w", err)
+		}
+
+		if len(page.Users) == limit {
+			page.NextCursor = last.encode()
+			break
+		}
+		rank.ID = user.ID
+		rank.FollowerCount = user.FollowerCount
+		page.Users = append(page.Users, user)
+		last = rank
+	}
+	if err := rows.Err(); err != nil {
+		return usermodel.UserPage{}, fmt.Errorf("failed to search users: %w", err)
+	}
+
+	return page, nil
+}
+
+// TypeaheadUsers returns the few users whose username or display name starts
+// with q, ranked like SearchUsers. It only matches prefixes, which the
+// indexes answer quickly enough to run on every keystroke.
+func (s *Store) TypeaheadUsers(q, callerID string, limit int) ([]usermodel.UserSummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	q = strings.ToLower(q)
+	query := `
+                SELECT u.id, u.username, u.display_name, u.avatar_url, u.follower_count, u.following_count
+                FROM users u
+                WHERE (lower(u.username) LIKE $2 ESCAPE '\' OR lower(u.display_name) LIKE $2 ESCAPE '\')
+                AND u.suspended_at IS NULL
+                AND NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.user_id = u.id AND b.target_id = $3)
+                ORDER BY lower(u.username) = $1 DESC,
+                         EXISTS (SELECT 1 FROM user_followers f WHERE f.user_id = u.id AND f.follower_id = $3) DESC,
+                         u.follower_count DESC,
+                         u.id
+                LIMIT $4
+        `
+	rows, err := s.db.Query(ctx, query, q, likePrefix(q), callerID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+
+	return scanSummaries(rows)
+}
+
+// likePrefix returns a LIKE pattern matching the strings that start with q.
+func likePrefix(q string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(q) + "%"
+}
+
+func scanSummaries(rows pgx.Rows) ([]usermodel.UserSummary, error) {
+	defer rows.Close()
+
+	users := []usermodel.UserSummary{}
+	for rows.Next() {
+		var user usermodel.UserSummary
+		if err := rows.Scan(&user.ID, &user.UserName, &user.DisplayName, &user.AvatarURL, &user.FollowerCount, &user.FollowingCount); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+
+	return users, nil
+}
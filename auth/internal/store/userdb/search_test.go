@@ -0,0 +1,60 @@
+package userdb_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchUsers(t *testing.T) {
+	columns := []string{"id", "username", "display_name", "avatar_url", "follower_count", "following_count", "exact", "followed", "prefix", "similarity"}
+
+	t.Run("Pages follow the ranking", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectQuery(`(?s)SELECT id, username.*u\.suspended_at IS NULL`).
+			WithArgs("jack_", `jack\_%`, "user-1", "", false, false, false, 0, float32(0), 3).
+			WillReturnRows(pgxmock.NewRows(columns).
+				AddRow("user-2", "Jack_", "", "", 10, 1, true, false, true, float32(1)).
+				AddRow("user-3", "jack_gris", "", "", 5, 2, false, true, true, float32(0.5)).
+				AddRow("user-4", "jacky", "", "", 1, 0, false, false, true, float32(0.3)))
+		mock.ExpectQuery(`(?s)SELECT id, username.*u\.suspended_at IS NULL`).
+			WithArgs("jack_", `jack\_%`, "user-1", "user-3", false, true, true, 5, float32(0.5), 3).
+			WillReturnRows(pgxmock.NewRows(columns).
+				AddRow("user-4", "jacky", "", "", 1, 0, false, false, true, float32(0.3)))
+
+		store := userdb.NewStore(mock)
+		page, err := store.SearchUsers("Jack_", "user-1", "", 2)
+
+		assert.NoError(t, err)
+		assert.Len(t, page.Users, 2)
+		assert.Equal(t, "Jack_", page.Users[0].UserName)
+		assert.NotEmpty(t, page.NextCursor)
+
+		page, err = store.SearchUsers("Jack_", "user-1", page.NextCursor, 2)
+
+		assert.NoError(t, err)
+		assert.Len(t, page.Users, 1)
+		assert.Equal(t, "jacky", page.Users[0].UserName)
+		assert.Empty(t, page.NextCursor)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Invalid cursor", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		store := userdb.NewStore(mock)
+		for _, cursor := range []string{"-1", "2", "bm90IGpzb24"} {
+			_, err = store.SearchUsers("jack", "", cursor, 2)
+			assert.ErrorIs(t, err, userdb.ErrInvalidCursor)
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
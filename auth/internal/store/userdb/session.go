@@ -0,0 +1,148 @@
+package userdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/pkg/uuid"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// CreateSession starts a session with its first refresh token, the session
+// ID is the family ID of the token.
+func (s *Store) CreateSession(session usermodel.Session, rt usermodel.RefreshToken) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	now := time.Now()
+	query := `
+                INSERT INTO user_sessions (id, user_id, user_agent, ip, created_at, last_used_at)
+                VALUES ($1, $2, $3, $4, $5, $5)
+        `
+	_, err = tx.Exec(ctx, query, rt.FamilyID, rt.UserID, session.UserAgent, session.IP, now)
+	if err != nil {
+		return fmt.Errorf("failed to insert session: %w", err)
+	}
+
+	query = `
+                INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, created_at, expires_at)
+                VALUES ($1, $2, $3, $4, $5, $6)
+        `
+	_, err = tx.Exec(ctx, query, uuid.New(), rt.UserID, rt.FamilyID, rt.TokenHash, now, rt.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert refresh token: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ListSessions returns the sessions of the user that can still refresh their
+// tokens, the most recently used first. Sessions end when their tokens are
+// revoked or expire.
+func (s *Store) ListSessions(userID string) ([]usermodel.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                SELECT s.id, s.user_id, s.user_agent, s.ip, s.created_at, s.last_used_at
+                FROM user_sessions s
+                WHERE s.user_id = $1
+                AND EXISTS (
+                    SELECT 1 FROM refresh_tokens rt
+                    WHERE rt.family_id = s.id AND rt.revoked_at IS NULL AND rt.rotated_at IS NULL AND rt.expires_at > $2
+                )
+                ORDER BY s.last_used_at DESC
+        `
+	rows, err := s.db.Query(ctx, query, userID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []usermodel.Session{}
+	for rows.Next() {
+		var session usermodel.Session
+		err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastUsedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession revokes the refresh tokens of a session of the user, so it
+// can't refresh its access token anymore.
+func (s *Store) RevokeSession(userID, sessionID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                UPDATE refresh_tokens SET revoked_at = $3
+                WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL
+        `
+	tag, err := s.db.Exec(ctx, query, userID, sessionID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// RevokeOtherSessions logs the user out of every session but sessionID.
+func (s *Store) RevokeOtherSessions(userID, sessionID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                UPDATE refresh_tokens SET revoked_at = $3
+                WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL
+        `
+	_, err := s.db.Exec(ctx, query, userID, sessionID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeAllSessions logs the user out everywhere.
+func (s *Store) RevokeAllSessions(userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                UPDATE refresh_tokens SET revoked_at = $2
+                WHERE user_id = $1 AND revoked_at IS NULL
+        `
+	_, err := s.db.Exec(ctx, query, userID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	return nil
+}
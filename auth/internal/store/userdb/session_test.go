@@ -0,0 +1,101 @@
+package userdb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateSession(t *testing.T) {
+	mock, err := pgxmock.NewConn()
+	assert.NoError(t, err)
+	defer mock.Close(context.Background())
+
+	rt := usermodel.RefreshToken{UserID: "user-1", FamilyID: "family-1", TokenHash: "hash", ExpiresAt: time.Now().Add(time.Hour)}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO user_sessions").
+		WithArgs("family-1", "user-1", "curl/8.0", "10.0.0.1", pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec("INSERT INTO refresh_tokens").
+		WithArgs(pgxmock.AnyArg(), "user-1", "family-1", "hash", pgxmock.AnyArg(), rt.ExpiresAt).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+
+	store := userdb.NewStore(mock)
+	err = store.CreateSession(usermodel.Session{UserAgent: "curl/8.0", IP: "10.0.0.1"}, rt)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListSessions(t *testing.T) {
+	mock, err := pgxmock.NewConn()
+	assert.NoError(t, err)
+	defer mock.Close(context.Background())
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT s.id, s.user_id, s.user_agent, s.ip").
+		WithArgs("user-1", pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "user_id", "user_agent", "ip", "created_at", "last_used_at"}).
+			AddRow("family-2", "user-1", "Firefox", "10.0.0.2", now, now).
+			AddRow("family-1", "user-1", "curl/8.0", "10.0.0.1", now.Add(-time.Hour), now.Add(-time.Minute)))
+
+	store := userdb.NewStore(mock)
+	sessions, err := store.ListSessions("user-1")
+
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 2)
+	assert.Equal(t, "family-2", sessions[0].ID)
+	assert.Equal(t, "10.0.0.1", sessions[1].IP)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRevokeSession(t *testing.T) {
+	t.Run("Revoke OK", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectExec("UPDATE refresh_tokens SET revoked_at").
+			WithArgs("user-1", "family-1", pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 2))
+
+		store := userdb.NewStore(mock)
+		assert.NoError(t, store.RevokeSession("user-1", "family-1"))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Session of someone else", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectExec("UPDATE refresh_tokens SET revoked_at").
+			WithArgs("user-2", "family-1", pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+		store := userdb.NewStore(mock)
+		assert.ErrorIs(t, store.RevokeSession("user-2", "family-1"), userdb.ErrSessionNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	mock, err := pgxmock.NewConn()
+	assert.NoError(t, err)
+	defer mock.Close(context.Background())
+
+	mock.ExpectExec(`UPDATE refresh_tokens SET revoked_at = \$3\s+WHERE user_id = \$1 AND family_id <> \$2`).
+		WithArgs("user-1", "family-1", pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 3))
+
+	store := userdb.NewStore(mock)
+	assert.NoError(t, store.RevokeOtherSessions("user-1", "family-1"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
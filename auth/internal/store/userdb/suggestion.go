@@ -0,0 +1,281 @@
+package userdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+)
+
+// suggestionFilter drops the candidates who are suspended, and the ones the
+// user followed, asked to follow, blocked, was blocked by or dismissed since
+// the suggestions were computed. $1 is the user and c.id the candidate.
+const suggestionFilter = `
+                c.id <> $1
+                AND c.suspended_at IS NULL
+                AND NOT EXISTS (SELECT 1 FROM user_followers uf WHERE uf.user_id = c.id AND uf.follower_id = $1)
+                AND NOT EXISTS (SELECT 1 FROM follow_requests fr WHERE fr.user_id = c.id AND fr.follower_id = $1)
+                AND NOT EXISTS (
+                    SELECT 1 FROM user_blocks b
+                    WHERE (b.user_id = $1 AND b.target_id = c.id) OR (b.user_id = c.id AND b.target_id = $1)
+                )
+                AND NOT EXISTS (SELECT 1 FROM suggestion_dismissals d WHERE d.user_id = $1 AND d.candidate_id = c.id)
+`
+
+// GetSuggestions returns up to limit users for userID to follow, the best
+// first. They are read from the table RefreshSuggestions fills. Users without
+// suggestions yet, like new users who don't follow anybody, get the most
+// followed users instead.
+func (s *Store) GetSuggestions(userID string, limit int) ([]usermodel.Suggestion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                SELECT c.id, c.username, c.display_name, c.avatar_url, c.follower_count, c.following_count, s.score, s.friends_of_friends, s.mutual_followers
+                FROM user_suggestions s
+                JOIN users c ON c.id = s.candidate_id
+                WHERE s.user_id = $1 AND ` + suggestionFilter + `
+                ORDER BY s.score DESC, c.id
+                LIMIT $2
+        `
+	suggestions, err := s.scanSuggestions(ctx, query, userID, limit)
+	if err != nil || len(suggestions) > 0 {
+		return suggestions, err
+	}
+
+	query = `
+                SELECT c.id, c.username, c.display_name, c.avatar_url, c.follower_count, c.following_count, LN(1 + c.follower_count), 0, 0
+                FROM users c
+                WHERE ` + suggestionFilter + `
+                ORDER BY c.follower_count DESC, c.id
+                LIMIT $2
+        `
+	return s.scanSuggestions(ctx, query, userID, limit)
+}
+
+func (s *Store) scanSuggestions(ctx context.Context, query, userID string, limit int) ([]usermodel.Suggestion, error) {
+	rows, err := s.db.Query(ctx, query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query suggestions: %w", err)
+	}
+	defer rows.Close()
+
+	suggestions := []usermodel.Suggestion{}
+	for rows.Next() {
+		var sg usermodel.Suggestion
+		err := rows.Scan(
+			&sg.User.ID,
+			&sg.User.UserName,
+			&sg.User.DisplayName,
+			&sg.User.AvatarURL,
+			&sg.User.FollowerCount,
+			&sg.User.FollowingCount,
+			&sg.Score,
+			&sg.FriendsOfFriends,
+			&sg.MutualFollowers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan suggestion: %w", err)
+		}
+		suggestions = append(suggestions, sg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read suggestions: %w", err)
+	}
+
+	return suggestions, nil
+}
+
+// DismissSuggestion stops suggesting candidateID to userID.
+func (s *Store) DismissSuggestion(userID, candidateID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	query := `
+                INSERT INTO suggestion_dismissals (user_id, candidate_id, created_at)
+                VALUES ($1, $2, $3)
+                ON CONFLICT (user_id, candidate_id) DO NOTHING
+        `
+	_, err = tx.Exec(ctx, query, userID, candidateID, time.Now())
+	if err != nil {
+		// 23503 is foreign_key_violation
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("failed to dismiss suggestion: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM user_suggestions WHERE user_id = $1 AND candidate_id = $2`, userID, candidateID)
+	if err != nil {
+		return fmt.Errorf("failed to delete suggestion: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// suggestionsLock is the advisory lock held while refreshing the suggestions.
+const suggestionsLock int64 = 0x5375676765737473
+
+// RefreshSuggestions recomputes the suggestions of every user, keeping the
+// best perUser of each, and returns how many were saved. Candidates are the
+// users followed by the users someone follows (friends of friends) and the
+// users who share followers with them. They are ranked by how many friends
+// of friends and mutual followers they have, and by their popularity. Users
+// are refreshed batch users at a time, each batch in its own short
+// transaction, so readers see either the old or the new suggestions of a
+// user and the job never holds the whole table.
+func (s *Store) RefreshSuggestions(perUser, batch int) (int64, error) {
+	var saved int64
+	after := ""
+	for {
+		userIDs, err := s.suggestionUsers(after, batch)
+		if err != nil {
+			return saved, err
+		}
+		if len(userIDs) == 0 {
+			return saved, nil
+		}
+
+		n, locked, err := s.refreshSuggestionsOf(userIDs, perUser)
+		if err != nil {
+			return saved, err
+		}
+		if !locked {
+			// Another replica is refreshing a batch. The lock is taken per
+			// batch, so that replica may be anywhere in its own run, which
+			// goes over every user, and this run stops where it is
+			return saved, nil
+		}
+
+		saved += n
+		after = userIDs[len(userIDs)-1]
+	}
+}
+
+// suggestionUsers returns the IDs of the next limit users after the ID
+// after, in order.
+func (s *Store) suggestionUsers(after string, limit int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	rows, err := s.db.Query(ctx, `SELECT id FROM users WHERE id > $1 ORDER BY id LIMIT $2`, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		userIDs = append(userIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read users: %w", err)
+	}
+
+	return userIDs, nil
+}
+
+// refreshSuggestionsOf replaces the suggestions of the users in one
+// transaction. It returns false without doing anything when another replica
+// is refreshing a batch.
+func (s *Store) refreshSuggestionsOf(userIDs []string, perUser int) (int64, bool, error) {
+	// A batch goes over the follows of many users, it gets more time than
+	// the queries of the requests
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	var locked bool
+	err = tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock($1)`, suggestionsLock).Scan(&locked)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to lock suggestions: %w", err)
+	}
+	if !locked {
+		return 0, false, nil
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM user_suggestions WHERE user_id = ANY($1)`, userIDs)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to delete suggestions: %w", err)
+	}
+
+	query := `
+                WITH friends_of_friends AS (
+                    SELECT mine.follower_id AS user_id, theirs.user_id AS candidate_id, COUNT(*) AS n
+                    FROM user_followers mine
+                    JOIN user_followers theirs ON theirs.follower_id = mine.user_id
+                    WHERE mine.follower_id = ANY($3)
+                    GROUP BY 1, 2
+                ), mutual_followers AS (
+                    SELECT a.user_id AS user_id, b.user_id AS candidate_id, COUNT(*) AS n
+                    FROM user_followers a
+                    JOIN user_followers b ON b.follower_id = a.follower_id AND b.user_id <> a.user_id
+                    WHERE a.user_id = ANY($3)
+                    GROUP BY 1, 2
+                ), candidates AS (
+                    SELECT COALESCE(f.user_id, m.user_id) AS user_id,
+                           COALESCE(f.candidate_id, m.candidate_id) AS candidate_id,
+                           COALESCE(f.n, 0) AS friends_of_friends,
+                           COALESCE(m.n, 0) AS mutual_followers
+                    FROM friends_of_friends f
+                    FULL JOIN mutual_followers m ON m.user_id = f.user_id AND m.candidate_id = f.candidate_id
+                ), ranked AS (
+                    SELECT k.user_id, k.candidate_id, k.friends_of_friends, k.mutual_followers,
+                           3 * k.friends_of_friends + 2 * k.mutual_followers + LN(1 + c.follower_count) AS score
+                    FROM candidates k
+                    JOIN users c ON c.id = k.candidate_id
+                    WHERE k.user_id <> k.candidate_id
+                    AND c.suspended_at IS NULL
+                    AND NOT EXISTS (SELECT 1 FROM user_followers uf WHERE uf.user_id = k.candidate_id AND uf.follower_id = k.user_id)
+                    AND NOT EXISTS (SELECT 1 FROM follow_requests fr WHERE fr.user_id = k.candidate_id AND fr.follower_id = k.user_id)
+                    AND NOT EXISTS (
+                        SELECT 1 FROM user_blocks b
+                        WHERE (b.user_id = k.user_id AND b.target_id = k.candidate_id) OR (b.user_id = k.candidate_id AND b.target_id = k.user_id)
+                    )
+                    AND NOT EXISTS (SELECT 1 FROM suggestion_dismissals d WHERE d.user_id = k.user_id AND d.candidate_id = k.candidate_id)
+                ), top AS (
+                    SELECT *, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY score DESC, candidate_id) AS position
+                    FROM ranked
+                )
+                INSERT INTO user_suggestions (user_id, candidate_id, score, friends_of_friends, mutual_followers, computed_at)
+                SELECT user_id, candidate_id, score, friends_of_friends, mutual_followers, $2
+                FROM top
+                WHERE position <= $1
+        `
+	tag, err := tx.Exec(ctx, query, perUser, time.Now(), userIDs)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to compute suggestions: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return tag.RowsAffected(), true, nil
+}
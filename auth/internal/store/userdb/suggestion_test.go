@@ -0,0 +1,125 @@
+package userdb_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetSuggestions(t *testing.T) {
+	columns := []string{"id", "username", "display_name", "avatar_url", "follower_count", "following_count", "score", "friends_of_friends", "mutual_followers"}
+
+	t.Run("Precomputed suggestions", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectQuery(`(?s)FROM user_suggestions s.*c\.suspended_at IS NULL`).
+			WithArgs("user-1", 10).
+			WillReturnRows(pgxmock.NewRows(columns).
+				AddRow("user-2", "mary", "Mary", "", 20, 5, 9.5, 2, 1))
+
+		store := userdb.NewStore(mock)
+		suggestions, err := store.GetSuggestions("user-1", 10)
+
+		assert.NoError(t, err)
+		assert.Len(t, suggestions, 1)
+		assert.Equal(t, "mary", suggestions[0].User.UserName)
+		assert.Equal(t, 2, suggestions[0].FriendsOfFriends)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Popular users without suggestions", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectQuery(`(?s)FROM user_suggestions s.*c\.suspended_at IS NULL`).
+			WithArgs("user-1", 10).
+			WillReturnRows(pgxmock.NewRows(columns))
+		mock.ExpectQuery(`(?s)c\.suspended_at IS NULL.*ORDER BY c\.follower_count DESC`).
+			WithArgs("user-1", 10).
+			WillReturnRows(pgxmock.NewRows(columns).
+				AddRow("user-3", "famous", "", "", 1000, 1, 6.9, 0, 0))
+
+		store := userdb.NewStore(mock)
+		suggestions, err := store.GetSuggestions("user-1", 10)
+
+		assert.NoError(t, err)
+		assert.Len(t, suggestions, 1)
+		assert.Equal(t, "famous", suggestions[0].User.UserName)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRefreshSuggestions(t *testing.T) {
+	t.Run("Refresh in batches", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectQuery("SELECT id FROM users").
+			WithArgs("", 2).
+			WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow("user-1").AddRow("user-2"))
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT pg_try_advisory_xact_lock").
+			WithArgs(pgxmock.AnyArg()).
+			WillReturnRows(pgxmock.NewRows([]string{"locked"}).AddRow(true))
+		mock.ExpectExec("DELETE FROM user_suggestions").
+			WithArgs([]string{"user-1", "user-2"}).
+			WillReturnResult(pgxmock.NewResult("DELETE", 3))
+		mock.ExpectExec(`(?s)c\.suspended_at IS NULL.*INSERT INTO user_suggestions`).
+			WithArgs(50, pgxmock.AnyArg(), []string{"user-1", "user-2"}).
+			WillReturnResult(pgxmock.NewResult("INSERT", 4))
+		mock.ExpectCommit()
+		mock.ExpectQuery("SELECT id FROM users").
+			WithArgs("user-2", 2).
+			WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow("user-3"))
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT pg_try_advisory_xact_lock").
+			WithArgs(pgxmock.AnyArg()).
+			WillReturnRows(pgxmock.NewRows([]string{"locked"}).AddRow(true))
+		mock.ExpectExec("DELETE FROM user_suggestions").
+			WithArgs([]string{"user-3"}).
+			WillReturnResult(pgxmock.NewResult("DELETE", 0))
+		mock.ExpectExec(`(?s)c\.suspended_at IS NULL.*INSERT INTO user_suggestions`).
+			WithArgs(50, pgxmock.AnyArg(), []string{"user-3"}).
+			WillReturnResult(pgxmock.NewResult("INSERT", 2))
+		mock.ExpectCommit()
+		mock.ExpectQuery("SELECT id FROM users").
+			WithArgs("user-3", 2).
+			WillReturnRows(pgxmock.NewRows([]string{"id"}))
+
+		store := userdb.NewStore(mock)
+		saved, err := store.RefreshSuggestions(50, 2)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(6), saved)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Another replica is refreshing", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectQuery("SELECT id FROM users").
+			WithArgs("", 2).
+			WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow("user-1"))
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT pg_try_advisory_xact_lock").
+			WithArgs(pgxmock.AnyArg()).
+			WillReturnRows(pgxmock.NewRows([]string{"locked"}).AddRow(false))
+		mock.ExpectRollback()
+
+		store := userdb.NewStore(mock)
+		saved, err := store.RefreshSuggestions(50, 2)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), saved)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -5,10 +5,12 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"strconv"
 	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
 	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
 	"github.com/jackgris/twitter-backend/auth/internal/store"
 	"github.com/jackgris/twitter-backend/auth/pkg/uuid"
@@ -28,13 +30,28 @@ func (s *Store) Create(user usermodel.User) (usermodel.User, error) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
 	defer cancel()
+
+	return insertUser(ctx, s.db, user)
+}
+
+// insertUser creates user, unless their username is reserved after another
+// user changed it.
+func insertUser(ctx context.Context, db queryRower, user usermodel.User) (usermodel.User, error) {
+	reserved, err := usernameReserved(ctx, db, user.UserName, "")
+	if err != nil {
+		return usermodel.User{}, err
+	}
+	if reserved {
+		return usermodel.User{}, ErrUsernameReserved
+	}
+
 	query := `
-                  INSERT INTO users (id, username, email, password, follower_count, following_count, salt, token, date_created, encoded_date)
-                  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-                  RETURNING id, username, email, password, follower_count, following_count, salt, token, date_created, encoded_date;
+                  INSERT INTO users (id, username, email, password, follower_count, following_count, salt, token, date_created, encoded_date, display_name)
+                  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+                  RETURNING id, username, email, password, follower_count, following_count, salt, token, date_created, encoded_date, version, protected, email_verified_at, display_name, bio, avatar_url, location, website;
         `
 	var newUser usermodel.User
-	err := s.db.QueryRow(ctx, query,
+	err = db.QueryRow(ctx, query,
 		uuid.New(),
 		user.UserName,
 		user.Email,
@@ -45,6 +62,7 @@ func (s *Store) Create(user usermodel.User) (usermodel.User, error) {
 		user.Token,
 		user.DateCreated,
 		user.EncodedDate,
+		user.DisplayName,
 	).Scan(&newUser.ID,
 		&newUser.UserName,
 		&newUser.Email,
@@ -54,8 +72,19 @@ func (s *Store) Create(user usermodel.User) (usermodel.User, error) {
 		&newUser.Salt,
 		&newUser.Token,
 		&newUser.DateCreated,
-		&newUser.EncodedDate)
+		&newUser.EncodedDate,
+		&newUser.Version,
+		&newUser.Protected,
+		&newUser.EmailVerifiedAt,
+		&newUser.DisplayName,
+		&newUser.Bio,
+		&newUser.AvatarURL,
+		&newUser.Location,
+		&newUser.Website)
 	if err != nil {
+		if err := uniqueViolation(err); err != nil {
+			return usermodel.User{}, err
+		}
 		return usermodel.User{}, fmt.Errorf("failed to insert tweet: %w", err)
 	}
 
@@ -64,91 +93,193 @@ func (s *Store) Create(user usermodel.User) (usermodel.User, error) {
 
 var ErrDeleteUser = errors.New("no user found")
 
+// Delete removes the user with their follows, blocks and mutes, and updates
+// the counters of the users they followed or were followed by.
 func (s *Store) Delete(id string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
 	defer cancel()
 
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
 	query := `
+               UPDATE users SET follower_count = GREATEST(follower_count - 1, 0)
+               WHERE id IN (SELECT user_id FROM user_followers WHERE follower_id = $1)
+        `
+	_, err = tx.Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to update follower counts: %w", err)
+	}
+
+	query = `
+               UPDATE users SET following_count = GREATEST(following_count - 1, 0)
+               WHERE id IN (SELECT follower_id FROM user_followers WHERE user_id = $1)
+        `
+	_, err = tx.Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to update following counts: %w", err)
+	}
+
+	query = `
 		DELETE FROM users
 		WHERE id = $1;
 	`
 
-	commandTag, err := s.db.Exec(ctx, query, id)
+	commandTag, err := tx.Exec(ctx, query, id)
 	if err != nil {
-		return fmt.Errorf("failed to delete tweet: %w", err)
+		return fmt.Errorf("failed to delete user: %w", err)
 	}
 
 	if commandTag.RowsAffected() == 0 {
 		return errors.Join(ErrDeleteUser, fmt.Errorf("with ID: %s", id))
 	}
 
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
 	return nil
 }
 
-func (s *Store) Follow(follow usermodel.UserFollowers) error {
+var (
+	ErrFollowNotFound = errors.New("follow not found")
+	ErrSelfFollow     = errors.New("users can't follow themselves")
+	ErrUserNotFound   = errors.New("user not found")
+)
+
+// Follow makes follow.FollowerID follow follow.UserID and updates the
+// counters of both users in the same transaction. Following twice is not an
+// error, the existing follow is returned and created is false. ErrBlocked is
+// returned when any of the users blocked the other.
+func (s *Store) Follow(follow usermodel.UserFollowers) (usermodel.UserFollowers, bool, error) {
+	if follow.UserID == follow.FollowerID {
+		return usermodel.UserFollowers{}, false, ErrSelfFollow
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
 	defer cancel()
 
-	query := `
-                INSERT INTO user_followers (id, user_id, follower_id) VALUES ($1, $2, $3)
-        `
-	_, err := s.db.Exec(ctx, query,
-		uuid.New(),
-		follow.UserID,
-		follow.FollowerID,
-	)
+	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		return err
+		return usermodel.UserFollowers{}, false, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
 
-	query = `
-               UPDATE users SET follower_count = follower_count + 1 WHERE id = $1
-        `
-	_, err = s.db.Exec(ctx, query, follow.FollowerID)
+	blocked, err := blockedBetween(ctx, tx, follow.UserID, follow.FollowerID)
 	if err != nil {
-		return err
+		return usermodel.UserFollowers{}, false, err
+	}
+	if blocked {
+		return usermodel.UserFollowers{}, false, ErrBlocked
 	}
 
-	query = `
-               UPDATE users SET following_count = following_count + 1 WHERE id = $1
+	query := `
+                INSERT INTO user_followers (id, user_id, follower_id) VALUES ($1, $2, $3)
+                ON CONFLICT (user_id, follower_id) DO NOTHING
+                RETURNING id
         `
-	_, err = s.db.Exec(ctx, query, follow.FollowerID)
+	err = tx.QueryRow(ctx, query, uuid.New(), follow.UserID, follow.FollowerID).Scan(&follow.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		query = `
+                        SELECT id FROM user_followers WHERE user_id = $1 AND follower_id = $2
+                `
+		err = tx.QueryRow(ctx, query, follow.UserID, follow.FollowerID).Scan(&follow.ID)
+		if err != nil {
+			return usermodel.UserFollowers{}, false, fmt.Errorf("failed to fetch follow: %w", err)
+		}
+		return follow, false, nil
+	}
 	if err != nil {
-		return err
+		var pgErr *pgconn.PgError
+		// 23503 is foreign_key_violation
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return usermodel.UserFollowers{}, false, ErrUserNotFound
+		}
+		return usermodel.UserFollowers{}, false, fmt.Errorf("failed to insert follow: %w", err)
 	}
 
-	return nil
+	if err := updateFollowCounts(ctx, tx, follow, 1); err != nil {
+		return usermodel.UserFollowers{}, false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return usermodel.UserFollowers{}, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return follow, true, nil
 }
 
+// Unfollow removes the follow and updates the counters of both users in the
+// same transaction, or cancels a pending follow request. ErrFollowNotFound is
+// returned when there is neither.
 func (s *Store) Unfollow(follow usermodel.UserFollowers) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
 	defer cancel()
 
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
 	query := `
                 DELETE FROM user_followers WHERE user_id = $1 AND follower_id = $2
         `
-	_, err := s.db.Exec(ctx, query,
-		follow.UserID,
-		follow.FollowerID,
-	)
+	tag, err := tx.Exec(ctx, query, follow.UserID, follow.FollowerID)
 	if err != nil {
+		return fmt.Errorf("failed to delete follow: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		// Unfollowing a protected user before they approved cancels the request
+		if err := deleteFollowRequest(ctx, tx, follow.UserID, follow.FollowerID); err != nil {
+			if errors.Is(err, ErrFollowRequestNotFound) {
+				return ErrFollowNotFound
+			}
+			return err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return nil
+	}
+
+	if err := updateFollowCounts(ctx, tx, follow, -1); err != nil {
 		return err
 	}
 
-	query = `
-               UPDATE users SET follower_count = follower_count - 1 WHERE id = $1
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// updateFollowCounts adds delta to the follower count of the followed user
+// and to the following count of the follower.
+func updateFollowCounts(ctx context.Context, db execer, follow usermodel.UserFollowers, delta int) error {
+	query := `
+               UPDATE users SET follower_count = GREATEST(follower_count + $2, 0) WHERE id = $1
         `
-	_, err = s.db.Exec(ctx, query, follow.UserID)
+	_, err := db.Exec(ctx, query, follow.UserID, delta)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to update follower count: %w", err)
 	}
 
 	query = `
-               UPDATE users SET following_count = following_count - 1 WHERE id = $1
+               UPDATE users SET following_count = GREATEST(following_count + $2, 0) WHERE id = $1
         `
-	_, err = s.db.Exec(ctx, query, follow.FollowerID)
+	_, err = db.Exec(ctx, query, follow.FollowerID, delta)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to update following count: %w", err)
 	}
 
 	return nil
@@ -159,7 +290,8 @@ func (s *Store) GetUserbyUsername(username string) (usermodel.User, error) {
 	defer cancel()
 
 	query := `
-                SELECT * FROM users WHERE username = $1
+                SELECT id, username, email, password, follower_count, following_count, salt, token, date_created, encoded_date, version, protected, email_verified_at, display_name, bio, avatar_url, location, website
+                FROM users WHERE lower(username) = lower($1)
         `
 	var user usermodel.User
 	err := s.db.QueryRow(ctx, query, username).Scan(
@@ -171,7 +303,15 @@ func (s *Store) GetUserbyUsername(username string) (usermodel.User, error) {
 		&user.FollowingCount,
 		&user.Salt, &user.Token,
 		&user.DateCreated,
-		&user.EncodedDate)
+		&user.EncodedDate,
+		&user.Version,
+		&user.Protected,
+		&user.EmailVerifiedAt,
+		&user.DisplayName,
+		&user.Bio,
+		&user.AvatarURL,
+		&user.Location,
+		&user.Website)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return usermodel.User{}, nil
@@ -182,32 +322,56 @@ func (s *Store) GetUserbyUsername(username string) (usermodel.User, error) {
 	return user, nil
 }
 
+// GetUsersByIDOrUsername returns the users with one of ids or, ignoring
+// case, one of usernames, in no particular order. Only the ID, username and
+// protected flag are read.
+func (s *Store) GetUsersByIDOrUsername(ids, usernames []string) ([]usermodel.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	lower := make([]string, len(usernames))
+	for i, username := range usernames {
+		lower[i] = strings.ToLower(username)
+	}
+
+	query := `
+                SELECT id, username, protected
+                FROM users
+                WHERE id = ANY($1) OR lower(username) = ANY($2)
+        `
+	rows, err := s.db.Query(ctx, query, ids, lower)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	defer rows.Close()
+
+	users := []usermodel.User{}
+	for rows.Next() {
+		var user usermodel.User
+		if err := rows.Scan(&user.ID, &user.UserName, &user.Protected); err != nil {
+			return nil, fmt.Errorf("row scanning failed: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows iteration failed: %w", rows.Err())
+	}
+
+	return users, nil
+}
+
 func (s *Store) GetUserbyID(id string) (usermodel.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
 	defer cancel()
 
 	query := `
-                SELECT
-                    u.id,
-                    u.username,
-                    u.email,
-                    u.password,
-                    u.follower_count,
-                    u.following_count,
-                    u.salt,
-                    u.token,
-                    u.date_created,
-                    u.encoded_date,
-                    COALESCE(array_agg(COALESCE(uf.follower_id, '')), '{}') AS followers
-                FROM users u
-                LEFT JOIN user_followers uf
-                ON u.id = uf.user_id
-                WHERE u.id = $1
-                GROUP BY u.id
+                SELECT id, username, email, password, follower_count, following_count, salt, token, date_created, encoded_date, version, protected, email_verified_at, display_name, bio, avatar_url, location, website, role, suspended_at
+                FROM users
+                WHERE id = $1
         `
 
 	var user usermodel.User
-	followers := []string{}
 	err := s.db.QueryRow(ctx, query, id).Scan(
 		&user.ID,
 		&user.UserName,
@@ -219,86 +383,276 @@ func (s *Store) GetUserbyID(id string) (usermodel.User, error) {
 		&user.Token,
 		&user.DateCreated,
 		&user.EncodedDate,
-		&followers)
+		&user.Version,
+		&user.Protected,
+		&user.EmailVerifiedAt,
+		&user.DisplayName,
+		&user.Bio,
+		&user.AvatarURL,
+		&user.Location,
+		&user.Website,
+		&user.Role,
+		&user.SuspendedAt)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return usermodel.User{}, nil
-		}
 		return usermodel.User{}, err
 	}
-	for _, f := range followers {
-		userf := usermodel.UserFollowers{
-			UserID:     user.ID,
-			FollowerID: f,
-		}
-		user.Followers = append(user.Followers, userf)
-	}
 
 	return user, nil
 }
 
-func (s *Store) Update(user usermodel.User) (usermodel.User, error) {
-	var queryBuilder strings.Builder
-	var args []interface{}
-	queryBuilder.WriteString("UPDATE users SET ")
+var (
+	ErrVersionConflict = errors.New("user was modified by another request")
+	ErrUsernameTaken   = errors.New("username already taken")
+	ErrEmailTaken      = errors.New("email already taken")
+)
+
+// Update applies patch to the user. When version isn't 0 the update only
+// happens if the stored version still matches, otherwise ErrVersionConflict
+// is returned. Every update increments the version. Making the user public
+// approves their pending follow requests in the same transaction, the new
+// follows are returned.
+func (s *Store) Update(id string, patch usermodel.UserPatch, version int) (usermodel.User, []usermodel.UserFollowers, error) {
+	var sets []string
+	var args []any
+	set := func(column string, value any) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
 
-	if user.UserName != "" {
-		queryBuilder.WriteString("username = $1, ")
-		args = append(args, user.UserName)
+	if patch.UserName != nil {
+		set("username", *patch.UserName)
+	}
+	if patch.Email != nil {
+		set("email", *patch.Email)
+		// A new email has to be verified again
+		sets = append(sets, "email_verified_at = NULL")
 	}
-	if user.Email != "" {
-		queryBuilder.WriteString("email = $2, ")
-		args = append(args, user.Email)
+	if patch.Password != nil {
+		set("password", *patch.Password)
 	}
-	if user.Password != "" {
-		queryBuilder.WriteString("password = $3, ")
-		args = append(args, user.Password)
+	if patch.Salt != nil {
+		set("salt", *patch.Salt)
 	}
-	if user.FollowerCount != 0 {
-		queryBuilder.WriteString("follower_count = $4, ")
-		args = append(args, user.FollowerCount)
+	if patch.Protected != nil {
+		set("protected", *patch.Protected)
 	}
-	if user.FollowingCount != 0 {
-		queryBuilder.WriteString("following_count = $5, ")
-		args = append(args, user.FollowingCount)
+	if patch.DisplayName != nil {
+		set("display_name", *patch.DisplayName)
 	}
-	if user.Salt != "" {
-		queryBuilder.WriteString("salt = $6, ")
-		args = append(args, user.Salt)
+	if patch.Bio != nil {
+		set("bio", *patch.Bio)
 	}
-	if user.Token != "" {
-		queryBuilder.WriteString("token = $7, ")
-		args = append(args, user.Token)
+	if patch.AvatarURL != nil {
+		set("avatar_url", *patch.AvatarURL)
 	}
-	if !user.DateCreated.IsZero() {
-		queryBuilder.WriteString("date_created = $8, ")
-		args = append(args, user.DateCreated)
+	if patch.Location != nil {
+		set("location", *patch.Location)
 	}
-	if user.EncodedDate != "" {
-		queryBuilder.WriteString("encoded_date = $9, ")
-		args = append(args, user.EncodedDate)
+	if patch.Website != nil {
+		set("website", *patch.Website)
 	}
+	sets = append(sets, "version = version + 1")
 
-	query := queryBuilder.String()[:len(queryBuilder.String())-2]
+	args = append(args, id)
+	where := fmt.Sprintf("id = $%d", len(args))
+	if version != 0 {
+		args = append(args, version)
+		where += fmt.Sprintf(" AND version = $%d", len(args))
+	}
 
-	// TODO
-	queryBuilder.WriteString(query)
-	queryBuilder.WriteString(" WHERE id = $")
-	args = append(args, len(args)+1)
-	queryBuilder.WriteString(strconv.Itoa(len(args)))
+	query := "UPDATE users SET " + strings.Join(sets, ", ") + " WHERE " + where +
+		" RETURNING id, username, email, password, follower_count, following_count, salt, token, date_created, encoded_date, version, protected, email_verified_at, display_name, bio, avatar_url, location, website"
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
 	defer cancel()
 
-	_, err := s.db.Exec(ctx, queryBuilder.String(), args...)
+	if patch.Protected == nil || *patch.Protected {
+		user, err := updateUser(ctx, s.db, query, args, id, version)
+		return user, nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return usermodel.User{}, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	// The counters returned with the user include the approved follows
+	approved, err := approveFollowRequests(ctx, tx, id)
+	if err != nil {
+		return usermodel.User{}, nil, err
+	}
+
+	user, err := updateUser(ctx, tx, query, args, id, version)
+	if err != nil {
+		return usermodel.User{}, nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return usermodel.User{}, nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return user, approved, nil
+}
+
+// updateUser runs the update query Update built for the user id.
+func updateUser(ctx context.Context, db queryRower, query string, args []any, id string, version int) (usermodel.User, error) {
+	var user usermodel.User
+	err := db.QueryRow(ctx, query, args...).Scan(
+		&user.ID,
+		&user.UserName,
+		&user.Email,
+		&user.Password,
+		&user.FollowerCount,
+		&user.FollowingCount,
+		&user.Salt,
+		&user.Token,
+		&user.DateCreated,
+		&user.EncodedDate,
+		&user.Version,
+		&user.Protected,
+		&user.EmailVerifiedAt,
+		&user.DisplayName,
+		&user.Bio,
+		&user.AvatarURL,
+		&user.Location,
+		&user.Website)
 	if err != nil {
+		if err := uniqueViolation(err); err != nil {
+			return usermodel.User{}, err
+		}
+		if errors.Is(err, pgx.ErrNoRows) && version != 0 {
+			var exists bool
+			if err := db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, id).Scan(&exists); err != nil {
+				return usermodel.User{}, err
+			}
+			if exists {
+				return usermodel.User{}, ErrVersionConflict
+			}
+		}
 		return usermodel.User{}, err
 	}
 
-	user, err = s.GetUserbyID(user.ID)
+	return user, nil
+}
+
+// uniqueViolation maps the unique constraints of the users table to their
+// errors, it returns nil for any other error.
+func uniqueViolation(err error) error {
+	// 23505 is unique_violation
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+		return nil
+	}
+
+	switch pgErr.ConstraintName {
+	case "users_username_key", "users_username_lower_key":
+		return ErrUsernameTaken
+	case "users_email_key":
+		return ErrEmailTaken
+	}
+	return nil
+}
+
+// ListPlaintextPasswords returns up to limit users whose password was stored
+// before hashing was introduced.
+func (s *Store) ListPlaintextPasswords(limit int) ([]usermodel.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                SELECT id, password FROM users
+                WHERE password NOT LIKE '$argon2id$%'
+                LIMIT $1
+        `
+	rows, err := s.db.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	defer rows.Close()
+
+	var users []usermodel.User
+	for rows.Next() {
+		var user usermodel.User
+		if err := rows.Scan(&user.ID, &user.Password); err != nil {
+			return nil, fmt.Errorf("row scanning failed: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows iteration failed: %w", rows.Err())
+	}
+
+	return users, nil
+}
+
+// ReplacePassword swaps old for the new hash and salt. Nothing is written if
+// the stored password is no longer old, so a concurrent change always wins.
+func (s *Store) ReplacePassword(id, old, hash, salt string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+               UPDATE users SET password = $3, salt = $4 WHERE id = $1 AND password = $2
+        `
+	_, err := s.db.Exec(ctx, query, id, old, hash, salt)
+	if err != nil {
+		return fmt.Errorf("failed to replace password: %w", err)
+	}
+
+	return nil
+}
+
+// GetUserByLogin finds a user by username, ignoring case, or email.
+func (s *Store) GetUserByLogin(login string) (usermodel.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                SELECT id, username, email, password, salt, email_verified_at, role, suspended_at
+                FROM users
+                WHERE lower(username) = lower($1) OR email = $1
+        `
+	var user usermodel.User
+	err := s.db.QueryRow(ctx, query, login).Scan(
+		&user.ID,
+		&user.UserName,
+		&user.Email,
+		&user.Password,
+		&user.Salt,
+		&user.EmailVerifiedAt,
+		&user.Role,
+		&user.SuspendedAt)
 	if err != nil {
 		return usermodel.User{}, err
 	}
 
 	return user, nil
 }
+
+var ErrEmailNotVerifiable = errors.New("email already verified or changed")
+
+// VerifyEmail marks email as verified for the user. It only succeeds once,
+// and only while the user still has that email, which makes verification
+// tokens single use.
+func (s *Store) VerifyEmail(id, email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                UPDATE users SET email_verified_at = $3
+                WHERE id = $1 AND email = $2 AND email_verified_at IS NULL
+        `
+	tag, err := s.db.Exec(ctx, query, id, email, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrEmailNotVerifiable
+	}
+
+	return nil
+}
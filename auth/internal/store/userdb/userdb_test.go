@@ -0,0 +1,185 @@
+package userdb_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var updatedColumns = []string{"id", "username", "email", "password", "follower_count", "following_count", "salt", "token", "date_created", "encoded_date", "version", "protected", "email_verified_at", "display_name", "bio", "avatar_url", "location", "website"}
+
+func TestUpdate(t *testing.T) {
+	bio := "Go developer"
+	email := "new@example.com"
+
+	t.Run("Only the patched fields are updated", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		now := time.Now()
+		mock.ExpectQuery(regexp.QuoteMeta("UPDATE users SET bio = $1, version = version + 1 WHERE id = $2 RETURNING")).
+			WithArgs(bio, "user-1").
+			WillReturnRows(pgxmock.NewRows(updatedColumns).
+				AddRow("user-1", "jackgris", "old@example.com", "hash", 0, 0, "salt", "", now, "", 2, false, &now, "", bio, "", "", ""))
+
+		store := userdb.NewStore(mock)
+		user, _, err := store.Update("user-1", usermodel.UserPatch{Bio: &bio}, 0)
+
+		assert.NoError(t, err)
+		assert.Equal(t, bio, user.Bio)
+		assert.Equal(t, 2, user.Version)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("A new email has to be verified again", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		now := time.Now()
+		mock.ExpectQuery(regexp.QuoteMeta("UPDATE users SET email = $1, email_verified_at = NULL, version = version + 1 WHERE id = $2 AND version = $3 RETURNING")).
+			WithArgs(email, "user-1", 4).
+			WillReturnRows(pgxmock.NewRows(updatedColumns).
+				AddRow("user-1", "jackgris", email, "hash", 0, 0, "salt", "", now, "", 5, false, (*time.Time)(nil), "", "", "", "", ""))
+
+		store := userdb.NewStore(mock)
+		user, _, err := store.Update("user-1", usermodel.UserPatch{Email: &email}, 4)
+
+		assert.NoError(t, err)
+		assert.Nil(t, user.EmailVerifiedAt)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Going public approves the follow requests", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		public := false
+		now := time.Now()
+		mock.ExpectBegin()
+		mock.ExpectQuery("DELETE FROM follow_requests").
+			WithArgs("user-1").
+			WillReturnRows(pgxmock.NewRows([]string{"follower_id"}).AddRow("user-2").AddRow("user-3"))
+		mock.ExpectQuery("INSERT INTO user_followers").
+			WithArgs(pgxmock.AnyArg(), "user-1", "user-2").
+			WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow("follow-1"))
+		mock.ExpectExec("UPDATE users SET follower_count").
+			WithArgs("user-1", 1).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectExec("UPDATE users SET following_count").
+			WithArgs("user-2", 1).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		// user-3 already follows, the request is only dropped
+		mock.ExpectQuery("INSERT INTO user_followers").
+			WithArgs(pgxmock.AnyArg(), "user-1", "user-3").
+			WillReturnError(pgx.ErrNoRows)
+		mock.ExpectQuery(regexp.QuoteMeta("UPDATE users SET protected = $1, version = version + 1 WHERE id = $2 RETURNING")).
+			WithArgs(false, "user-1").
+			WillReturnRows(pgxmock.NewRows(updatedColumns).
+				AddRow("user-1", "jackgris", "old@example.com", "hash", 1, 0, "salt", "", now, "", 2, false, &now, "", "", "", "", ""))
+		mock.ExpectCommit()
+
+		store := userdb.NewStore(mock)
+		user, approved, err := store.Update("user-1", usermodel.UserPatch{Protected: &public}, 0)
+
+		assert.NoError(t, err)
+		assert.False(t, user.Protected)
+		assert.Equal(t, []usermodel.UserFollowers{{ID: "follow-1", UserID: "user-1", FollowerID: "user-2"}}, approved)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Version conflict", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectQuery(regexp.QuoteMeta("UPDATE users SET bio = $1, version = version + 1 WHERE id = $2 AND version = $3")).
+			WithArgs(bio, "user-1", 4).
+			WillReturnError(pgx.ErrNoRows)
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs("user-1").
+			WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(true))
+
+		store := userdb.NewStore(mock)
+		_, _, err = store.Update("user-1", usermodel.UserPatch{Bio: &bio}, 4)
+
+		assert.ErrorIs(t, err, userdb.ErrVersionConflict)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Unknown user with a version", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectQuery("UPDATE users SET bio").
+			WithArgs(bio, "user-1", 4).
+			WillReturnError(pgx.ErrNoRows)
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs("user-1").
+			WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(false))
+
+		store := userdb.NewStore(mock)
+		_, _, err = store.Update("user-1", usermodel.UserPatch{Bio: &bio}, 4)
+
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	tests := []struct {
+		name       string
+		constraint string
+		expected   error
+	}{
+		{name: "Email taken", constraint: "users_email_key", expected: userdb.ErrEmailTaken},
+		{name: "Username taken", constraint: "users_username_lower_key", expected: userdb.ErrUsernameTaken},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mock, err := pgxmock.NewConn()
+			assert.NoError(t, err)
+			defer mock.Close(context.Background())
+
+			mock.ExpectQuery("UPDATE users SET email").
+				WithArgs(email, "user-1").
+				WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: test.constraint})
+
+			store := userdb.NewStore(mock)
+			_, _, err = store.Update("user-1", usermodel.UserPatch{Email: &email}, 0)
+
+			assert.ErrorIs(t, err, test.expected)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetUsersByIDOrUsername(t *testing.T) {
+	mock, err := pgxmock.NewConn()
+	assert.NoError(t, err)
+	defer mock.Close(context.Background())
+
+	mock.ExpectQuery(`SELECT id, username, protected\s+FROM users\s+WHERE id = ANY\(\$1\) OR lower\(username\) = ANY\(\$2\)`).
+		WithArgs([]string{"csvqvamek44s73e2qf8g"}, []string{"jackgris", "alice"}).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "username", "protected"}).
+			AddRow("csvqvamek44s73e2qf8g", "bob", false).
+			AddRow("csvqda265b6s73dtmot0", "JackGris", true))
+
+	store := userdb.NewStore(mock)
+	users, err := store.GetUsersByIDOrUsername([]string{"csvqvamek44s73e2qf8g"}, []string{"JackGris", "alice"})
+
+	assert.NoError(t, err)
+	assert.Len(t, users, 2)
+	assert.True(t, users[1].Protected)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,181 @@
+package userdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackgris/twitter-backend/auth/internal/domain/usermodel"
+	"github.com/jackgris/twitter-backend/auth/pkg/uuid"
+)
+
+var (
+	ErrUsernameUnchanged = errors.New("username didn't change")
+	ErrUsernameCooldown  = errors.New("username changed too recently")
+	// ErrUsernameReserved is an ErrUsernameTaken too, the username belonged
+	// to another user who changed it recently
+	ErrUsernameReserved = fmt.Errorf("%w, another user changed it recently", ErrUsernameTaken)
+)
+
+// usernameReserved reports whether username is the old username of a user
+// other than userID and it is still reserved. userID is empty for new users.
+func usernameReserved(ctx context.Context, db queryRower, username, userID string) (bool, error) {
+	query := `
+                SELECT EXISTS (
+                        SELECT 1 FROM username_history
+                        WHERE lower(username) = lower($1) AND user_id <> $2 AND reserved_until > $3
+                )
+        `
+	var reserved bool
+	err := db.QueryRow(ctx, query, username, userID, time.Now()).Scan(&reserved)
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch username reservation: %w", err)
+	}
+
+	return reserved, nil
+}
+
+// ChangeUsername renames the user, records the old username and reserves it
+// until reservation passes, so nobody else can take it meanwhile. Users can
+// take back their own old usernames. A user can only change their username
+// once every cooldown, ErrUsernameCooldown comes with NextChangeAt set.
+func (s *Store) ChangeUsername(userID, username string, cooldown, reservation time.Duration) (usermodel.UsernameChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return usermodel.UsernameChange{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	now := time.Now()
+	change := usermodel.UsernameChange{
+		UserID:        userID,
+		NewUsername:   username,
+		ChangedAt:     now,
+		ReservedUntil: now.Add(reservation),
+		NextChangeAt:  now.Add(cooldown),
+	}
+
+	// Locking the user serializes the changes of the same user, so two
+	// requests can't both pass the cooldown
+	query := `
+                SELECT username FROM users WHERE id = $1 FOR UPDATE
+        `
+	err = tx.QueryRow(ctx, query, userID).Scan(&change.OldUsername)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return usermodel.UsernameChange{}, ErrUserNotFound
+		}
+		return usermodel.UsernameChange{}, fmt.Errorf("failed to fetch user: %w", err)
+	}
+
+	if change.OldUsername == username {
+		return usermodel.UsernameChange{}, ErrUsernameUnchanged
+	}
+
+	query = `
+                SELECT changed_at FROM username_history
+                WHERE user_id = $1
+                ORDER BY changed_at DESC
+                LIMIT 1
+        `
+	var lastChange time.Time
+	err = tx.QueryRow(ctx, query, userID).Scan(&lastChange)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return usermodel.UsernameChange{}, fmt.Errorf("failed to fetch last username change: %w", err)
+	}
+	if err == nil && now.Before(lastChange.Add(cooldown)) {
+		return usermodel.UsernameChange{NextChangeAt: lastChange.Add(cooldown)}, ErrUsernameCooldown
+	}
+
+	reserved, err := usernameReserved(ctx, tx, username, userID)
+	if err != nil {
+		return usermodel.UsernameChange{}, err
+	}
+	if reserved {
+		return usermodel.UsernameChange{}, ErrUsernameReserved
+	}
+
+	query = `
+                UPDATE users SET username = $2, version = version + 1
+                WHERE id = $1
+        `
+	_, err = tx.Exec(ctx, query, userID, username)
+	if err != nil {
+		if err := uniqueViolation(err); err != nil {
+			return usermodel.UsernameChange{}, err
+		}
+		return usermodel.UsernameChange{}, fmt.Errorf("failed to update username: %w", err)
+	}
+
+	// A change that only fixes the case keeps the same handle, there is
+	// nothing to reserve but it still counts for the cooldown
+	query = `
+                INSERT INTO username_history (id, user_id, username, changed_at, reserved_until)
+                VALUES ($1, $2, $3, $4, $5)
+        `
+	reservedUntil := change.ReservedUntil
+	if strings.EqualFold(change.OldUsername, username) {
+		reservedUntil = now
+	}
+	_, err = tx.Exec(ctx, query, uuid.New(), userID, change.OldUsername, now, reservedUntil)
+	if err != nil {
+		return usermodel.UsernameChange{}, fmt.Errorf("failed to insert username history: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return usermodel.UsernameChange{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return change, nil
+}
+
+// GetUserByOldUsername returns the user who had username before changing
+// it, while the old username is still reserved. It returns pgx.ErrNoRows
+// when nobody had it recently.
+func (s *Store) GetUserByOldUsername(username string) (usermodel.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+                SELECT u.id, u.username, u.email, u.password, u.follower_count, u.following_count, u.salt, u.token, u.date_created, u.encoded_date, u.version, u.protected, u.email_verified_at, u.display_name, u.bio, u.avatar_url, u.location, u.website
+                FROM username_history h
+                JOIN users u ON u.id = h.user_id
+                WHERE lower(h.username) = lower($1) AND h.reserved_until > $2
+                ORDER BY h.changed_at DESC
+                LIMIT 1
+        `
+
+	var user usermodel.User
+	err := s.db.QueryRow(ctx, query, username, time.Now()).Scan(
+		&user.ID,
+		&user.UserName,
+		&user.Email,
+		&user.Password,
+		&user.FollowerCount,
+		&user.FollowingCount,
+		&user.Salt,
+		&user.Token,
+		&user.DateCreated,
+		&user.EncodedDate,
+		&user.Version,
+		&user.Protected,
+		&user.EmailVerifiedAt,
+		&user.DisplayName,
+		&user.Bio,
+		&user.AvatarURL,
+		&user.Location,
+		&user.Website)
+	if err != nil {
+		return usermodel.User{}, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,97 @@
+package userdb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackgris/twitter-backend/auth/internal/store/userdb"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeUsername(t *testing.T) {
+	cooldown := 7 * 24 * time.Hour
+	reservation := 30 * 24 * time.Hour
+
+	t.Run("Change OK", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT username FROM users").
+			WithArgs("user-1").
+			WillReturnRows(pgxmock.NewRows([]string{"username"}).AddRow("jack"))
+		mock.ExpectQuery("SELECT changed_at FROM username_history").
+			WithArgs("user-1").
+			WillReturnError(pgx.ErrNoRows)
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs("jackgris", "user-1", pgxmock.AnyArg()).
+			WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectExec("UPDATE users SET username").
+			WithArgs("user-1", "jackgris").
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectExec("INSERT INTO username_history").
+			WithArgs(pgxmock.AnyArg(), "user-1", "jack", pgxmock.AnyArg(), pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		mock.ExpectCommit()
+
+		store := userdb.NewStore(mock)
+		change, err := store.ChangeUsername("user-1", "jackgris", cooldown, reservation)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "jack", change.OldUsername)
+		assert.WithinDuration(t, time.Now().Add(reservation), change.ReservedUntil, time.Second)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Changed too recently", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		lastChange := time.Now().Add(-24 * time.Hour)
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT username FROM users").
+			WithArgs("user-1").
+			WillReturnRows(pgxmock.NewRows([]string{"username"}).AddRow("jack"))
+		mock.ExpectQuery("SELECT changed_at FROM username_history").
+			WithArgs("user-1").
+			WillReturnRows(pgxmock.NewRows([]string{"changed_at"}).AddRow(lastChange))
+		mock.ExpectRollback()
+
+		store := userdb.NewStore(mock)
+		change, err := store.ChangeUsername("user-1", "jackgris", cooldown, reservation)
+
+		assert.ErrorIs(t, err, userdb.ErrUsernameCooldown)
+		assert.Equal(t, lastChange.Add(cooldown), change.NextChangeAt)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Username reserved", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT username FROM users").
+			WithArgs("user-1").
+			WillReturnRows(pgxmock.NewRows([]string{"username"}).AddRow("jack"))
+		mock.ExpectQuery("SELECT changed_at FROM username_history").
+			WithArgs("user-1").
+			WillReturnError(pgx.ErrNoRows)
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs("jackgris", "user-1", pgxmock.AnyArg()).
+			WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectRollback()
+
+		store := userdb.NewStore(mock)
+		_, err = store.ChangeUsername("user-1", "jackgris", cooldown, reservation)
+
+		assert.ErrorIs(t, err, userdb.ErrUsernameReserved)
+		assert.ErrorIs(t, err, userdb.ErrUsernameTaken)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
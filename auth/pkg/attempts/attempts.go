@@ -0,0 +1,130 @@
+// Package attempts tracks failed login attempts to slow down password
+// guessing. Every failure past a few free ones doubles the time the next try
+// has to wait, and too many failures lock the key out for a while.
+package attempts
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Tracker counts the failures of a key, like an account or an IP address.
+// Memory works for a single replica, replicas sharing the counters need a
+// Tracker backed by the database.
+type Tracker interface {
+	// Wait returns how long key has to wait before trying again, 0 when it
+	// can try now.
+	Wait(ctx context.Context, key string) (time.Duration, error)
+	// Fail records a failed attempt of key and returns how long it has to
+	// wait before the next one.
+	Fail(ctx context.Context, key string) (time.Duration, error)
+	// Reset forgets the failures of key, after a successful login or when an
+	// admin unlocks it.
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy decides how long a key waits after a number of failures.
+type Policy struct {
+	// Free failures don't make the key wait
+	Free int
+	// BaseDelay is the wait after the first failure past the free ones,
+	// doubled with every failure after it up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutAfter failures lock the key out for LockoutDuration
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	// Window is how long failures are remembered after the last one
+	Window time.Duration
+}
+
+// Delay is how long a key has to wait after its last failure.
+func (p Policy) Delay(failures int) time.Duration {
+	if failures >= p.LockoutAfter {
+		return p.LockoutDuration
+	}
+	if failures <= p.Free {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.Free + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// Wait is how long a key with failures, the last one at lastFailure, still
+// has to wait at now.
+func (p Policy) Wait(failures int, lastFailure, now time.Time) time.Duration {
+	return max(lastFailure.Add(p.Delay(failures)).Sub(now), 0)
+}
+
+// Expired reports whether failures that ended at lastFailure are forgotten.
+func (p Policy) Expired(lastFailure, now time.Time) bool {
+	return now.Sub(lastFailure) > p.Window
+}
+
+// Memory keeps the failures in memory.
+type Memory struct {
+	policy Policy
+	now    func() time.Time
+
+	mu   sync.Mutex
+	keys map[string]record
+}
+
+type record struct {
+	failures    int
+	lastFailure time.Time
+}
+
+func NewMemory(policy Policy) *Memory {
+	return &Memory{policy: policy, now: time.Now, keys: make(map[string]record)}
+}
+
+func (m *Memory) Wait(ctx context.Context, key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, ok := m.keys[key]
+	if !ok {
+		return 0, nil
+	}
+
+	return m.policy.Wait(rec.failures, rec.lastFailure, m.now()), nil
+}
+
+func (m *Memory) Fail(ctx context.Context, key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	rec := m.keys[key]
+	if m.policy.Expired(rec.lastFailure, now) {
+		rec = record{}
+	}
+	rec.failures++
+	rec.lastFailure = now
+	m.keys[key] = rec
+
+	// Drop the forgotten keys now and then so the map doesn't grow forever
+	if len(m.keys)%1000 == 0 {
+		for k, r := range m.keys {
+			if m.policy.Expired(r.lastFailure, now) {
+				delete(m.keys, k)
+			}
+		}
+	}
+
+	return m.policy.Delay(rec.failures), nil
+}
+
+func (m *Memory) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.keys, key)
+	return nil
+}
@@ -0,0 +1,96 @@
+package attempts_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackgris/twitter-backend/auth/pkg/attempts"
+	"github.com/stretchr/testify/assert"
+)
+
+var policy = attempts.Policy{
+	Free:            3,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutAfter:    10,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+func TestPolicyDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{failures: 1, expected: 0},
+		{failures: 3, expected: 0},
+		{failures: 4, expected: time.Second},
+		{failures: 5, expected: 2 * time.Second},
+		{failures: 7, expected: 8 * time.Second},
+		{failures: 9, expected: 32 * time.Second},
+		{failures: 10, expected: 15 * time.Minute},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, policy.Delay(test.failures), "failures %d", test.failures)
+	}
+
+	capped := policy
+	capped.MaxDelay = 5 * time.Second
+	assert.Equal(t, 5*time.Second, capped.Delay(9))
+}
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tracker := attempts.NewMemory(policy)
+	tracker.SetNow(func() time.Time { return now })
+
+	t.Run("Backoff after the free failures", func(t *testing.T) {
+		for range 3 {
+			delay, err := tracker.Fail(ctx, "account:jack")
+			assert.NoError(t, err)
+			assert.Zero(t, delay)
+		}
+
+		delay, err := tracker.Fail(ctx, "account:jack")
+		assert.NoError(t, err)
+		assert.Equal(t, time.Second, delay)
+
+		wait, err := tracker.Wait(ctx, "account:jack")
+		assert.NoError(t, err)
+		assert.Equal(t, time.Second, wait)
+
+		wait, err = tracker.Wait(ctx, "account:other")
+		assert.NoError(t, err)
+		assert.Zero(t, wait)
+	})
+
+	t.Run("Wait goes down with time", func(t *testing.T) {
+		now = now.Add(600 * time.Millisecond)
+		wait, err := tracker.Wait(ctx, "account:jack")
+		assert.NoError(t, err)
+		assert.Equal(t, 400*time.Millisecond, wait)
+	})
+
+	t.Run("Failures are forgotten after the window", func(t *testing.T) {
+		now = now.Add(2 * time.Hour)
+		delay, err := tracker.Fail(ctx, "account:jack")
+		assert.NoError(t, err)
+		assert.Zero(t, delay)
+	})
+
+	t.Run("Reset unlocks", func(t *testing.T) {
+		for range 10 {
+			_, _ = tracker.Fail(ctx, "ip:10.0.0.1")
+		}
+		wait, _ := tracker.Wait(ctx, "ip:10.0.0.1")
+		assert.Equal(t, 15*time.Minute, wait)
+
+		assert.NoError(t, tracker.Reset(ctx, "ip:10.0.0.1"))
+		wait, _ = tracker.Wait(ctx, "ip:10.0.0.1")
+		assert.Zero(t, wait)
+	})
+}
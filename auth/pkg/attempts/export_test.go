@@ -0,0 +1,10 @@
+package attempts
+
+import "time"
+
+// SetNow lets tests move the clock of the tracker.
+func (m *Memory) SetNow(now func() time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = now
+}
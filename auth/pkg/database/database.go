@@ -4,22 +4,25 @@ import (
 	"context"
 	"os"
 
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jackgris/twitter-backend/auth/pkg/logger"
 )
 
-func ConnectDB(ctx context.Context, log *logger.Logger) *pgx.Conn {
-	conn, err := pgx.Connect(ctx, os.Getenv("DATABASE_URL"))
+// ConnectDB opens a pool of connections, so the requests, the event
+// subscribers and the background jobs don't wait for each other. The pool
+// size can be set with pool_max_conns in DATABASE_URL.
+func ConnectDB(ctx context.Context, log *logger.Logger) *pgxpool.Pool {
+	pool, err := pgxpool.New(ctx, os.Getenv("DATABASE_URL"))
 	if err != nil {
 		log.Error(ctx, "Unable to connect to database", "Can't open DB connection", err)
 		os.Exit(1)
 	}
 
-	err = conn.Ping(ctx)
+	err = pool.Ping(ctx)
 	if err != nil {
 		log.Error(ctx, "Connection database", "ERROR", err)
 		os.Exit(1)
 	}
 
-	return conn
+	return pool
 }
@@ -0,0 +1,116 @@
+// Package mailer sends the emails of the auth service, like the email
+// verification links.
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackgris/twitter-backend/auth/pkg/uuid"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends messages. SMTP is used in production, File and Memory for
+// local development and tests.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTP sends messages through an SMTP server.
+type SMTP struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTP creates a mailer for the server at addr (host:port). The username
+// and password are optional, servers used for development often don't ask
+// for them.
+func NewSMTP(addr, from, username, password string) *SMTP {
+	var auth smtp.Auth
+	if username != "" {
+		host, _, _ := strings.Cut(addr, ":")
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTP{addr: addr, from: from, auth: auth}
+}
+
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	if err := smtp.SendMail(s.addr, s.auth, s.from, []string{msg.To}, format(s.from, msg)); err != nil {
+		return fmt.Errorf("sending email: %w", err)
+	}
+	return nil
+}
+
+// File writes every message as an .eml file in a directory instead of
+// sending it.
+type File struct {
+	dir  string
+	from string
+}
+
+func NewFile(dir, from string) *File {
+	return &File{dir: dir, from: from}
+}
+
+func (f *File) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(f.dir, 0o755); err != nil {
+		return fmt.Errorf("creating mail directory: %w", err)
+	}
+
+	name := time.Now().Format("20060102T150405") + "-" + uuid.New() + ".eml"
+	if err := os.WriteFile(filepath.Join(f.dir, name), format(f.from, msg), 0o600); err != nil {
+		return fmt.Errorf("writing email: %w", err)
+	}
+	return nil
+}
+
+// Memory keeps the messages it sends, for tests.
+type Memory struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent so far.
+func (m *Memory) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Message(nil), m.messages...)
+}
+
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + msg.Subject + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
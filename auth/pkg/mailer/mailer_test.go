@@ -0,0 +1,37 @@
+package mailer_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jackgris/twitter-backend/auth/pkg/mailer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m := mailer.NewFile(dir, "no-reply@twitter.local")
+
+	err := m.Send(context.Background(), mailer.Message{To: "jack@mail.com", Subject: "Hi", Body: "line 1\nline 2"})
+	assert.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	data, err := os.ReadFile(files[0])
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "To: jack@mail.com\r\n")
+	assert.Contains(t, string(data), "Subject: Hi\r\n")
+	assert.Contains(t, string(data), "\r\n\r\nline 1\r\nline 2")
+}
+
+func TestMemory(t *testing.T) {
+	m := mailer.NewMemory()
+	msg := mailer.Message{To: "jack@mail.com", Subject: "Hi", Body: "Hello"}
+
+	assert.NoError(t, m.Send(context.Background(), msg))
+	assert.Equal(t, []mailer.Message{msg}, m.Messages())
+}
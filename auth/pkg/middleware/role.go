@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+)
+
+// Role is carried by the role claim of access tokens.
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// ParseRole returns the role named s, or false when there is no such role.
+func ParseRole(s string) (Role, bool) {
+	role := Role(s)
+	switch role {
+	case RoleUser, RoleModerator, RoleAdmin:
+		return role, true
+	}
+	return RoleUser, false
+}
+
+// Roles tells the current role of a user. Each service answers from its own
+// copy of the roles.
+type Roles interface {
+	Role(userID string) (string, error)
+}
+
+var errRoleCheck = errors.New("can't check the role")
+
+// CheckRoles makes Authorize and Identify take the role of users from roles
+// instead of their access tokens, which keep the role they were issued with
+// until they expire. It has to be called before serving requests.
+func (k *KeySet) CheckRoles(roles Roles) {
+	k.roles = roles
+}
+
+// currentRole returns the role userID has now, or role, the one of their
+// access token, when roles aren't checked.
+func (k *KeySet) currentRole(userID string, role Role) (Role, error) {
+	if k.roles == nil {
+		return role, nil
+	}
+
+	name, err := k.roles.Role(userID)
+	if err != nil {
+		return "", errRoleCheck
+	}
+	role, _ = ParseRole(name)
+
+	return role, nil
+}
+
+// Permission is an action only some roles can take.
+type Permission string
+
+const (
+	// PermDeleteContent deletes the tweets of other users
+	PermDeleteContent Permission = "content:delete"
+	// PermSuspendUsers suspends and unsuspends accounts
+	PermSuspendUsers Permission = "users:suspend"
+	// PermLogoutUsers revokes every session of other users
+	PermLogoutUsers Permission = "users:logout"
+	// PermReadSessions lists the sessions of other users
+	PermReadSessions Permission = "users:sessions"
+	// PermDeleteUsers deletes accounts with all their content
+	PermDeleteUsers Permission = "users:delete"
+	// PermManageRoles changes the roles of users
+	PermManageRoles Permission = "users:roles"
+	// PermUnlockLogins forgets the failed logins of an account or an IP
+	PermUnlockLogins Permission = "logins:unlock"
+	// PermManageBots creates bot accounts and their API keys
+	PermManageBots Permission = "bots:manage"
+)
+
+// rolePermissions is what each role can do besides what every user can.
+// Admins can do everything.
+var rolePermissions = map[Role][]Permission{
+	RoleModerator: {PermDeleteContent, PermSuspendUsers, PermLogoutUsers},
+}
+
+// Can reports whether the role has the permission.
+func (r Role) Can(perm Permission) bool {
+	if r == RoleAdmin {
+		return true
+	}
+	return slices.Contains(rolePermissions[r], perm)
+}
+
+// Can reports whether the user of the claims has the permission. API keys
+// have none, whatever the role of their bot.
+func (c Claims) Can(perm Permission) bool {
+	if c.APIKeyID != "" {
+		return false
+	}
+	return c.Role.Can(perm)
+}
+
+// Require rejects users without the permission. It has to run after
+// Authorize, which puts the claims it checks on the context.
+func Require(next http.HandlerFunc, perm Permission) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := ClaimsFromContext(r.Context())
+		if !ok {
+			http.Error(w, "missing access token", http.StatusUnauthorized)
+			return
+		}
+
+		if !claims.Can(perm) {
+			http.Error(w, "you don't have the "+string(perm)+" permission", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
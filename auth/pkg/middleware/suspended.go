@@ -0,0 +1,38 @@
+package middleware
+
+import "errors"
+
+// Suspensions tells whether a user is suspended. Each service answers from
+// its own copy of the suspended users.
+type Suspensions interface {
+	IsSuspended(userID string) (bool, error)
+}
+
+var (
+	errSuspended       = errors.New("account suspended")
+	errSuspensionCheck = errors.New("can't check the account")
+)
+
+// RejectSuspended makes Authorize and Identify reject the access tokens of
+// suspended users, which are otherwise valid until they expire. It has to be
+// called before serving requests.
+func (k *KeySet) RejectSuspended(suspensions Suspensions) {
+	k.suspensions = suspensions
+}
+
+// checkSuspended returns errSuspended when userID is suspended.
+func (k *KeySet) checkSuspended(userID string) error {
+	if k.suspensions == nil {
+		return nil
+	}
+
+	suspended, err := k.suspensions.IsSuspended(userID)
+	if err != nil {
+		return errSuspensionCheck
+	}
+	if suspended {
+		return errSuspended
+	}
+
+	return nil
+}
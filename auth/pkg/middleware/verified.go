@@ -0,0 +1,22 @@
+package middleware
+
+import "net/http"
+
+// VerifiedEmail rejects users who didn't verify their email yet. It has to
+// run after Authorize, which puts the claims it checks on the context.
+func VerifiedEmail(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := ClaimsFromContext(r.Context())
+		if !ok {
+			http.Error(w, "missing access token", http.StatusUnauthorized)
+			return
+		}
+
+		if !claims.EmailVerified {
+			http.Error(w, "verify your email first", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
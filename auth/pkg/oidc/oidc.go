@@ -0,0 +1,216 @@
+// Package oidc logs users in with an external OpenID Connect provider using
+// the authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackgris/twitter-backend/auth/pkg/middleware"
+)
+
+var (
+	ErrInvalidIDToken = errors.New("invalid ID token")
+	ErrExchange       = errors.New("exchanging authorization code")
+)
+
+// Config identifies this service as a client of the provider.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is where the provider sends the user back with the code,
+	// it has to be registered with the provider
+	RedirectURL string
+	// Scopes requested besides openid
+	Scopes []string
+}
+
+// Provider is an OpenID Connect provider found through its discovery
+// document.
+type Provider struct {
+	config        Config
+	client        *http.Client
+	authEndpoint  string
+	tokenEndpoint string
+	keys          *middleware.KeySet
+}
+
+// Discover fetches the discovery document of the issuer in config.
+func Discover(ctx context.Context, config Config) (*Provider, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	wellKnown := strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching discovery document: status %d", resp.StatusCode)
+	}
+
+	var doc struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decoding discovery document: %w", err)
+	}
+
+	if doc.Issuer != config.Issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %q, expected %q", doc.Issuer, config.Issuer)
+	}
+
+	keys, err := middleware.NewKeySet(doc.JWKSURI, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Provider{
+		config:        config,
+		client:        client,
+		authEndpoint:  doc.AuthorizationEndpoint,
+		tokenEndpoint: doc.TokenEndpoint,
+		keys:          keys,
+	}, nil
+}
+
+// Issuer is the identifier of the provider, subjects are only unique within
+// it.
+func (p *Provider) Issuer() string {
+	return p.config.Issuer
+}
+
+// AuthCodeURL is where the user is sent to log in. state and nonce are
+// random values checked on the way back, verifier is the PKCE code verifier
+// only sent when exchanging the code.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, p.config.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(p.authEndpoint, "?") {
+		sep = "&"
+	}
+	return p.authEndpoint + sep + params.Encode()
+}
+
+// Challenge is the S256 PKCE code challenge of verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// IDToken holds the claims of a verified ID token this service uses.
+type IDToken struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// Exchange trades the authorization code for the tokens of the user and
+// returns the verified ID token. nonce is the one sent in AuthCodeURL.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (IDToken, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"client_id":     {p.config.ClientID},
+		"code_verifier": {verifier},
+	}
+	if p.config.ClientSecret != "" {
+		form.Set("client_secret", p.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return IDToken{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return IDToken{}, fmt.Errorf("%w: %w", ErrExchange, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return IDToken{}, fmt.Errorf("%w: status %d", ErrExchange, resp.StatusCode)
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return IDToken{}, fmt.Errorf("%w: %w", ErrExchange, err)
+	}
+
+	return p.verify(ctx, tokens.IDToken, nonce)
+}
+
+// verify checks the signature, issuer, audience, expiry and nonce of an ID
+// token.
+func (p *Provider) verify(ctx context.Context, raw, nonce string) (IDToken, error) {
+	if raw == "" {
+		return IDToken{}, fmt.Errorf("%w: missing", ErrInvalidIDToken)
+	}
+
+	_, claims, err := p.keys.ValidateJwt(ctx, raw)
+	if err != nil {
+		return IDToken{}, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+
+	if iss, _ := claims.GetIssuer(); iss != p.config.Issuer {
+		return IDToken{}, fmt.Errorf("%w: issuer %q", ErrInvalidIDToken, iss)
+	}
+	if aud, _ := claims.GetAudience(); !slices.Contains(aud, p.config.ClientID) {
+		return IDToken{}, fmt.Errorf("%w: audience %v", ErrInvalidIDToken, aud)
+	}
+	if exp, _ := claims.GetExpirationTime(); exp == nil {
+		return IDToken{}, fmt.Errorf("%w: missing expiry", ErrInvalidIDToken)
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return IDToken{}, fmt.Errorf("%w: nonce doesn't match", ErrInvalidIDToken)
+	}
+
+	var id IDToken
+	id.Subject, _ = claims.GetSubject()
+	id.Email, _ = claims["email"].(string)
+	id.EmailVerified, _ = claims["email_verified"].(bool)
+	id.Name, _ = claims["name"].(string)
+	id.PreferredUsername, _ = claims["preferred_username"].(string)
+	if id.Subject == "" {
+		return IDToken{}, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,91 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/jackgris/twitter-backend/auth/pkg/oidc"
+	"github.com/jackgris/twitter-backend/auth/pkg/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+)
+
+// login follows the authorization URL to the mock provider and returns the
+// code and state it redirects back with.
+func login(t *testing.T, authURL string) (string, string) {
+	t.Helper()
+
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	assert.NoError(t, err)
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestProvider(t *testing.T) {
+	user := oidctest.User{Subject: "sub-1", Email: "jack@mail.com", EmailVerified: true, Name: "Jack", PreferredUsername: "jack"}
+	issuer, err := oidctest.NewIssuer("twitter-backend", user)
+	assert.NoError(t, err)
+	defer issuer.Close()
+
+	ctx := context.Background()
+	provider, err := oidc.Discover(ctx, oidc.Config{
+		Issuer:      issuer.URL,
+		ClientID:    "twitter-backend",
+		RedirectURL: "http://localhost:8080/auth/oidc/callback",
+		Scopes:      []string{"email", "profile"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, issuer.URL, provider.Issuer())
+
+	t.Run("Login OK", func(t *testing.T) {
+		code, state := login(t, provider.AuthCodeURL("state-1", "nonce-1", "verifier-1"))
+		assert.Equal(t, "state-1", state)
+
+		id, err := provider.Exchange(ctx, code, "verifier-1", "nonce-1")
+		assert.NoError(t, err)
+		assert.Equal(t, "sub-1", id.Subject)
+		assert.Equal(t, "jack@mail.com", id.Email)
+		assert.True(t, id.EmailVerified)
+		assert.Equal(t, "jack", id.PreferredUsername)
+	})
+
+	t.Run("Wrong PKCE verifier", func(t *testing.T) {
+		code, _ := login(t, provider.AuthCodeURL("state-1", "nonce-1", "verifier-1"))
+
+		_, err := provider.Exchange(ctx, code, "another verifier", "nonce-1")
+		assert.ErrorIs(t, err, oidc.ErrExchange)
+	})
+
+	t.Run("Wrong nonce", func(t *testing.T) {
+		code, _ := login(t, provider.AuthCodeURL("state-1", "nonce-1", "verifier-1"))
+
+		_, err := provider.Exchange(ctx, code, "verifier-1", "nonce-2")
+		assert.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+	})
+
+	t.Run("Codes are single use", func(t *testing.T) {
+		code, _ := login(t, provider.AuthCodeURL("state-1", "nonce-1", "verifier-1"))
+
+		_, err := provider.Exchange(ctx, code, "verifier-1", "nonce-1")
+		assert.NoError(t, err)
+		_, err = provider.Exchange(ctx, code, "verifier-1", "nonce-1")
+		assert.ErrorIs(t, err, oidc.ErrExchange)
+	})
+}
+
+func TestDiscoverWrongIssuer(t *testing.T) {
+	issuer, err := oidctest.NewIssuer("twitter-backend", oidctest.User{Subject: "sub-1"})
+	assert.NoError(t, err)
+	defer issuer.Close()
+
+	_, err = oidc.Discover(context.Background(), oidc.Config{Issuer: issuer.URL + "/other", ClientID: "twitter-backend"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,218 @@
+// Package oidctest is a mock OpenID Connect provider for tests and local
+// development. Its authorization endpoint logs in its user right away and
+// redirects back with a code, and its token endpoint checks the PKCE verifier
+// like a real one.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackgris/twitter-backend/auth/pkg/oidc"
+	"github.com/jackgris/twitter-backend/auth/pkg/uuid"
+)
+
+const keyID = "oidctest"
+
+// User is the user the mock provider logs in.
+type User struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// Issuer is a mock provider, URL is the issuer it puts in the ID tokens.
+type Issuer struct {
+	URL      string
+	ClientID string
+
+	key    *rsa.PrivateKey
+	mux    *http.ServeMux
+	server *httptest.Server
+
+	mu    sync.Mutex
+	user  User
+	codes map[string]grant
+}
+
+type grant struct {
+	user        User
+	redirectURI string
+	challenge   string
+	nonce       string
+}
+
+// New returns a mock provider for clientID logging in user, to be served at
+// issuerURL.
+func New(issuerURL, clientID string, user User) (*Issuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	i := &Issuer{
+		URL:      issuerURL,
+		ClientID: clientID,
+		key:      key,
+		mux:      http.NewServeMux(),
+		user:     user,
+		codes:    make(map[string]grant),
+	}
+	i.mux.HandleFunc("GET /.well-known/openid-configuration", i.discovery)
+	i.mux.HandleFunc("GET /jwks", i.jwks)
+	i.mux.HandleFunc("GET /authorize", i.authorize)
+	i.mux.HandleFunc("POST /token", i.token)
+
+	return i, nil
+}
+
+// NewIssuer starts a mock provider on a local test server. Close it when
+// done.
+func NewIssuer(clientID string, user User) (*Issuer, error) {
+	i, err := New("", clientID, user)
+	if err != nil {
+		return nil, err
+	}
+
+	i.server = httptest.NewServer(i)
+	i.URL = i.server.URL
+
+	return i, nil
+}
+
+// Close stops the test server started by NewIssuer.
+func (i *Issuer) Close() {
+	if i.server != nil {
+		i.server.Close()
+	}
+}
+
+func (i *Issuer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	i.mux.ServeHTTP(w, r)
+}
+
+// SetUser changes the user logged in from now on.
+func (i *Issuer) SetUser(user User) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.user = user
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"issuer":                           i.URL,
+		"authorization_endpoint":           i.URL + "/authorize",
+		"token_endpoint":                   i.URL + "/token",
+		"jwks_uri":                         i.URL + "/jwks",
+		"code_challenge_methods_supported": []string{"S256"},
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(i.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(i.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (i *Issuer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != i.ClientID || q.Get("response_type") != "code" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	if q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Host == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code := uuid.New()
+	i.mu.Lock()
+	i.codes[code] = grant{
+		user:        i.user,
+		redirectURI: redirect.String(),
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+	}
+	i.mu.Unlock()
+
+	params := redirect.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	redirect.RawQuery = params.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	// Codes are single use
+	i.mu.Lock()
+	g, ok := i.codes[r.PostForm.Get("code")]
+	delete(i.codes, r.PostForm.Get("code"))
+	i.mu.Unlock()
+
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" ||
+		r.PostForm.Get("client_id") != i.ClientID ||
+		r.PostForm.Get("redirect_uri") != g.redirectURI ||
+		oidc.Challenge(r.PostForm.Get("code_verifier")) != g.challenge {
+		http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                i.URL,
+		"sub":                g.user.Subject,
+		"aud":                i.ClientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              g.nonce,
+		"email":              g.user.Email,
+		"email_verified":     g.user.EmailVerified,
+		"name":               g.user.Name,
+		"preferred_username": g.user.PreferredUsername,
+	})
+	token.Header["kid"] = keyID
+	idToken, err := token.SignedString(i.key)
+	if err != nil {
+		http.Error(w, "server_error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"access_token": uuid.New(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
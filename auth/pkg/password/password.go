@@ -0,0 +1,131 @@
+// Package password hashes and verifies user passwords with argon2id.
+//
+// Hashes are stored in the PHC string format:
+//
+//	$argon2id$v=19$m=65536,t=1,p=4$<salt>$<key>
+//
+// The encoded parameters travel with every hash, so the cost can be raised
+// later and old hashes upgraded the next time the user logs in.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const prefix = "$argon2id$"
+
+// Params are the argon2id cost parameters used to derive a key.
+type Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultParams follows the OWASP recommendation for argon2id.
+var DefaultParams = Params{
+	Memory:      64 * 1024,
+	Iterations:  1,
+	Parallelism: 4,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+var ErrInvalidHash = errors.New("password: invalid encoded hash")
+
+// Hash derives a new key from plain with a random salt. It returns the
+// encoded hash and the base64 salt, which is also stored on its own.
+func Hash(plain string) (string, string, error) {
+	return hashWith(plain, DefaultParams)
+}
+
+func hashWith(plain string, p Params) (string, string, error) {
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", "", fmt.Errorf("password: reading salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(plain), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	b64Salt := base64.RawStdEncoding.EncodeToString(salt)
+	encoded := fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		prefix, argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		b64Salt, base64.RawStdEncoding.EncodeToString(key))
+
+	return encoded, b64Salt, nil
+}
+
+// IsHashed reports whether stored is an argon2id hash. Anything else is a
+// legacy plaintext password written before hashing was introduced.
+func IsHashed(stored string) bool {
+	return strings.HasPrefix(stored, prefix)
+}
+
+// Verify checks plain against the stored password. needsRehash is true when
+// the password matched but stored is plaintext or was hashed with parameters
+// other than DefaultParams, so the caller should hash and save it again.
+func Verify(plain, stored string) (ok bool, needsRehash bool, err error) {
+	if stored == "" {
+		return false, false, nil
+	}
+
+	if !IsHashed(stored) {
+		ok = subtle.ConstantTimeCompare([]byte(plain), []byte(stored)) == 1
+		return ok, ok, nil
+	}
+
+	p, salt, key, err := decode(stored)
+	if err != nil {
+		return false, false, err
+	}
+
+	other := argon2.IDKey([]byte(plain), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return false, false, nil
+	}
+
+	return true, p != DefaultParams, nil
+}
+
+func decode(encoded string) (Params, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+	if version != argon2.Version {
+		return Params{}, nil, nil, fmt.Errorf("password: unsupported argon2 version %d", version)
+	}
+
+	var p Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+	p.SaltLength = uint32(len(salt))
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+	p.KeyLength = uint32(len(key))
+
+	return p, salt, key, nil
+}
@@ -0,0 +1,66 @@
+package password_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jackgris/twitter-backend/auth/pkg/password"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashAndVerify(t *testing.T) {
+	encoded, salt, err := password.Hash("s3cret-pass")
+	assert.NoError(t, err)
+	assert.True(t, password.IsHashed(encoded))
+	assert.True(t, strings.HasPrefix(encoded, "$argon2id$v=19$m=65536,t=1,p=4$"+salt+"$"))
+
+	ok, rehash, err := password.Verify("s3cret-pass", encoded)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+
+	ok, rehash, err = password.Verify("wrong-pass", encoded)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.False(t, rehash)
+
+	other, _, err := password.Hash("s3cret-pass")
+	assert.NoError(t, err)
+	assert.NotEqual(t, encoded, other, "every hash uses its own salt")
+}
+
+func TestVerify(t *testing.T) {
+	// "s3cret-pass" hashed with t=2, a cost that differs from DefaultParams.
+	outdated := "$argon2id$v=19$m=65536,t=2,p=4$c29tZXNhbHRzb21lc2FsdA$" +
+		"HX+tVhnpYx1lh0uzXfcJt1kbq97zmafihxAiNgqZdqA"
+
+	tests := []struct {
+		name       string
+		plain      string
+		stored     string
+		wantOK     bool
+		wantRehash bool
+		wantErr    bool
+	}{
+		{name: "Plaintext match", plain: "1234", stored: "1234", wantOK: true, wantRehash: true},
+		{name: "Plaintext mismatch", plain: "1235", stored: "1234"},
+		{name: "Empty stored password", plain: "", stored: ""},
+		{name: "Malformed hash", plain: "1234", stored: "$argon2id$v=19$broken", wantErr: true},
+		{name: "Unsupported version", plain: "1234", stored: "$argon2id$v=16$m=1,t=1,p=1$c2FsdA$a2V5", wantErr: true},
+		{name: "Outdated params match", plain: "s3cret-pass", stored: outdated, wantOK: true, wantRehash: true},
+		{name: "Outdated params mismatch", plain: "1234", stored: outdated},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ok, rehash, err := password.Verify(test.plain, test.stored)
+			if test.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.wantOK, ok)
+			assert.Equal(t, test.wantRehash, rehash)
+		})
+	}
+}
@@ -0,0 +1,10 @@
+package ratelimit
+
+import "time"
+
+// SetNow lets tests move the clock of the limiter.
+func (l *Window) SetNow(now func() time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.now = now
+}
@@ -0,0 +1,75 @@
+// Package ratelimit caps how many actions a key, like a user, can take in a
+// fixed window of time.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter caps the actions of each key. Window works for a single replica,
+// replicas sharing the limits need a Limiter backed by the database.
+type Limiter interface {
+	// Take takes up to n actions for key, as many as are left in its
+	// window. It returns how many it took and when the window ends and its
+	// actions are available again.
+	Take(ctx context.Context, key string, n int) (int, time.Time, error)
+}
+
+// Window lets each key take up to Limit actions every Period. It keeps the
+// counts in memory, so every replica of a service has its own.
+type Window struct {
+	Limit  int
+	Period time.Duration
+
+	mu      sync.Mutex
+	now     func() time.Time
+	windows map[string]window
+}
+
+var _ Limiter = (*Window)(nil)
+
+type window struct {
+	start time.Time
+	used  int
+}
+
+func NewWindow(limit int, period time.Duration) *Window {
+	return &Window{
+		Limit:   limit,
+		Period:  period,
+		now:     time.Now,
+		windows: make(map[string]window),
+	}
+}
+
+func (l *Window) Take(_ context.Context, key string, n int) (int, time.Time, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	t := l.now()
+	w := l.windows[key]
+	if t.Sub(w.start) >= l.Period {
+		w = window{start: t}
+	}
+
+	taken := max(min(n, l.Limit-w.used), 0)
+	w.used += taken
+	l.windows[key] = w
+	l.sweep(t)
+	return taken, w.start.Add(l.Period), nil
+}
+
+// sweep drops the windows that ended once there are many of them, so the
+// map doesn't grow with every key ever seen.
+func (l *Window) sweep(t time.Time) {
+	if len(l.windows) < 10000 {
+		return
+	}
+	for key, w := range l.windows {
+		if t.Sub(w.start) >= l.Period {
+			delete(l.windows, key)
+		}
+	}
+}
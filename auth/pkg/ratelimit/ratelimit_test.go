@@ -0,0 +1,43 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackgris/twitter-backend/auth/pkg/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindow(t *testing.T) {
+	ctx := context.Background()
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := ratelimit.NewWindow(3, time.Hour)
+	l.SetNow(func() time.Time { return clock })
+
+	taken, reset, err := l.Take(ctx, "user-1", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, taken)
+	assert.Equal(t, clock.Add(time.Hour), reset)
+
+	// Only what is left in the window is taken
+	taken, _, err = l.Take(ctx, "user-1", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, taken)
+
+	taken, reset, err = l.Take(ctx, "user-1", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, taken)
+	assert.Equal(t, clock.Add(time.Hour), reset)
+
+	// Other keys have their own window
+	taken, _, err = l.Take(ctx, "user-2", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, taken)
+
+	clock = clock.Add(time.Hour)
+	taken, reset, err = l.Take(ctx, "user-1", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, taken)
+	assert.Equal(t, clock.Add(time.Hour), reset)
+}
@@ -0,0 +1,50 @@
+package token
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+)
+
+// JWK is the public part of a signing key as described in RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys other services validate access tokens with.
+func (i *Issuer) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range i.keys {
+		set.Keys = append(set.Keys, publicJWK(key.ID, &key.Private.PublicKey))
+	}
+	return set
+}
+
+// PublicKeys returns the public keys by kid.
+func (i *Issuer) PublicKeys() map[string]*rsa.PublicKey {
+	keys := make(map[string]*rsa.PublicKey, len(i.keys))
+	for _, key := range i.keys {
+		keys[key.ID] = &key.Private.PublicKey
+	}
+	return keys
+}
+
+func publicJWK(kid string, key *rsa.PublicKey) JWK {
+	return JWK{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
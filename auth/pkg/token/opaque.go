@@ -0,0 +1,27 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// NewOpaque returns a random URL safe token with 256 bits of entropy.
+// Opaque tokens are handed to the client once and only their hash is stored.
+func NewOpaque() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("reading random token: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashOpaque returns the hex SHA-256 of an opaque token. The tokens are
+// random, so a plain digest is enough and allows looking them up by hash.
+func HashOpaque(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,33 @@
+package token_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackgris/twitter-backend/auth/pkg/token"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigner(t *testing.T) {
+	signer := token.NewSigner([]byte("secret"))
+	signed := signer.Sign("verify-email", "user-1 jack@mail.com", time.Now().Add(time.Hour))
+
+	value, err := signer.Verify("verify-email", signed)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1 jack@mail.com", value)
+
+	_, err = signer.Verify("reset-password", signed)
+	assert.ErrorIs(t, err, token.ErrInvalidSignedToken, "tokens are bound to their purpose")
+
+	_, err = token.NewSigner([]byte("other")).Verify("verify-email", signed)
+	assert.ErrorIs(t, err, token.ErrInvalidSignedToken)
+
+	payload, mac, _ := strings.Cut(signed, ".")
+	_, err = signer.Verify("verify-email", payload+"x."+mac)
+	assert.ErrorIs(t, err, token.ErrInvalidSignedToken)
+
+	expired := signer.Sign("verify-email", "user-1 jack@mail.com", time.Now().Add(-time.Second))
+	_, err = signer.Verify("verify-email", expired)
+	assert.ErrorIs(t, err, token.ErrExpiredSignedToken)
+}
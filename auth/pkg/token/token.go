@@ -0,0 +1,172 @@
+// Package token issues the RS256 access tokens validated by the middleware
+// package of every service.
+package token
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackgris/twitter-backend/auth/pkg/uuid"
+)
+
+// Claims are the claims carried by an access token. The name, ID,
+// email_verified, role and sid claims are the ones middleware.Authorize
+// reads.
+type Claims struct {
+	Name          string `json:"name"`
+	UserID        string `json:"ID"`
+	EmailVerified bool   `json:"email_verified"`
+	Role          string `json:"role"`
+	SessionID     string `json:"sid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Identity is the user an access token is issued for.
+type Identity struct {
+	UserID        string
+	Username      string
+	EmailVerified bool
+	Role          string
+	// SessionID is the token family of the refresh token issued with it
+	SessionID string
+}
+
+// Key is an RSA signing key and the kid it is published with.
+type Key struct {
+	ID      string
+	Private *rsa.PrivateKey
+}
+
+type Issuer struct {
+	keys       []Key
+	signing    Key
+	issuer     string
+	audience   string
+	ttl        time.Duration
+	refreshTTL time.Duration
+}
+
+// NewIssuer signs with the key whose ID is signingKeyID, or with the last
+// key when it is empty. Every key is published in the JWKS, so tokens signed
+// with a key that is being rotated out stay valid until it is removed.
+func NewIssuer(keys []Key, signingKeyID, issuer, audience string, ttl, refreshTTL time.Duration) (*Issuer, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing keys")
+	}
+
+	signing := keys[len(keys)-1]
+	if signingKeyID != "" {
+		found := false
+		for _, key := range keys {
+			if key.ID == signingKeyID {
+				signing = key
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("signing key %q not found", signingKeyID)
+		}
+	}
+
+	return &Issuer{
+		keys:       keys,
+		signing:    signing,
+		issuer:     issuer,
+		audience:   audience,
+		ttl:        ttl,
+		refreshTTL: refreshTTL,
+	}, nil
+}
+
+// LoadKeys reads every PEM encoded RSA private key in dir. The file name
+// without its extension is used as kid and keys are sorted by it, so naming
+// the files by creation date makes the newest key the default signing key.
+func LoadKeys(dir string) ([]Key, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("listing keys: %w", err)
+	}
+
+	var keys []Key
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading private key: %w", err)
+		}
+
+		private, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing private key %s: %w", path, err)
+		}
+
+		keys = append(keys, Key{
+			ID:      strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+			Private: private,
+		})
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+
+	return keys, nil
+}
+
+// Issue signs an access token for the user and returns it with its expiry.
+func (i *Issuer) Issue(id Identity) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(i.ttl)
+
+	claims := Claims{
+		Name:          id.Username,
+		UserID:        id.UserID,
+		EmailVerified: id.EmailVerified,
+		Role:          id.Role,
+		SessionID:     id.SessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New(),
+			Subject:   id.UserID,
+			Issuer:    i.issuer,
+			Audience:  jwt.ClaimStrings{i.audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	t.Header["kid"] = i.signing.ID
+
+	signed, err := t.SignedString(i.signing.Private)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("signing access token: %w", err)
+	}
+
+	return signed, expiresAt, nil
+}
+
+// IssueRefresh creates a new opaque refresh token. It returns the token for
+// the client, its hash for storage and its expiry.
+func (i *Issuer) IssueRefresh() (string, string, time.Time, error) {
+	refresh, err := NewOpaque()
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+
+	return refresh, HashOpaque(refresh), time.Now().Add(i.refreshTTL), nil
+}
+
+// Claims returns the iss and aud of the issued access tokens.
+func (i *Issuer) Claims() (issuer, audience string) {
+	return i.issuer, i.audience
+}
+
+// TTL is how long issued access tokens stay valid.
+func (i *Issuer) TTL() time.Duration {
+	return i.ttl
+}
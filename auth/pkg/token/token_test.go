@@ -0,0 +1,94 @@
+package token_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackgris/twitter-backend/auth/pkg/token"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIssue(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	issuer, err := token.NewIssuer([]token.Key{{ID: "key-1", Private: key}}, "", "auth-test", "twitter-test", time.Minute, time.Hour)
+	assert.NoError(t, err)
+
+	signed, expiresAt, err := issuer.Issue(token.Identity{UserID: "csvqda265b6s73dtmot0", Username: "jackgris", EmailVerified: true, Role: "moderator"})
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), expiresAt, time.Second)
+
+	parsed, err := jwt.Parse(signed, func(t *jwt.Token) (interface{}, error) {
+		return &key.PublicKey, nil
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer("auth-test"),
+		jwt.WithAudience("twitter-test"),
+		jwt.WithExpirationRequired(),
+	)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "key-1", parsed.Header["kid"])
+
+	claims := parsed.Claims.(jwt.MapClaims)
+	assert.Equal(t, "jackgris", claims["name"])
+	assert.Equal(t, "csvqda265b6s73dtmot0", claims["ID"])
+	assert.Equal(t, "csvqda265b6s73dtmot0", claims["sub"])
+	assert.Equal(t, "moderator", claims["role"])
+	assert.Equal(t, true, claims["email_verified"])
+	assert.NotEmpty(t, claims["jti"])
+}
+
+func TestIssueRefresh(t *testing.T) {
+	issuer, err := token.NewIssuer([]token.Key{{ID: "key-1"}}, "", "auth-test", "twitter-test", time.Minute, time.Hour)
+	assert.NoError(t, err)
+
+	refresh, hash, expiresAt, err := issuer.IssueRefresh()
+	assert.NoError(t, err)
+	assert.Len(t, refresh, 43)
+	assert.Equal(t, token.HashOpaque(refresh), hash)
+	assert.NotEqual(t, refresh, hash)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, time.Second)
+
+	other, _, _, err := issuer.IssueRefresh()
+	assert.NoError(t, err)
+	assert.NotEqual(t, refresh, other)
+}
+
+func TestSigningKeyRotation(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	keys := []token.Key{{ID: "2024-01", Private: oldKey}, {ID: "2024-06", Private: newKey}}
+
+	issuer, err := token.NewIssuer(keys, "", "auth-test", "twitter-test", time.Minute, time.Hour)
+	assert.NoError(t, err)
+
+	signed, _, err := issuer.Issue(token.Identity{UserID: "csvqda265b6s73dtmot0", Username: "jackgris"})
+	assert.NoError(t, err)
+	parsed, _, err := jwt.NewParser().ParseUnverified(signed, jwt.MapClaims{})
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-06", parsed.Header["kid"], "the last key signs by default")
+
+	jwks := issuer.JWKS()
+	assert.Len(t, jwks.Keys, 2, "both keys stay published")
+	assert.Equal(t, "2024-01", jwks.Keys[0].Kid)
+	assert.Equal(t, "AQAB", jwks.Keys[0].E)
+	assert.Equal(t, "RS256", jwks.Keys[1].Alg)
+
+	issuer, err = token.NewIssuer(keys, "2024-01", "auth-test", "twitter-test", time.Minute, time.Hour)
+	assert.NoError(t, err)
+	signed, _, err = issuer.Issue(token.Identity{UserID: "csvqda265b6s73dtmot0", Username: "jackgris"})
+	assert.NoError(t, err)
+	parsed, _, err = jwt.NewParser().ParseUnverified(signed, jwt.MapClaims{})
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-01", parsed.Header["kid"])
+
+	_, err = token.NewIssuer(keys, "missing", "auth-test", "twitter-test", time.Minute, time.Hour)
+	assert.Error(t, err)
+}
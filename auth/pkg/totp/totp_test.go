@@ -0,0 +1,76 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/jackgris/twitter-backend/auth/pkg/totp"
+	"github.com/stretchr/testify/assert"
+)
+
+// secret is the SHA-1 key of the test vectors of RFC 6238, appendix B.
+var secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// The RFC vectors have 8 digits, the last 6 are the 6 digit codes
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, test := range tests {
+		code, err := totp.Code(secret, totp.Step(time.Unix(test.unix, 0)))
+		assert.NoError(t, err)
+		assert.Equal(t, test.code, code)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, err := totp.Code(secret, totp.Step(now))
+	assert.NoError(t, err)
+
+	t.Run("Current code", func(t *testing.T) {
+		step, ok := totp.Validate(secret, code, now)
+		assert.True(t, ok)
+		assert.Equal(t, totp.Step(now), step)
+	})
+
+	t.Run("Previous step is accepted", func(t *testing.T) {
+		_, ok := totp.Validate(secret, code, now.Add(totp.Period))
+		assert.True(t, ok)
+	})
+
+	t.Run("Old code", func(t *testing.T) {
+		_, ok := totp.Validate(secret, code, now.Add(3*totp.Period))
+		assert.False(t, ok)
+	})
+
+	t.Run("Wrong code", func(t *testing.T) {
+		_, ok := totp.Validate(secret, "000000", now)
+		assert.False(t, ok)
+		_, ok = totp.Validate(secret, "12345", now)
+		assert.False(t, ok)
+	})
+}
+
+func TestURI(t *testing.T) {
+	secret, err := totp.NewSecret()
+	assert.NoError(t, err)
+
+	uri, err := url.Parse(totp.URI("Twitter Backend", "jack", secret))
+	assert.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Twitter Backend:jack", uri.Path)
+	assert.Equal(t, secret, uri.Query().Get("secret"))
+	assert.Equal(t, "Twitter Backend", uri.Query().Get("issuer"))
+}
@@ -1,13 +1,17 @@
 package validator
 
 import (
+	"fmt"
+	"net/url"
 	"regexp"
+	"unicode"
 	"unicode/utf8"
 )
 
 var (
 	EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
-	NameRX  = regexp.MustCompile(`^[a-zA-Z\s'-]+$`)
+	// NameRX matches the handles users are known by, like @dev_ops42
+	NameRX = regexp.MustCompile(`^[a-zA-Z0-9_]{1,15}$`)
 )
 
 type Validator struct {
@@ -64,7 +68,43 @@ func ValidateEmail(v *Validator, email string) {
 
 func ValidateName(v *Validator, name string) {
 	v.Check(name != "", "name", "must be provided")
-	v.Check(utf8.RuneCountInString(name) > 5, "name", "must be longer than 5 characters")
-	v.Check(utf8.RuneCountInString(name) < 200, "name", "must be shorter")
-	v.Check(Matches(name, NameRX), "name", "must be a valid name")
+	v.Check(Matches(name, NameRX), "name", "must have up to 15 letters, numbers or underscores")
+}
+
+// ValidateDisplayName checks the optional name shown next to the handle,
+// which can have any letter, space or emoji.
+func ValidateDisplayName(v *Validator, name string) {
+	ValidateText(v, "display_name", name, 50)
+}
+
+// ValidateText checks an optional free text field, like the bio, isn't
+// longer than max characters and has no control characters. Line breaks are
+// allowed.
+func ValidateText(v *Validator, key, text string, max int) {
+	v.Check(utf8.ValidString(text), key, "must be valid UTF-8")
+	v.Check(utf8.RuneCountInString(text) <= max, key, fmt.Sprintf("must have a maximum of %d characters", max))
+	for _, r := range text {
+		if unicode.IsControl(r) && r != '\n' {
+			v.AddError(key, "can't have control characters")
+			break
+		}
+	}
+}
+
+// ValidateURL checks an optional link, like the website of a user, is an
+// absolute http or https URL.
+func ValidateURL(v *Validator, key, link string) {
+	if link == "" {
+		return
+	}
+
+	v.Check(len(link) <= 500, key, "must have a maximum of 500 characters")
+	u, err := url.Parse(link)
+	v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", key, "must be a valid http or https URL")
+}
+
+func ValidatePassword(v *Validator, password string) {
+	v.Check(password != "", "password", "must be provided")
+	v.Check(utf8.RuneCountInString(password) >= 4, "password", "must have a minimum of 4 characters")
+	v.Check(utf8.RuneCountInString(password) <= 72, "password", "must have a maximum of 72 characters")
 }
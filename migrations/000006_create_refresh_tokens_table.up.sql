@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id TEXT PRIMARY KEY,
+    user_id TEXT REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+    family_id TEXT NOT NULL,          -- Every token rotated from the same login
+    token_hash TEXT UNIQUE NOT NULL,  -- SHA-256 of the token, the token itself is never stored
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    rotated_at TIMESTAMP,             -- Set once the token was exchanged for a new one
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS refresh_tokens_user_id_idx ON refresh_tokens (user_id);
@@ -0,0 +1,2 @@
+-- Incremented on every profile update, used for optimistic concurrency (ETag / If-Match)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
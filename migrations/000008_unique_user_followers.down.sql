@@ -0,0 +1,3 @@
+ALTER TABLE user_followers DROP CONSTRAINT IF EXISTS user_followers_no_self_follow;
+DROP INDEX IF EXISTS user_followers_follower_id_idx;
+DROP INDEX IF EXISTS user_followers_user_id_follower_id_idx;
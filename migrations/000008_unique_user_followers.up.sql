@@ -0,0 +1,16 @@
+-- Keep a single row for every follow and drop self-follows
+DELETE FROM user_followers a
+USING user_followers b
+WHERE a.user_id = b.user_id AND a.follower_id = b.follower_id AND a.id > b.id;
+
+DELETE FROM user_followers WHERE user_id = follower_id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS user_followers_user_id_follower_id_idx ON user_followers (user_id, follower_id);
+CREATE INDEX IF NOT EXISTS user_followers_follower_id_idx ON user_followers (follower_id);
+
+ALTER TABLE user_followers ADD CONSTRAINT user_followers_no_self_follow CHECK (user_id <> follower_id);
+
+-- The counters drifted while follows were not transactional, recompute them
+UPDATE users u SET
+    follower_count = (SELECT COUNT(*) FROM user_followers uf WHERE uf.user_id = u.id),
+    following_count = (SELECT COUNT(*) FROM user_followers uf WHERE uf.follower_id = u.id);
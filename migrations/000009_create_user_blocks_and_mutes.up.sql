@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS user_blocks (
+    id TEXT PRIMARY KEY,
+    user_id TEXT REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,   -- User who blocks
+    target_id TEXT REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL, -- Blocked user
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (user_id, target_id),
+    CHECK (user_id <> target_id)
+);
+
+CREATE INDEX IF NOT EXISTS user_blocks_target_id_idx ON user_blocks (target_id);
+
+CREATE TABLE IF NOT EXISTS user_mutes (
+    id TEXT PRIMARY KEY,
+    user_id TEXT REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,   -- User who mutes
+    target_id TEXT REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL, -- Muted user
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (user_id, target_id),
+    CHECK (user_id <> target_id)
+);
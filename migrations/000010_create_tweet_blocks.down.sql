@@ -0,0 +1 @@
+DROP TABLE tweet_blocks;
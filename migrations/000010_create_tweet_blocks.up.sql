@@ -0,0 +1,7 @@
+-- Copy of the blocks owned by the auth service, kept up to date from the
+-- user_blocked and user_unblocked events
+CREATE TABLE IF NOT EXISTS tweet_blocks (
+    user_id TEXT NOT NULL,    -- User who blocks
+    target_id TEXT NOT NULL,  -- Blocked user
+    PRIMARY KEY (user_id, target_id)
+);
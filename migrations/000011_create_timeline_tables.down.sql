@@ -0,0 +1,2 @@
+DROP TABLE timeline_filters;
+DROP TABLE timeline_entries;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS timeline_entries (
+    user_id TEXT NOT NULL,         -- Owner of the timeline
+    tweet_id TEXT NOT NULL,
+    author_id TEXT NOT NULL,       -- Author of the tweet
+    content TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, tweet_id)
+);
+
+-- Authors hidden from a timeline, kept up to date from the block and mute
+-- events of the auth service
+CREATE TABLE IF NOT EXISTS timeline_filters (
+    user_id TEXT NOT NULL,         -- Owner of the timeline
+    author_id TEXT NOT NULL,       -- Hidden author
+    reason TEXT NOT NULL,          -- block or mute
+    PRIMARY KEY (user_id, author_id, reason)
+);
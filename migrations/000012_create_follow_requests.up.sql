@@ -0,0 +1,10 @@
+-- Protected users approve who can follow them and see their tweets
+ALTER TABLE users ADD COLUMN IF NOT EXISTS protected BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS follow_requests (
+    id TEXT PRIMARY KEY,
+    user_id TEXT REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,     -- Protected user
+    follower_id TEXT REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL, -- User who asks to follow
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (user_id, follower_id)
+);
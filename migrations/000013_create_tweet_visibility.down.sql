@@ -0,0 +1,2 @@
+DROP TABLE tweet_follows;
+DROP TABLE tweet_protected_users;
@@ -0,0 +1,15 @@
+-- Copies of the protected users and follows owned by the auth service, kept
+-- up to date from its events, used to hide the tweets of protected users
+CREATE TABLE IF NOT EXISTS tweet_protected_users (
+    user_id TEXT PRIMARY KEY
+);
+
+CREATE TABLE IF NOT EXISTS tweet_follows (
+    user_id TEXT NOT NULL,      -- Followed user
+    follower_id TEXT NOT NULL,
+    PRIMARY KEY (user_id, follower_id)
+);
+
+INSERT INTO tweet_follows (user_id, follower_id)
+SELECT user_id, follower_id FROM user_followers
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,2 @@
+-- Set when the user opens the link sent to their email, cleared when the email changes
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id TEXT PRIMARY KEY,
+    user_id TEXT REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+    token_hash TEXT UNIQUE NOT NULL,  -- SHA-256 of the token sent by email, the token itself is never stored
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP                 -- Set once the password was reset, with this or another token of the user
+);
+
+CREATE INDEX IF NOT EXISTS password_reset_tokens_user_id_idx ON password_reset_tokens (user_id);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS users_display_name_prefix_idx;
+DROP INDEX IF EXISTS users_display_name_trgm_idx;
+DROP INDEX IF EXISTS users_username_lower_key;
+ALTER TABLE users DROP COLUMN IF EXISTS website;
+ALTER TABLE users DROP COLUMN IF EXISTS location;
+ALTER TABLE users DROP COLUMN IF EXISTS avatar_url;
+ALTER TABLE users DROP COLUMN IF EXISTS bio;
+ALTER TABLE users DROP COLUMN IF EXISTS display_name;
@@ -0,0 +1,13 @@
+-- Optional profile of the users, shown next to their handle
+ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS bio TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS location TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS website TEXT NOT NULL DEFAULT '';
+
+-- Handles are unique ignoring case, @Jack and @jack are the same user. Fails
+-- if there are already usernames that only differ in case, rename them first.
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_lower_key ON users (lower(username));
+
+CREATE INDEX IF NOT EXISTS users_display_name_trgm_idx ON users USING GIN (lower(display_name) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_display_name_prefix_idx ON users (lower(display_name) text_pattern_ops);
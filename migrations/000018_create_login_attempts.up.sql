@@ -0,0 +1,7 @@
+-- Failed logins per account and per IP address, used to slow down password
+-- guessing. Keys look like account:<login> or ip:<address>.
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS user_mfa (
+    user_id TEXT PRIMARY KEY REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    secret TEXT NOT NULL,              -- Base32 TOTP secret, needed to compute the codes so it can't be hashed
+    created_at TIMESTAMP NOT NULL,
+    enabled_at TIMESTAMP,              -- NULL until the user confirms the enrollment with a code
+    last_step BIGINT NOT NULL DEFAULT 0 -- Time step of the last code used, older or equal steps are rejected
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id TEXT PRIMARY KEY,
+    user_id TEXT REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+    code_hash TEXT NOT NULL,           -- SHA-256 of the code, the code itself is only shown once
+    used_at TIMESTAMP,
+    UNIQUE (user_id, code_hash)
+);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id TEXT PRIMARY KEY,              -- The family_id of the refresh tokens of the session
+    user_id TEXT REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',      -- Where the session was last used from
+    created_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS user_sessions_user_id_idx ON user_sessions (user_id, last_used_at DESC);
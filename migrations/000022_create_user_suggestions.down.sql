@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS users_follower_count_idx;
+DROP TABLE suggestion_dismissals;
+DROP TABLE user_suggestions;
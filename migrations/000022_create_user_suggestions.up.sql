@@ -0,0 +1,22 @@
+-- Who to follow, recomputed periodically by the auth service
+CREATE TABLE IF NOT EXISTS user_suggestions (
+    user_id TEXT REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,      -- User the suggestion is for
+    candidate_id TEXT REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL, -- Suggested user
+    score DOUBLE PRECISION NOT NULL,
+    friends_of_friends INTEGER NOT NULL, -- Users followed by the user that follow the candidate
+    mutual_followers INTEGER NOT NULL,   -- Users following both
+    computed_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, candidate_id)
+);
+
+CREATE INDEX IF NOT EXISTS user_suggestions_score_idx ON user_suggestions (user_id, score DESC);
+
+CREATE TABLE IF NOT EXISTS suggestion_dismissals (
+    user_id TEXT REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+    candidate_id TEXT REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, candidate_id)
+);
+
+-- Popular users are suggested to users without suggestions yet
+CREATE INDEX IF NOT EXISTS users_follower_count_idx ON users (follower_count DESC);
@@ -0,0 +1,5 @@
+DROP TABLE timeline_suspended_users;
+DROP TABLE tweet_suspended_users;
+ALTER TABLE users DROP COLUMN IF EXISTS suspension_reason;
+ALTER TABLE users DROP COLUMN IF EXISTS suspended_at;
+ALTER TABLE users DROP COLUMN IF EXISTS role;
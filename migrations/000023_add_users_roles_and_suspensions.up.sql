@@ -0,0 +1,17 @@
+-- What a user is allowed to do, carried by the role claim of the access tokens
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'user'
+    CHECK (role IN ('user', 'moderator', 'admin'));
+
+-- Set while the account is suspended by a moderator
+ALTER TABLE users ADD COLUMN IF NOT EXISTS suspended_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS suspension_reason TEXT NOT NULL DEFAULT '';
+
+-- Copies of the suspended users owned by the auth service, kept up to date
+-- from its events, used to reject their tokens and hide their tweets
+CREATE TABLE IF NOT EXISTS tweet_suspended_users (
+    user_id TEXT PRIMARY KEY
+);
+
+CREATE TABLE IF NOT EXISTS timeline_suspended_users (
+    user_id TEXT PRIMARY KEY
+);
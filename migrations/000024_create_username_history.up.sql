@@ -0,0 +1,12 @@
+-- Previous usernames of the users. An old handle keeps pointing to its user
+-- and nobody else can take it until reserved_until
+CREATE TABLE IF NOT EXISTS username_history (
+    id TEXT PRIMARY KEY,
+    user_id TEXT REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+    username TEXT NOT NULL,           -- The username before the change
+    changed_at TIMESTAMP NOT NULL,
+    reserved_until TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS username_history_username_idx ON username_history (lower(username), reserved_until DESC);
+CREATE INDEX IF NOT EXISTS username_history_user_id_idx ON username_history (user_id, changed_at DESC);
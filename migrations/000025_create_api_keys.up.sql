@@ -0,0 +1,21 @@
+-- Bot accounts belong to no person, they can't log in and call the services
+-- with API keys
+ALTER TABLE users ADD COLUMN IF NOT EXISTS bot BOOLEAN NOT NULL DEFAULT false;
+
+-- API keys of the bot accounts. Only the SHA-256 of a key is stored, the
+-- prefix is the start of the key shown in listings to tell keys apart
+CREATE TABLE IF NOT EXISTS api_keys (
+    id TEXT PRIMARY KEY,
+    user_id TEXT REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE NOT NULL,
+    name TEXT NOT NULL,
+    prefix TEXT UNIQUE NOT NULL,
+    key_hash TEXT UNIQUE NOT NULL,
+    scopes TEXT[] NOT NULL,           -- Like tweet:write or timeline:read
+    created_by TEXT NOT NULL,         -- The admin who created it
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP,             -- NULL never expires
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id, created_at DESC);
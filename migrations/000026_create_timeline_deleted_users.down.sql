@@ -0,0 +1 @@
+DROP TABLE timeline_deleted_users;
@@ -0,0 +1,7 @@
+-- Users deleted in the auth service. The followers topic is replayed from the
+-- beginning on restarts, in no order with the users topic, so their tweets
+-- are skipped instead of being added back to the timelines
+CREATE TABLE IF NOT EXISTS timeline_deleted_users (
+    user_id TEXT PRIMARY KEY,
+    deleted_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,7 @@
+-- Actions taken per key in the current window, like the follows a user
+-- imported this hour. Keys look like import:<user ID>.
+CREATE TABLE IF NOT EXISTS rate_limits (
+    key TEXT PRIMARY KEY,
+    window_start TIMESTAMP NOT NULL,
+    used INTEGER NOT NULL
+);
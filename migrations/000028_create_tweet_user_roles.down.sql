@@ -0,0 +1 @@
+DROP TABLE tweet_user_roles;
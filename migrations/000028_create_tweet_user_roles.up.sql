@@ -0,0 +1,11 @@
+-- Copy of the roles owned by the auth service, kept up to date from its
+-- events, so a moderator loses their permissions as soon as they are demoted.
+-- Regular users have no row
+CREATE TABLE IF NOT EXISTS tweet_user_roles (
+    user_id TEXT PRIMARY KEY,
+    role TEXT NOT NULL
+);
+
+INSERT INTO tweet_user_roles (user_id, role)
+SELECT id, role FROM users WHERE role <> 'user'
+ON CONFLICT (user_id) DO NOTHING;
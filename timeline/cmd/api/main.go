@@ -15,6 +15,7 @@ import (
 	"github.com/jackgris/twitter-backend/timeline/internal/store/timelinedb"
 	"github.com/jackgris/twitter-backend/timeline/pkg/database"
 	"github.com/jackgris/twitter-backend/timeline/pkg/logger"
+	"github.com/jackgris/twitter-backend/timeline/pkg/middleware"
 	"github.com/jackgris/twitter-backend/timeline/pkg/msgbroker"
 )
 
@@ -32,7 +33,7 @@ func main() {
 func run(ctx context.Context, serviceName string, log *logger.Logger) error {
 
 	db := database.ConnectDB(ctx, log)
-	defer db.Close(ctx)
+	defer db.Close()
 
 	store := timelinedb.NewStore(db)
 	msgBrokerPath := os.Getenv("NATS_URL")
@@ -42,7 +43,18 @@ func run(ctx context.Context, serviceName string, log *logger.Logger) error {
 	}
 
 	msgbroker := msgbroker.NewMsgBroker(serviceName, msgBrokerPath, log)
-	mux := handler.NewHandler(store, msgbroker, log)
+	keys, err := middleware.NewKeySet(getEnv("JWKS_URL", "http://localhost:8081/.well-known/jwks.json"), os.Getenv("JWT_PUBLIC_KEY"))
+	if err != nil {
+		log.Error(ctx, serviceName, "Loading JWT public keys", err)
+		os.Exit(1)
+	}
+	keys.RequireClaims(getEnv("JWT_ISSUER", "twitter-backend-auth"), getEnv("JWT_AUDIENCE", "twitter-backend"))
+	keys.RejectSuspended(store)
+	apiKeys := middleware.NewAPIKeyClient(getEnv("API_KEYS_URL", "http://localhost:8081/api-keys/verify"))
+	// The timeline is only read, its reads and writes need the same scope
+	keys.AcceptAPIKeys(apiKeys, middleware.ScopeTimelineRead, middleware.ScopeTimelineRead)
+
+	mux, t := handler.NewHandler(store, msgbroker, keys, log)
 
 	portEnv := os.Getenv("PORT")
 	port, err := strconv.Atoi(portEnv)
@@ -66,6 +78,18 @@ func run(ctx context.Context, serviceName string, log *logger.Logger) error {
 		serverErrors <- srv.ListenAndServe()
 	}()
 
+	go func() {
+		t.SubscribeFollowers()
+	}()
+
+	go func() {
+		t.SubscribeRelationships()
+	}()
+
+	go func() {
+		t.SubscribeUsers()
+	}()
+
 	// -------------------------------------------------------------------------
 	// Shutdown
 
@@ -78,6 +102,8 @@ func run(ctx context.Context, serviceName string, log *logger.Logger) error {
 		log.Info(ctx, serviceName+" shutdown", "status", "shutdown started", "signal", sig)
 		defer log.Info(ctx, serviceName+" shutdown", "status", "shutdown complete", "signal", sig)
 
+		msgbroker.Close()
+
 		ctx, cancel := context.WithTimeout(ctx, time.Microsecond*500)
 		defer cancel()
 
@@ -89,3 +115,10 @@ func run(ctx context.Context, serviceName string, log *logger.Logger) error {
 
 	return nil
 }
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
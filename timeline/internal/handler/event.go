@@ -1,9 +1,13 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"time"
 
 	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/jackgris/twitter-backend/timeline/internal/domain/timelinemodel"
 	"github.com/jackgris/twitter-backend/timeline/pkg/msgbroker"
 )
 
@@ -40,3 +44,151 @@ func NewGetFollowers(userID string) *message.Message {
 
 	return message.NewMessage(event.Header.ID, getFollowersMsg)
 }
+
+// FollowersEvent is published by the auth service with the followers of the
+// author of a new tweet.
+type FollowersEvent struct {
+	Header      msgbroker.Header `json:"header"`
+	UserID      string           `json:"user_id"`
+	TweetID     string           `json:"tweet_id"`
+	Content     string           `json:"content"`
+	FollowersID []string         `json:"followers_id"`
+}
+
+// RelationshipEvent is published by the auth service on the relationships
+// topic when a user blocks, unblocks, mutes or unmutes another.
+type RelationshipEvent struct {
+	Header   msgbroker.Header `json:"header"`
+	UserID   string           `json:"user_id"`
+	TargetID string           `json:"target_id"`
+}
+
+// UserEvent is published by the auth service on the users topic when a user
+// is suspended (user_suspended), unsuspended (user_unsuspended) or deleted
+// (user_deleted).
+type UserEvent struct {
+	Header msgbroker.Header `json:"header"`
+	UserID string           `json:"user_id"`
+}
+
+// SubscribeFollowers adds every new tweet to the timelines of the followers
+// of its author.
+func (t *TimelineHandler) SubscribeFollowers() {
+	ctx := context.Background()
+	messages, err := t.msgBroker.SubscribeEvents("followers")
+	if err != nil {
+		t.logs.Error(ctx, "timeline service", "reading paylod followers", err)
+		return
+	}
+
+	for msg := range messages {
+		msg.Ack()
+		followers := FollowersEvent{}
+		err := json.Unmarshal(msg.Payload, &followers)
+		if err != nil {
+			t.logs.Error(ctx, "timeline service", "reading paylod followers", err)
+			continue
+		}
+
+		if len(followers.FollowersID) == 0 {
+			continue
+		}
+
+		tweet := timelinemodel.Tweet{
+			Id:        followers.TweetID,
+			UserID:    followers.UserID,
+			Content:   followers.Content,
+			CreatedAt: time.Now(),
+		}
+		err = t.store.AddToTimelines(tweet, followers.FollowersID)
+		if err != nil {
+			t.logs.Error(ctx, "timeline service", "adding tweet to timelines", err, "msg ID", msg.UUID)
+		}
+	}
+}
+
+// SubscribeRelationships keeps the authors hidden from every timeline up to
+// date. A block hides both users from each other, a mute only hides the
+// muted user from the one who muted.
+func (t *TimelineHandler) SubscribeRelationships() {
+	ctx := context.Background()
+	messages, err := t.msgBroker.SubscribeEvents("relationships")
+	if err != nil {
+		t.logs.Error(ctx, "timeline service", "reading paylod relationships", err)
+		return
+	}
+
+	for msg := range messages {
+		msg.Ack()
+		rel := RelationshipEvent{}
+		err := json.Unmarshal(msg.Payload, &rel)
+		if err != nil {
+			t.logs.Error(ctx, "timeline service", "reading paylod relationships", err)
+			continue
+		}
+
+		if err := t.applyRelationship(rel); err != nil {
+			t.logs.Error(ctx, "timeline service", "saving relationship", err, "event", rel.Header.EventName, "msg ID", msg.UUID)
+		}
+	}
+}
+
+// SubscribeUsers hides the tweets of suspended users and removes deleted
+// users from every timeline. Other events of the users topic don't change
+// timelines and are ignored.
+func (t *TimelineHandler) SubscribeUsers() {
+	ctx := context.Background()
+	messages, err := t.msgBroker.SubscribeEvents("users")
+	if err != nil {
+		t.logs.Error(ctx, "timeline service", "reading paylod users", err)
+		return
+	}
+
+	for msg := range messages {
+		msg.Ack()
+		user := UserEvent{}
+		err := json.Unmarshal(msg.Payload, &user)
+		if err != nil {
+			t.logs.Error(ctx, "timeline service", "reading paylod users", err)
+			continue
+		}
+
+		if err := t.applyUser(user); err != nil {
+			t.logs.Error(ctx, "timeline service", "saving user", err, "event", user.Header.EventName, "msg ID", msg.UUID)
+		}
+	}
+}
+
+// applyRelationship updates the hidden authors for a relationship event.
+func (t *TimelineHandler) applyRelationship(rel RelationshipEvent) error {
+	switch rel.Header.EventName {
+	case "user_blocked":
+		return errors.Join(
+			t.store.AddFilter(rel.UserID, rel.TargetID, "block"),
+			t.store.AddFilter(rel.TargetID, rel.UserID, "block"),
+		)
+	case "user_unblocked":
+		return errors.Join(
+			t.store.RemoveFilter(rel.UserID, rel.TargetID, "block"),
+			t.store.RemoveFilter(rel.TargetID, rel.UserID, "block"),
+		)
+	case "user_muted":
+		return t.store.AddFilter(rel.UserID, rel.TargetID, "mute")
+	case "user_unmuted":
+		return t.store.RemoveFilter(rel.UserID, rel.TargetID, "mute")
+	}
+	return nil
+}
+
+// applyUser updates the suspended and deleted users for a users event.
+func (t *TimelineHandler) applyUser(user UserEvent) error {
+	switch user.Header.EventName {
+	case "user_suspended":
+		return t.store.SetSuspended(user.UserID, true)
+	case "user_unsuspended":
+		return t.store.SetSuspended(user.UserID, false)
+	case "user_deleted":
+		return t.store.PurgeUser(user.UserID)
+	}
+	return nil
+}
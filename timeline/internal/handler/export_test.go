@@ -0,0 +1,8 @@
+package handler
+
+// ApplyRelationship and ApplyUser let the tests apply events without a
+// message broker.
+var (
+	ApplyRelationship = (*TimelineHandler).applyRelationship
+	ApplyUser         = (*TimelineHandler).applyUser
+)
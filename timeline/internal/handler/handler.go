@@ -1,41 +1,47 @@
 package handler
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 
 	"github.com/jackgris/twitter-backend/timeline/internal/domain/timelinemodel"
 	"github.com/jackgris/twitter-backend/timeline/pkg/logger"
 	"github.com/jackgris/twitter-backend/timeline/pkg/middleware"
 	"github.com/jackgris/twitter-backend/timeline/pkg/msgbroker"
+	"github.com/jackgris/twitter-backend/timeline/pkg/uuid"
 )
 
 type TimelineHandler struct {
 	logs      *logger.Logger
 	store     Store
 	msgBroker *msgbroker.MsgBroker
+	keys      *middleware.KeySet
 }
 
-func NewTweetHandler(store Store, msgBroker *msgbroker.MsgBroker, logs *logger.Logger) TimelineHandler {
+func NewTweetHandler(store Store, msgBroker *msgbroker.MsgBroker, keys *middleware.KeySet, logs *logger.Logger) TimelineHandler {
 	return TimelineHandler{
 		store:     store,
 		msgBroker: msgBroker,
+		keys:      keys,
 		logs:      logs,
 	}
 }
 
-func NewHandler(store Store, msgBroker *msgbroker.MsgBroker, logs *logger.Logger) *http.ServeMux {
+func NewHandler(store Store, msgBroker *msgbroker.MsgBroker, keys *middleware.KeySet, logs *logger.Logger) (*http.ServeMux, *TimelineHandler) {
 	t := TimelineHandler{
 		store:     store,
 		msgBroker: msgBroker,
+		keys:      keys,
 		logs:      logs,
 	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /helthz", middleware.LogResponse(healthCheckHandler, t.logs))
-	mux.HandleFunc("GET /timeline", middleware.LogResponse(t.GetTimelineHandler, t.logs))
-	mux.HandleFunc("GET /update", middleware.LogResponse(t.UpdateTimelineHandler, t.logs))
+	mux.HandleFunc("GET /timeline", middleware.LogResponse(middleware.Authorize(t.GetTimelineHandler, t.keys), t.logs))
+	mux.HandleFunc("GET /update", middleware.LogResponse(middleware.Authorize(t.UpdateTimelineHandler, t.keys), t.logs))
 
-	return mux
+	return mux, &t
 }
 
 func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
@@ -45,12 +51,68 @@ func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 type Store interface {
 	GetTimeline(userID string) ([]timelinemodel.Tweet, error)
 	UpdateTimeline(userID, tweetID string) ([]timelinemodel.Tweet, error)
+	AddToTimelines(tweet timelinemodel.Tweet, userIDs []string) error
+	AddFilter(userID, authorID, reason string) error
+	RemoveFilter(userID, authorID, reason string) error
+	SetSuspended(userID string, suspended bool) error
+	IsSuspended(userID string) (bool, error)
+	PurgeUser(userID string) error
 }
 
+// GetTimelineHandler returns the latest tweets of the users the caller
+// follows.
 func (t *TimelineHandler) GetTimelineHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
+	claims, ok := middleware.ClaimsFromContext(r.Context())
+	if !ok {
+		http.Error(w, "missing access token", http.StatusUnauthorized)
+		return
+	}
+
+	tweets, err := t.store.GetTimeline(claims.UserID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to retrieve timeline: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeTimeline(w, tweets)
 }
 
+// UpdateTimelineHandler returns the tweets newer than the last_id query
+// parameter, the ID of the newest tweet the client already has.
 func (t *TimelineHandler) UpdateTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middleware.ClaimsFromContext(r.Context())
+	if !ok {
+		http.Error(w, "missing access token", http.StatusUnauthorized)
+		return
+	}
+
+	lastID := r.URL.Query().Get("last_id")
+	if lastID == "" {
+		http.Error(w, "last_id query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	if ok := uuid.IsValid(lastID); !ok {
+		http.Error(w, "tweet id invalid", http.StatusBadRequest)
+		return
+	}
+
+	tweets, err := t.store.UpdateTimeline(claims.UserID, lastID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to retrieve timeline: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeTimeline(w, tweets)
+}
+
+func writeTimeline(w http.ResponseWriter, tweets []timelinemodel.Tweet) {
+	timeline := []Tweet{}
+	for _, tweet := range tweets {
+		timeline = append(timeline, TweetToJSON(tweet))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(timeline)
 }
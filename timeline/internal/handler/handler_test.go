@@ -0,0 +1,161 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jackgris/twitter-backend/timeline/internal/domain/timelinemodel"
+	"github.com/jackgris/twitter-backend/timeline/internal/handler"
+	"github.com/jackgris/twitter-backend/timeline/pkg/logger"
+	"github.com/jackgris/twitter-backend/timeline/pkg/middleware"
+	"github.com/jackgris/twitter-backend/timeline/pkg/msgbroker"
+	"github.com/stretchr/testify/assert"
+)
+
+type filter struct {
+	userID, authorID, reason string
+}
+
+// MockStore records the filters, suspensions and purges it is asked for.
+type MockStore struct {
+	GetTimelineFunc func(userID string) ([]timelinemodel.Tweet, error)
+	Filters         map[filter]bool
+	Suspended       map[string]bool
+	Purged          []string
+}
+
+func NewMockStore() *MockStore {
+	return &MockStore{
+		Filters:   map[filter]bool{},
+		Suspended: map[string]bool{},
+	}
+}
+
+func (m *MockStore) GetTimeline(userID string) ([]timelinemodel.Tweet, error) {
+	if m.GetTimelineFunc != nil {
+		return m.GetTimelineFunc(userID)
+	}
+	return nil, nil
+}
+func (m *MockStore) UpdateTimeline(userID, tweetID string) ([]timelinemodel.Tweet, error) {
+	return nil, nil
+}
+func (m *MockStore) AddToTimelines(tweet timelinemodel.Tweet, userIDs []string) error {
+	return nil
+}
+func (m *MockStore) AddFilter(userID, authorID, reason string) error {
+	m.Filters[filter{userID, authorID, reason}] = true
+	return nil
+}
+func (m *MockStore) RemoveFilter(userID, authorID, reason string) error {
+	delete(m.Filters, filter{userID, authorID, reason})
+	return nil
+}
+func (m *MockStore) SetSuspended(userID string, suspended bool) error {
+	m.Suspended[userID] = suspended
+	return nil
+}
+func (m *MockStore) IsSuspended(userID string) (bool, error) {
+	return m.Suspended[userID], nil
+}
+func (m *MockStore) PurgeUser(userID string) error {
+	m.Purged = append(m.Purged, userID)
+	return nil
+}
+
+func relationship(name, userID, targetID string) handler.RelationshipEvent {
+	return handler.RelationshipEvent{Header: msgbroker.NewHeader(name), UserID: userID, TargetID: targetID}
+}
+
+func TestApplyRelationship(t *testing.T) {
+	t.Run("Block hides both users from each other", func(t *testing.T) {
+		store := NewMockStore()
+		h := handler.NewTweetHandler(store, nil, nil, logger.New(io.Discard))
+
+		err := handler.ApplyRelationship(&h, relationship("user_blocked", "user-1", "user-2"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[filter]bool{
+			{"user-1", "user-2", "block"}: true,
+			{"user-2", "user-1", "block"}: true,
+		}, store.Filters)
+
+		err = handler.ApplyRelationship(&h, relationship("user_unblocked", "user-1", "user-2"))
+
+		assert.NoError(t, err)
+		assert.Empty(t, store.Filters)
+	})
+
+	t.Run("Mute only hides the muted user", func(t *testing.T) {
+		store := NewMockStore()
+		h := handler.NewTweetHandler(store, nil, nil, logger.New(io.Discard))
+
+		err := handler.ApplyRelationship(&h, relationship("user_muted", "user-1", "user-2"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[filter]bool{{"user-1", "user-2", "mute"}: true}, store.Filters)
+	})
+
+	t.Run("Unmute keeps a block", func(t *testing.T) {
+		store := NewMockStore()
+		h := handler.NewTweetHandler(store, nil, nil, logger.New(io.Discard))
+
+		assert.NoError(t, handler.ApplyRelationship(&h, relationship("user_blocked", "user-1", "user-2")))
+		assert.NoError(t, handler.ApplyRelationship(&h, relationship("user_muted", "user-1", "user-2")))
+		assert.NoError(t, handler.ApplyRelationship(&h, relationship("user_unmuted", "user-1", "user-2")))
+
+		assert.True(t, store.Filters[filter{"user-1", "user-2", "block"}])
+		assert.False(t, store.Filters[filter{"user-1", "user-2", "mute"}])
+	})
+}
+
+func TestApplyUser(t *testing.T) {
+	store := NewMockStore()
+	h := handler.NewTweetHandler(store, nil, nil, logger.New(io.Discard))
+
+	event := func(name string) handler.UserEvent {
+		return handler.UserEvent{Header: msgbroker.NewHeader(name), UserID: "user-1"}
+	}
+
+	assert.NoError(t, handler.ApplyUser(&h, event("user_suspended")))
+	assert.True(t, store.Suspended["user-1"])
+
+	assert.NoError(t, handler.ApplyUser(&h, event("user_unsuspended")))
+	assert.False(t, store.Suspended["user-1"])
+
+	assert.NoError(t, handler.ApplyUser(&h, event("user_deleted")))
+	assert.Equal(t, []string{"user-1"}, store.Purged)
+}
+
+func TestGetTimelineHandler(t *testing.T) {
+	store := NewMockStore()
+	store.GetTimelineFunc = func(userID string) ([]timelinemodel.Tweet, error) {
+		return []timelinemodel.Tweet{{Id: "tweet-1", UserID: "user-2", Content: "hello"}}, nil
+	}
+	h := handler.NewTweetHandler(store, nil, nil, logger.New(io.Discard))
+
+	t.Run("Timeline OK", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/timeline", nil)
+		req = req.WithContext(middleware.ContextWithClaims(req.Context(), middleware.Claims{UserID: "user-1"}))
+		rec := httptest.NewRecorder()
+
+		h.GetTimelineHandler(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var body []map[string]any
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		assert.Len(t, body, 1)
+	})
+
+	t.Run("Timeline without claims", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/timeline", nil)
+		rec := httptest.NewRecorder()
+
+		h.GetTimelineHandler(rec, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
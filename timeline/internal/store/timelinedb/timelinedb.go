@@ -1,10 +1,17 @@
 package timelinedb
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	"github.com/jackgris/twitter-backend/timeline/internal/domain/timelinemodel"
 	"github.com/jackgris/twitter-backend/timeline/internal/store"
 )
 
+// timelineSize is how many tweets a timeline request returns at most.
+const timelineSize = 50
+
 type Store struct {
 	db store.PgxIface
 }
@@ -15,10 +22,249 @@ func NewStore(db store.PgxIface) *Store {
 	}
 }
 
+// GetTimeline returns the latest tweets in the timeline of userID, leaving
+// out suspended and deleted authors and authors the user blocked, muted or
+// was blocked by.
 func (s *Store) GetTimeline(userID string) ([]timelinemodel.Tweet, error) {
-	return []timelinemodel.Tweet{}, nil
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+		SELECT e.tweet_id, e.author_id, e.content, e.created_at
+		FROM timeline_entries e
+		WHERE e.user_id = $1
+		AND NOT EXISTS (
+			SELECT 1 FROM timeline_filters f
+			WHERE f.user_id = e.user_id AND f.author_id = e.author_id
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM timeline_suspended_users s
+			WHERE s.user_id = e.author_id
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM timeline_deleted_users d
+			WHERE d.user_id = e.author_id
+		)
+		ORDER BY e.tweet_id DESC
+		LIMIT $2;
+	`
+	return s.timeline(ctx, query, userID, timelineSize)
 }
 
+// UpdateTimeline returns the tweets in the timeline of userID newer than
+// tweetID, filtered like GetTimeline.
 func (s *Store) UpdateTimeline(userID, tweetID string) ([]timelinemodel.Tweet, error) {
-	return []timelinemodel.Tweet{}, nil
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+		SELECT e.tweet_id, e.author_id, e.content, e.created_at
+		FROM timeline_entries e
+		WHERE e.user_id = $1 AND e.tweet_id > $2
+		AND NOT EXISTS (
+			SELECT 1 FROM timeline_filters f
+			WHERE f.user_id = e.user_id AND f.author_id = e.author_id
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM timeline_suspended_users s
+			WHERE s.user_id = e.author_id
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM timeline_deleted_users d
+			WHERE d.user_id = e.author_id
+		)
+		ORDER BY e.tweet_id DESC
+		LIMIT $3;
+	`
+	return s.timeline(ctx, query, userID, tweetID, timelineSize)
+}
+
+func (s *Store) timeline(ctx context.Context, query string, args ...any) ([]timelinemodel.Tweet, error) {
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	defer rows.Close()
+
+	tweets := []timelinemodel.Tweet{}
+	for rows.Next() {
+		var tweet Tweet
+		err := rows.Scan(&tweet.Id, &tweet.UserID, &tweet.Content, &tweet.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("row scanning failed: %w", err)
+		}
+		tweets = append(tweets, TweetToModel(tweet))
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows iteration failed: %w", rows.Err())
+	}
+
+	return tweets, nil
+}
+
+// AddToTimelines adds the tweet to the timeline of every user in userIDs.
+// Adding a tweet twice does nothing, and the tweets of deleted users and the
+// timelines of deleted followers are skipped, so replayed events are
+// harmless even after the user was purged.
+func (s *Store) AddToTimelines(tweet timelinemodel.Tweet, userIDs []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+		INSERT INTO timeline_entries (user_id, tweet_id, author_id, content, created_at)
+		SELECT f.user_id, $2, $3, $4, $5
+		FROM unnest($1::text[]) AS f(user_id)
+		WHERE NOT EXISTS (
+			SELECT 1 FROM timeline_deleted_users d
+			WHERE d.user_id = f.user_id OR d.user_id = $3
+		)
+		ON CONFLICT (user_id, tweet_id) DO NOTHING;
+	`
+	_, err := s.db.Exec(ctx, query, userIDs, tweet.Id, tweet.UserID, tweet.Content, tweet.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert timeline entries: %w", err)
+	}
+
+	return nil
+}
+
+// AddFilter hides the tweets of authorID from the timeline of userID. The
+// reason, block or mute, is kept so unmuting doesn't undo a block.
+func (s *Store) AddFilter(userID, authorID, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+		INSERT INTO timeline_filters (user_id, author_id, reason)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, author_id, reason) DO NOTHING;
+	`
+	_, err := s.db.Exec(ctx, query, userID, authorID, reason)
+	if err != nil {
+		return fmt.Errorf("failed to insert timeline filter: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) RemoveFilter(userID, authorID, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+		DELETE FROM timeline_filters
+		WHERE user_id = $1 AND author_id = $2 AND reason = $3;
+	`
+	_, err := s.db.Exec(ctx, query, userID, authorID, reason)
+	if err != nil {
+		return fmt.Errorf("failed to delete timeline filter: %w", err)
+	}
+
+	return nil
+}
+
+// SetSuspended marks userID as suspended or not. The tweets of suspended
+// users stay in the timelines but are hidden, so they come back when the
+// suspension is lifted.
+func (s *Store) SetSuspended(userID string, suspended bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+		DELETE FROM timeline_suspended_users
+		WHERE user_id = $1;
+	`
+	if suspended {
+		query = `
+			INSERT INTO timeline_suspended_users (user_id)
+			VALUES ($1)
+			ON CONFLICT (user_id) DO NOTHING;
+		`
+	}
+
+	_, err := s.db.Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update suspended user: %w", err)
+	}
+
+	return nil
+}
+
+// IsSuspended reports whether userID is suspended.
+func (s *Store) IsSuspended(userID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+		SELECT EXISTS (SELECT 1 FROM timeline_suspended_users WHERE user_id = $1);
+	`
+	var suspended bool
+	err := s.db.QueryRow(ctx, query, userID).Scan(&suspended)
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch suspended user: %w", err)
+	}
+
+	return suspended, nil
+}
+
+// PurgeUser removes the timeline of a deleted user, their tweets from every
+// other timeline, the filters that mention them and their suspension, and
+// remembers the user was deleted so replayed tweets aren't added back.
+// Purging a user twice does nothing.
+func (s *Store) PurgeUser(userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	query := `
+		DELETE FROM timeline_entries
+		WHERE user_id = $1 OR author_id = $1;
+	`
+	_, err = tx.Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete timeline entries: %w", err)
+	}
+
+	query = `
+		DELETE FROM timeline_filters
+		WHERE user_id = $1 OR author_id = $1;
+	`
+	_, err = tx.Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete timeline filters: %w", err)
+	}
+
+	query = `
+		DELETE FROM timeline_suspended_users
+		WHERE user_id = $1;
+	`
+	_, err = tx.Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete suspended user: %w", err)
+	}
+
+	query = `
+		INSERT INTO timeline_deleted_users (user_id, deleted_at)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO NOTHING;
+	`
+	_, err = tx.Exec(ctx, query, userID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to insert deleted user: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
 }
@@ -0,0 +1,196 @@
+package timelinedb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackgris/twitter-backend/timeline/internal/domain/timelinemodel"
+	"github.com/jackgris/twitter-backend/timeline/internal/store/timelinedb"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const userID = "csvqvamek44s73e2qf8g"
+
+// hiddenAuthors matches a timeline query that leaves out filtered,
+// suspended and deleted authors.
+const hiddenAuthors = `(?s)FROM timeline_entries e.*timeline_filters f.*timeline_suspended_users s.*timeline_deleted_users d`
+
+func TestGetTimeline(t *testing.T) {
+	mock, err := pgxmock.NewConn()
+	assert.NoError(t, err)
+	defer mock.Close(context.Background())
+
+	now := time.Now()
+	mock.ExpectQuery(hiddenAuthors).
+		WithArgs(userID, 50).
+		WillReturnRows(pgxmock.NewRows([]string{"tweet_id", "author_id", "content", "created_at"}).
+			AddRow("tweet-2", "author-1", "second", now).
+			AddRow("tweet-1", "author-2", "first", now.Add(-time.Minute)))
+
+	store := timelinedb.NewStore(mock)
+	tweets, err := store.GetTimeline(userID)
+
+	assert.NoError(t, err)
+	assert.Len(t, tweets, 2)
+	assert.Equal(t, "tweet-2", tweets[0].Id)
+	assert.Equal(t, "author-1", tweets[0].UserID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateTimeline(t *testing.T) {
+	mock, err := pgxmock.NewConn()
+	assert.NoError(t, err)
+	defer mock.Close(context.Background())
+
+	mock.ExpectQuery(hiddenAuthors).
+		WithArgs(userID, "tweet-1", 50).
+		WillReturnRows(pgxmock.NewRows([]string{"tweet_id", "author_id", "content", "created_at"}))
+
+	store := timelinedb.NewStore(mock)
+	tweets, err := store.UpdateTimeline(userID, "tweet-1")
+
+	assert.NoError(t, err)
+	assert.Empty(t, tweets)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddToTimelines(t *testing.T) {
+	mock, err := pgxmock.NewConn()
+	assert.NoError(t, err)
+	defer mock.Close(context.Background())
+
+	tweet := timelinemodel.Tweet{Id: "tweet-1", UserID: "author-1", Content: "hello", CreatedAt: time.Now()}
+	followers := []string{userID, "follower-2"}
+
+	// Deleted authors and followers are skipped, for replayed events
+	mock.ExpectExec(`(?s)INSERT INTO timeline_entries.*timeline_deleted_users d.*ON CONFLICT`).
+		WithArgs(followers, "tweet-1", "author-1", "hello", tweet.CreatedAt).
+		WillReturnResult(pgxmock.NewResult("INSERT", 2))
+
+	store := timelinedb.NewStore(mock)
+	err = store.AddToTimelines(tweet, followers)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFilters(t *testing.T) {
+	t.Run("Add filter OK", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectExec("INSERT INTO timeline_filters").
+			WithArgs(userID, "author-1", "mute").
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+		store := timelinedb.NewStore(mock)
+		err = store.AddFilter(userID, "author-1", "mute")
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Remove filter OK", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectExec("DELETE FROM timeline_filters").
+			WithArgs(userID, "author-1", "block").
+			WillReturnResult(pgxmock.NewResult("DELETE", 1))
+
+		store := timelinedb.NewStore(mock)
+		err = store.RemoveFilter(userID, "author-1", "block")
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestSetSuspended(t *testing.T) {
+	t.Run("Suspend OK", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectExec("INSERT INTO timeline_suspended_users").
+			WithArgs(userID).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+		store := timelinedb.NewStore(mock)
+		err = store.SetSuspended(userID, true)
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Unsuspend OK", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectExec("DELETE FROM timeline_suspended_users").
+			WithArgs(userID).
+			WillReturnResult(pgxmock.NewResult("DELETE", 1))
+
+		store := timelinedb.NewStore(mock)
+		err = store.SetSuspended(userID, false)
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPurgeUser(t *testing.T) {
+	t.Run("Purge OK", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM timeline_entries").
+			WithArgs(userID).
+			WillReturnResult(pgxmock.NewResult("DELETE", 12))
+		mock.ExpectExec("DELETE FROM timeline_filters").
+			WithArgs(userID).
+			WillReturnResult(pgxmock.NewResult("DELETE", 2))
+		mock.ExpectExec("DELETE FROM timeline_suspended_users").
+			WithArgs(userID).
+			WillReturnResult(pgxmock.NewResult("DELETE", 0))
+		mock.ExpectExec("INSERT INTO timeline_deleted_users").
+			WithArgs(userID, pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		mock.ExpectCommit()
+
+		store := timelinedb.NewStore(mock)
+		err = store.PurgeUser(userID)
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Nothing is purged if a delete fails", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM timeline_entries").
+			WithArgs(userID).
+			WillReturnResult(pgxmock.NewResult("DELETE", 12))
+		mock.ExpectExec("DELETE FROM timeline_filters").
+			WithArgs(userID).
+			WillReturnError(errors.New("connection reset"))
+		mock.ExpectRollback()
+
+		store := timelinedb.NewStore(mock)
+		err = store.PurgeUser(userID)
+
+		assert.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// apiKeyTTL is how long the answer of the auth service about a key is
+	// used, revoking a key takes up to this long to reach the services.
+	apiKeyTTL = 30 * time.Second
+	// maxCachedAPIKeys bounds the cache, so made up keys can't fill the
+	// memory. The cache is emptied when it is full.
+	maxCachedAPIKeys = 10000
+)
+
+// APIKeyClient verifies API keys with the auth service and caches the
+// answers, valid keys and invalid ones alike.
+type APIKeyClient struct {
+	url    string
+	client *http.Client
+	mu     sync.Mutex
+	cache  map[string]cachedAPIKey
+}
+
+type cachedAPIKey struct {
+	key       APIKey
+	err       error
+	expiresAt time.Time
+}
+
+// NewAPIKeyClient creates a client asking the verify endpoint at verifyURL.
+func NewAPIKeyClient(verifyURL string) *APIKeyClient {
+	return &APIKeyClient{
+		url:    verifyURL,
+		client: &http.Client{Timeout: 2 * time.Second},
+		cache:  map[string]cachedAPIKey{},
+	}
+}
+
+// VerifyAPIKey returns the API key, or ErrInvalidAPIKey when the auth
+// service doesn't accept it.
+func (c *APIKeyClient) VerifyAPIKey(ctx context.Context, key string) (APIKey, error) {
+	// The cache is keyed by a digest, the keys themselves aren't kept
+	sum := sha256.Sum256([]byte(key))
+	digest := hex.EncodeToString(sum[:])
+
+	c.mu.Lock()
+	cached, ok := c.cache[digest]
+	c.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.key, cached.err
+	}
+
+	apiKey, err := c.fetch(ctx, key)
+	if err != nil && !errors.Is(err, ErrInvalidAPIKey) {
+		return APIKey{}, err
+	}
+
+	c.mu.Lock()
+	if len(c.cache) >= maxCachedAPIKeys {
+		c.cache = map[string]cachedAPIKey{}
+	}
+	c.cache[digest] = cachedAPIKey{key: apiKey, err: err, expiresAt: time.Now().Add(apiKeyTTL)}
+	c.mu.Unlock()
+
+	return apiKey, err
+}
+
+func (c *APIKeyClient) fetch(ctx context.Context, key string) (APIKey, error) {
+	body, err := json.Marshal(map[string]string{"key": key})
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return APIKey{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return APIKey{}, fmt.Errorf("verifying API key: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return APIKey{}, ErrInvalidAPIKey
+	default:
+		return APIKey{}, fmt.Errorf("verifying API key: unexpected status %d", resp.StatusCode)
+	}
+
+	var apiKey APIKey
+	if err := json.NewDecoder(resp.Body).Decode(&apiKey); err != nil {
+		return APIKey{}, fmt.Errorf("decoding API key: %w", err)
+	}
+
+	return apiKey, nil
+}
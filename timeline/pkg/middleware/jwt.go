@@ -1,63 +1,140 @@
 package middleware
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"errors"
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func Authorize(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
+// Authorize rejects requests without a valid bearer access token or API key,
+// or of a suspended user, and puts the verified claims on the request context
+// for next.
+func Authorize(next http.HandlerFunc, keys *KeySet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
 			http.Error(w, "missing Authorization header", http.StatusUnauthorized)
 			return
 		}
 
-		// Expecting a Bearer token
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			http.Error(w, "invalid Authorization format", http.StatusUnauthorized)
+		claims, err := authenticate(r, keys)
+		if err != nil {
+			http.Error(w, err.Error(), authenticateStatus(err))
 			return
 		}
 
-		token := parts[1]
-		_, claims, err := ValidateJwt(token)
-		if err != nil {
-			http.Error(w, "invalid or expired access token", http.StatusUnauthorized)
+		// If valid, call the next handler
+		next.ServeHTTP(w, r.WithContext(ContextWithClaims(r.Context(), claims)))
+	}
+}
+
+// Identify is Authorize for routes anonymous users can call too. Requests
+// without an Authorization header reach next without claims, but a token
+// that is sent has to be valid.
+func Identify(next http.HandlerFunc, keys *KeySet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		w.Header().Set("usename", claims["name"].(string))
-		w.Header().Set("id", claims["ID"].(string))
+		claims, err := authenticate(r, keys)
+		if err != nil {
+			http.Error(w, err.Error(), authenticateStatus(err))
+			return
+		}
 
-		// If valid, call the next handler
-		next.ServeHTTP(w, r)
-	})
+		next.ServeHTTP(w, r.WithContext(ContextWithClaims(r.Context(), claims)))
+	}
 }
 
-func ValidateJwt(signedToken string) (*jwt.Token, jwt.MapClaims, error) {
-	// Load the RSA public key from a file
-	publicKey, err := os.ReadFile("../public.pem")
+var (
+	errAuthorizationFormat = errors.New("invalid Authorization format")
+	errInvalidToken        = errors.New("invalid or expired access token")
+)
+
+// authenticate validates the bearer token in the Authorization header, an
+// access token or an API key, and returns its claims.
+func authenticate(r *http.Request, keys *KeySet) (Claims, error) {
+	// Expecting a Bearer token
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		return Claims{}, errAuthorizationFormat
+	}
+
+	if strings.HasPrefix(parts[1], APIKeyPrefix) {
+		return keys.authenticateAPIKey(r, parts[1])
+	}
+
+	_, claims, err := keys.ValidateJwt(r.Context(), parts[1])
 	if err != nil {
-		log.Fatal(err)
+		return Claims{}, errInvalidToken
+	}
+
+	userID, _ := claims["ID"].(string)
+	username, _ := claims["name"].(string)
+	emailVerified, _ := claims["email_verified"].(bool)
+	sessionID, _ := claims["sid"].(string)
+	if userID == "" {
+		return Claims{}, errInvalidToken
 	}
-	rsaPublicKey, err := jwt.ParseRSAPublicKeyFromPEM(publicKey)
+
+	// Unknown roles get the permissions of regular users
+	name, _ := claims["role"].(string)
+	role, _ := ParseRole(name)
+
+	if err := keys.checkSuspended(userID); err != nil {
+		return Claims{}, err
+	}
+
+	role, err = keys.currentRole(userID, role)
 	if err != nil {
-		log.Fatal(err)
+		return Claims{}, err
 	}
 
-	// Parse the signed JWT and verify it with the RSA public key
-	token, err := jwt.Parse(signedToken, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("unexepcted signing method: %v", token.Header["alg"])
-		}
-		return rsaPublicKey, nil
-	})
+	return Claims{UserID: userID, Username: username, EmailVerified: emailVerified, Role: role, SessionID: sessionID}, nil
+}
+
+// authenticateStatus is the status code of the errors of authenticate.
+func authenticateStatus(err error) int {
+	switch {
+	case errors.Is(err, errSuspended), errors.Is(err, errMissingScope), errors.Is(err, errAPIKeyRefused):
+		return http.StatusForbidden
+	case errors.Is(err, errSuspensionCheck), errors.Is(err, errRoleCheck), errors.Is(err, errAPIKeyCheck):
+		return http.StatusInternalServerError
+	default:
+		return http.StatusUnauthorized
+	}
+}
+
+// RequireClaims makes the key set reject the tokens that weren't issued by
+// issuer for audience, like tokens other services sign with the same keys.
+func (k *KeySet) RequireClaims(issuer, audience string) {
+	k.issuer = issuer
+	k.audience = audience
+}
+
+// ValidateJwt parses the signed JWT and verifies it with the key its kid
+// header points to. Tokens without an expiry are rejected, and so are tokens
+// with the wrong issuer or audience once RequireClaims was called.
+func (k *KeySet) ValidateJwt(ctx context.Context, signedToken string) (*jwt.Token, jwt.MapClaims, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512"}),
+		jwt.WithExpirationRequired(),
+	}
+	if k.issuer != "" {
+		options = append(options, jwt.WithIssuer(k.issuer))
+	}
+	if k.audience != "" {
+		options = append(options, jwt.WithAudience(k.audience))
+	}
+
+	token, err := jwt.Parse(signedToken, k.keyfunc(ctx), options...)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if ok && token.Valid {
@@ -15,6 +15,7 @@ import (
 	"github.com/jackgris/twitter-backend/tweet/internal/store/tweetdb"
 	"github.com/jackgris/twitter-backend/tweet/pkg/database"
 	"github.com/jackgris/twitter-backend/tweet/pkg/logger"
+	"github.com/jackgris/twitter-backend/tweet/pkg/middleware"
 	"github.com/jackgris/twitter-backend/tweet/pkg/msgbroker"
 )
 
@@ -32,7 +33,7 @@ func main() {
 func run(ctx context.Context, serviceName string, log *logger.Logger) error {
 
 	db := database.ConnectDB(ctx, log)
-	defer db.Close(ctx)
+	defer db.Close()
 
 	store := tweetdb.NewStore(db)
 	msgBrokerPath := os.Getenv("NATS_URL")
@@ -41,7 +42,22 @@ func run(ctx context.Context, serviceName string, log *logger.Logger) error {
 		os.Exit(1)
 	}
 	msgbroker := msgbroker.NewMsgBroker(serviceName, msgBrokerPath, log)
-	mux, t := handler.NewHandler(store, msgbroker, log)
+	keys, err := middleware.NewKeySet(getEnv("JWKS_URL", "http://localhost:8081/.well-known/jwks.json"), os.Getenv("JWT_PUBLIC_KEY"))
+	if err != nil {
+		log.Error(ctx, serviceName, "Loading JWT public keys", err)
+		os.Exit(1)
+	}
+	keys.RequireClaims(getEnv("JWT_ISSUER", "twitter-backend-auth"), getEnv("JWT_AUDIENCE", "twitter-backend"))
+	keys.RejectSuspended(store)
+	keys.CheckRoles(store)
+	apiKeys := middleware.NewAPIKeyClient(getEnv("API_KEYS_URL", "http://localhost:8081/api-keys/verify"))
+	keys.AcceptAPIKeys(apiKeys, middleware.ScopeTweetRead, middleware.ScopeTweetWrite)
+
+	config := handler.Config{
+		RequireVerifiedEmail: os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true",
+	}
+
+	mux, t := handler.NewHandler(store, msgbroker, keys, config, log)
 
 	portEnv := os.Getenv("PORT")
 	port, err := strconv.Atoi(portEnv)
@@ -69,6 +85,14 @@ func run(ctx context.Context, serviceName string, log *logger.Logger) error {
 		t.SendTweetToFollowersEvent()
 	}()
 
+	go func() {
+		t.SubscribeRelationships()
+	}()
+
+	go func() {
+		t.SubscribeUsers()
+	}()
+
 	// -------------------------------------------------------------------------
 	// Shutdown
 
@@ -94,3 +118,10 @@ func run(ctx context.Context, serviceName string, log *logger.Logger) error {
 
 	return nil
 }
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -3,6 +3,7 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/jackgris/twitter-backend/tweet/pkg/msgbroker"
@@ -44,6 +45,7 @@ func NewGetFollowers(userID string) *message.Message {
 
 type FollowersEvent struct {
 	Header      msgbroker.Header `json:"header"`
+	UserID      string           `json:"user_id"`
 	TweetID     string           `json:"tweet_id"`
 	Content     string           `json:"content"`
 	FollowersID []string         `json:"followers_id"`
@@ -94,3 +96,100 @@ func (t TweetHandler) SendTweetToFollowersEvent() {
 		}
 	}
 }
+
+// UserEvent is published by the auth service on the users topic when a user
+// becomes protected or public (user_protection_changed), is suspended
+// (user_suspended) or unsuspended (user_unsuspended), gets a new role
+// (user_role_changed), or is deleted (user_deleted).
+type UserEvent struct {
+	Header    msgbroker.Header `json:"header"`
+	UserID    string           `json:"user_id"`
+	Protected bool             `json:"protected"`
+	Role      string           `json:"role"`
+}
+
+// SubscribeUsers keeps the copies of the protected and suspended users and
+// of the roles up to date, and purges the content of deleted users.
+func (t TweetHandler) SubscribeUsers() {
+	ctx := context.Background()
+	messages, err := t.msgBroker.SubscribeEvents("users")
+	if err != nil {
+		t.logs.Error(ctx, "tweet service", "reading paylod users", err)
+		return
+	}
+
+	for msg := range messages {
+		msg.Ack()
+		user := UserEvent{}
+		err := json.Unmarshal(msg.Payload, &user)
+		if err != nil {
+			t.logs.Error(ctx, "tweet service", "reading paylod users", err)
+			continue
+		}
+
+		switch user.Header.EventName {
+		case "user_protection_changed":
+			err = t.store.SetProtected(user.UserID, user.Protected)
+		case "user_suspended":
+			err = t.store.SetSuspended(user.UserID, true)
+		case "user_unsuspended":
+			err = t.store.SetSuspended(user.UserID, false)
+		case "user_role_changed":
+			err = t.store.SetRole(user.UserID, user.Role)
+		case "user_deleted":
+			err = t.store.PurgeUser(user.UserID)
+		}
+		if err != nil {
+			t.logs.Error(ctx, "tweet service", "saving user", err, "event", user.Header.EventName, "msg ID", msg.UUID)
+		}
+	}
+}
+
+// RelationshipEvent is published by the auth service on the relationships
+// topic when a user blocks, unblocks, mutes or unmutes another.
+type RelationshipEvent struct {
+	Header   msgbroker.Header `json:"header"`
+	UserID   string           `json:"user_id"`
+	TargetID string           `json:"target_id"`
+}
+
+// SubscribeRelationships keeps the copy of the follows and blocks used to
+// hide protected tweets and reject likes and retweets up to date. Mutes only
+// matter for timelines and are ignored.
+func (t TweetHandler) SubscribeRelationships() {
+	ctx := context.Background()
+	messages, err := t.msgBroker.SubscribeEvents("relationships")
+	if err != nil {
+		t.logs.Error(ctx, "tweet service", "reading paylod relationships", err)
+		return
+	}
+
+	for msg := range messages {
+		msg.Ack()
+		rel := RelationshipEvent{}
+		err := json.Unmarshal(msg.Payload, &rel)
+		if err != nil {
+			t.logs.Error(ctx, "tweet service", "reading paylod relationships", err)
+			continue
+		}
+
+		switch rel.Header.EventName {
+		case "user_followed":
+			err = t.store.AddFollow(rel.TargetID, rel.UserID)
+		case "user_unfollowed":
+			err = t.store.RemoveFollow(rel.TargetID, rel.UserID)
+		case "user_blocked":
+			// Blocking removes the follows between both users
+			err = errors.Join(
+				t.store.AddBlock(rel.UserID, rel.TargetID),
+				t.store.RemoveFollow(rel.UserID, rel.TargetID),
+				t.store.RemoveFollow(rel.TargetID, rel.UserID),
+			)
+		case "user_unblocked":
+			err = t.store.RemoveBlock(rel.UserID, rel.TargetID)
+		}
+		if err != nil {
+			t.logs.Error(ctx, "tweet service", "saving relationship", err, "event", rel.Header.EventName, "msg ID", msg.UUID)
+		}
+	}
+}
@@ -1,44 +1,66 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackgris/twitter-backend/tweet/internal/domain/tweetmodel"
 	"github.com/jackgris/twitter-backend/tweet/pkg/logger"
 	"github.com/jackgris/twitter-backend/tweet/pkg/middleware"
 	"github.com/jackgris/twitter-backend/tweet/pkg/msgbroker"
+	"github.com/jackgris/twitter-backend/tweet/pkg/uuid"
 )
 
 type TweetHandler struct {
 	logs      *logger.Logger
 	store     Store
 	msgBroker *msgbroker.MsgBroker
+	keys      *middleware.KeySet
 }
 
-func NewTweetHandler(store Store, msgBroker *msgbroker.MsgBroker, logs *logger.Logger) TweetHandler {
+func NewTweetHandler(store Store, msgBroker *msgbroker.MsgBroker, keys *middleware.KeySet, logs *logger.Logger) TweetHandler {
 	return TweetHandler{
 		store:     store,
 		msgBroker: msgBroker,
+		keys:      keys,
 		logs:      logs,
 	}
 }
 
-func NewHandler(store Store, msgBroker *msgbroker.MsgBroker, logs *logger.Logger) (*http.ServeMux, *TweetHandler) {
+// Config holds the settings of the handlers main reads from the environment.
+type Config struct {
+	// RequireVerifiedEmail stops users with an unverified email from
+	// tweeting, liking and retweeting
+	RequireVerifiedEmail bool
+}
+
+func NewHandler(store Store, msgBroker *msgbroker.MsgBroker, keys *middleware.KeySet, config Config, logs *logger.Logger) (*http.ServeMux, *TweetHandler) {
 	t := TweetHandler{
 		store:     store,
 		msgBroker: msgBroker,
+		keys:      keys,
 		logs:      logs,
 	}
 
+	// writes are the routes that create content
+	writes := func(next http.HandlerFunc) http.HandlerFunc {
+		if config.RequireVerifiedEmail {
+			next = middleware.VerifiedEmail(next)
+		}
+		return middleware.Authorize(next, t.keys)
+	}
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /helthz", middleware.LogResponse(healthCheckHandler, t.logs))
-	mux.HandleFunc("GET /id/{id}", middleware.LogResponse(t.GetTweetById, t.logs))
-	mux.HandleFunc("POST /create", middleware.LogResponse(t.CreateTweet, t.logs))
-	mux.HandleFunc("DELETE /delete/{id}", middleware.LogResponse(t.DeleteTweet, t.logs))
-	mux.HandleFunc("POST /like", middleware.LogResponse(t.LikeTweet, t.logs))
-	mux.HandleFunc("DELETE /like", middleware.LogResponse(t.DislikeTweet, t.logs))
-	mux.HandleFunc("POST /retweet", middleware.LogResponse(t.ReTweet, t.logs))
-	mux.HandleFunc("DELETE /retweet", middleware.LogResponse(t.DeleteReTweet, t.logs))
+	mux.HandleFunc("GET /id/{id}", middleware.LogResponse(middleware.Identify(t.GetTweetById, t.keys), t.logs))
+	mux.HandleFunc("POST /create", middleware.LogResponse(writes(t.CreateTweet), t.logs))
+	mux.HandleFunc("DELETE /delete/{id}", middleware.LogResponse(middleware.Authorize(t.DeleteTweet, t.keys), t.logs))
+	mux.HandleFunc("POST /like", middleware.LogResponse(writes(t.LikeTweet), t.logs))
+	mux.HandleFunc("DELETE /like", middleware.LogResponse(middleware.Authorize(t.DislikeTweet, t.keys), t.logs))
+	mux.HandleFunc("POST /retweet", middleware.LogResponse(writes(t.ReTweet), t.logs))
+	mux.HandleFunc("DELETE /retweet", middleware.LogResponse(middleware.Authorize(t.DeleteReTweet, t.keys), t.logs))
 
 	return mux, &t
 }
@@ -47,6 +69,71 @@ func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// actingUser returns the ID of the user the request was authorized for.
+// Requests may still send a user_id in the body, but it has to be the same
+// user, nobody can act on behalf of someone else.
+func actingUser(w http.ResponseWriter, r *http.Request, userID string) (string, bool) {
+	claims, ok := middleware.ClaimsFromContext(r.Context())
+	if !ok {
+		http.Error(w, "missing access token", http.StatusUnauthorized)
+		return "", false
+	}
+
+	if userID == "" {
+		return claims.UserID, true
+	}
+
+	if ok := uuid.IsValid(userID); !ok {
+		http.Error(w, "user id invalid", http.StatusBadRequest)
+		return "", false
+	}
+
+	if userID != claims.UserID {
+		http.Error(w, "user_id doesn't match the access token", http.StatusForbidden)
+		return "", false
+	}
+
+	return claims.UserID, true
+}
+
+// canInteract checks that userID can see the tweet and that they and its
+// author didn't block each other, blocked users can't like or retweet.
+func (t TweetHandler) canInteract(w http.ResponseWriter, tweetID, userID string) bool {
+	tweet, err := t.store.GetByID(tweetID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Tweet not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to retrieve tweet: %v", err), http.StatusInternalServerError)
+		}
+		return false
+	}
+
+	visible, err := t.store.CanView(tweet.UserID, userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to retrieve tweet: %v", err), http.StatusInternalServerError)
+		return false
+	}
+
+	if !visible {
+		http.Error(w, "Tweet not found", http.StatusNotFound)
+		return false
+	}
+
+	blocked, err := t.store.IsBlocked(tweet.UserID, userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to retrieve blocks: %v", err), http.StatusInternalServerError)
+		return false
+	}
+
+	if blocked {
+		http.Error(w, "you can't interact with tweets of this user", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
 type Store interface {
 	GetByID(id string) (tweetmodel.Tweet, error)
 	GetByUser(userID string) ([]tweetmodel.Tweet, error)
@@ -56,4 +143,16 @@ type Store interface {
 	Dislike(like tweetmodel.Like) error
 	ReTweet(retweet tweetmodel.Retweet) (tweetmodel.Retweet, error)
 	DeleteReTweet(retweet tweetmodel.Retweet) error
+	AddBlock(userID, targetID string) error
+	RemoveBlock(userID, targetID string) error
+	IsBlocked(userID, otherID string) (bool, error)
+	SetProtected(userID string, protected bool) error
+	AddFollow(userID, followerID string) error
+	RemoveFollow(userID, followerID string) error
+	CanView(authorID, viewerID string) (bool, error)
+	SetSuspended(userID string, suspended bool) error
+	IsSuspended(userID string) (bool, error)
+	SetRole(userID, role string) error
+	Role(userID string) (string, error)
+	PurgeUser(userID string) error
 }
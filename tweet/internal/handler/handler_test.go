@@ -5,10 +5,16 @@ import (
 )
 
 type MockStore struct {
-	LikeFunc func(like tweetmodel.Like) (tweetmodel.Like, error)
+	LikeFunc      func(like tweetmodel.Like) (tweetmodel.Like, error)
+	GetByIDFunc   func(id string) (tweetmodel.Tweet, error)
+	IsBlockedFunc func(userID, otherID string) (bool, error)
+	CanViewFunc   func(authorID, viewerID string) (bool, error)
 }
 
 func (m *MockStore) GetByID(id string) (tweetmodel.Tweet, error) {
+	if m.GetByIDFunc != nil {
+		return m.GetByIDFunc(id)
+	}
 	return tweetmodel.Tweet{}, nil
 }
 func (m *MockStore) GetByUser(userID string) ([]tweetmodel.Tweet, error) {
@@ -32,3 +38,45 @@ func (m *MockStore) ReTweet(retweet tweetmodel.Retweet) (tweetmodel.Retweet, err
 func (m *MockStore) DeleteReTweet(retweet tweetmodel.Retweet) error {
 	return nil
 }
+func (m *MockStore) AddBlock(userID, targetID string) error {
+	return nil
+}
+func (m *MockStore) RemoveBlock(userID, targetID string) error {
+	return nil
+}
+func (m *MockStore) IsBlocked(userID, otherID string) (bool, error) {
+	if m.IsBlockedFunc != nil {
+		return m.IsBlockedFunc(userID, otherID)
+	}
+	return false, nil
+}
+func (m *MockStore) SetProtected(userID string, protected bool) error {
+	return nil
+}
+func (m *MockStore) AddFollow(userID, followerID string) error {
+	return nil
+}
+func (m *MockStore) RemoveFollow(userID, followerID string) error {
+	return nil
+}
+func (m *MockStore) CanView(authorID, viewerID string) (bool, error) {
+	if m.CanViewFunc != nil {
+		return m.CanViewFunc(authorID, viewerID)
+	}
+	return true, nil
+}
+func (m *MockStore) SetSuspended(userID string, suspended bool) error {
+	return nil
+}
+func (m *MockStore) IsSuspended(userID string) (bool, error) {
+	return false, nil
+}
+func (m *MockStore) SetRole(userID, role string) error {
+	return nil
+}
+func (m *MockStore) Role(userID string) (string, error) {
+	return "user", nil
+}
+func (m *MockStore) PurgeUser(userID string) error {
+	return nil
+}
@@ -19,13 +19,13 @@ func (t TweetHandler) LikeTweet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if input.TweetID == "" || input.UserID == "" {
-		http.Error(w, "tweet_id and user_id are required", http.StatusBadRequest)
+	userID, ok := actingUser(w, r, input.UserID)
+	if !ok {
 		return
 	}
 
-	if ok := uuid.IsValid(input.UserID); !ok {
-		http.Error(w, "user id invalid", http.StatusBadRequest)
+	if input.TweetID == "" {
+		http.Error(w, "tweet_id is required", http.StatusBadRequest)
 		return
 	}
 
@@ -34,9 +34,13 @@ func (t TweetHandler) LikeTweet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !t.canInteract(w, input.TweetID, userID) {
+		return
+	}
+
 	like := tweetmodel.Like{
 		TweetID: input.TweetID,
-		UserID:  input.UserID,
+		UserID:  userID,
 	}
 
 	like, err := t.store.Like(like)
@@ -62,13 +66,13 @@ func (t TweetHandler) DislikeTweet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if input.TweetID == "" || input.UserID == "" {
-		http.Error(w, "tweet_id and user_id are required", http.StatusBadRequest)
+	userID, ok := actingUser(w, r, input.UserID)
+	if !ok {
 		return
 	}
 
-	if ok := uuid.IsValid(input.UserID); !ok {
-		http.Error(w, "user id invalid", http.StatusBadRequest)
+	if input.TweetID == "" {
+		http.Error(w, "tweet_id is required", http.StatusBadRequest)
 		return
 	}
 
@@ -85,7 +89,7 @@ func (t TweetHandler) DislikeTweet(w http.ResponseWriter, r *http.Request) {
 	like := tweetmodel.Like{
 		Id:      input.ID,
 		TweetID: input.TweetID,
-		UserID:  input.UserID,
+		UserID:  userID,
 	}
 
 	err := t.store.Dislike(like)
@@ -12,24 +12,29 @@ import (
 	"github.com/jackgris/twitter-backend/tweet/internal/domain/tweetmodel"
 	"github.com/jackgris/twitter-backend/tweet/internal/handler"
 	"github.com/jackgris/twitter-backend/tweet/pkg/logger"
+	"github.com/jackgris/twitter-backend/tweet/pkg/middleware"
 	"github.com/jackgris/twitter-backend/tweet/pkg/msgbroker"
 	"github.com/jackgris/twitter-backend/tweet/pkg/uuid"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestLikeTweet(t *testing.T) {
+	actor := uuid.New()
+
 	tests := []struct {
-		name         string
-		requestBody  interface{}
-		mockLikeFunc func(like tweetmodel.Like) (tweetmodel.Like, error)
-		expectedCode int
-		expectedBody string
+		name            string
+		requestBody     interface{}
+		unauthenticated bool
+		blocked         bool
+		mockLikeFunc    func(like tweetmodel.Like) (tweetmodel.Like, error)
+		expectedCode    int
+		expectedBody    string
 	}{
 		{
 			name: "Success",
 			requestBody: map[string]string{
 				"tweet_id": uuid.New(),
-				"user_id":  uuid.New(),
+				"user_id":  actor,
 			},
 			mockLikeFunc: func(like tweetmodel.Like) (tweetmodel.Like, error) {
 				return like, nil
@@ -44,6 +49,17 @@ func TestLikeTweet(t *testing.T) {
 			expectedCode: http.StatusBadRequest,
 			expectedBody: "Invalid JSON payload",
 		},
+		{
+			name: "User taken from the access token",
+			requestBody: map[string]string{
+				"tweet_id": uuid.New(),
+			},
+			mockLikeFunc: func(like tweetmodel.Like) (tweetmodel.Like, error) {
+				return like, nil
+			},
+			expectedCode: http.StatusCreated,
+			expectedBody: `"user_id":"` + actor + `"`,
+		},
 		{
 			name: "Missing fields",
 			requestBody: map[string]string{
@@ -52,7 +68,27 @@ func TestLikeTweet(t *testing.T) {
 			},
 			mockLikeFunc: nil,
 			expectedCode: http.StatusBadRequest,
-			expectedBody: "tweet_id and user_id are required",
+			expectedBody: "tweet_id is required",
+		},
+		{
+			name: "Missing access token",
+			requestBody: map[string]string{
+				"tweet_id": uuid.New(),
+			},
+			unauthenticated: true,
+			mockLikeFunc:    nil,
+			expectedCode:    http.StatusUnauthorized,
+			expectedBody:    "missing access token",
+		},
+		{
+			name: "Acting as another user",
+			requestBody: map[string]string{
+				"tweet_id": uuid.New(),
+				"user_id":  uuid.New(),
+			},
+			mockLikeFunc: nil,
+			expectedCode: http.StatusForbidden,
+			expectedBody: "user_id doesn't match the access token",
 		},
 		{
 			name: "Invalid UserID",
@@ -64,11 +100,21 @@ func TestLikeTweet(t *testing.T) {
 			expectedCode: http.StatusBadRequest,
 			expectedBody: "user id invalid",
 		},
+		{
+			name: "Blocked by the author",
+			requestBody: map[string]string{
+				"tweet_id": uuid.New(),
+			},
+			blocked:      true,
+			mockLikeFunc: nil,
+			expectedCode: http.StatusForbidden,
+			expectedBody: "you can't interact with tweets of this user",
+		},
 		{
 			name: "Store Like error",
 			requestBody: map[string]string{
 				"tweet_id": uuid.New(),
-				"user_id":  uuid.New(),
+				"user_id":  actor,
 			},
 			mockLikeFunc: func(like tweetmodel.Like) (tweetmodel.Like, error) {
 				return tweetmodel.Like{}, errors.New("store error")
@@ -82,14 +128,21 @@ func TestLikeTweet(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			mockStore := &MockStore{
 				LikeFunc: test.mockLikeFunc,
+				IsBlockedFunc: func(userID, otherID string) (bool, error) {
+					return test.blocked, nil
+				},
 			}
 
 			log := logger.New(io.Discard)
 			msgbroker := msgbroker.NewMockMsgBroker(log)
-			handler := handler.NewTweetHandler(mockStore, msgbroker, log)
+			handler := handler.NewTweetHandler(mockStore, msgbroker, nil, log)
 
 			body, _ := json.Marshal(test.requestBody)
 			req := httptest.NewRequest(http.MethodPost, "/like", bytes.NewReader(body))
+			if !test.unauthenticated {
+				ctx := middleware.ContextWithClaims(req.Context(), middleware.Claims{UserID: actor, Username: "jackgris"})
+				req = req.WithContext(ctx)
+			}
 			rec := httptest.NewRecorder()
 
 			handler.LikeTweet(rec, req)
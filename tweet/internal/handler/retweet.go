@@ -19,13 +19,13 @@ func (t TweetHandler) ReTweet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if input.TweetID == "" || input.UserID == "" {
-		http.Error(w, "tweet_id and user_id are required", http.StatusBadRequest)
+	userID, ok := actingUser(w, r, input.UserID)
+	if !ok {
 		return
 	}
 
-	if ok := uuid.IsValid(input.UserID); !ok {
-		http.Error(w, "user id invalid", http.StatusBadRequest)
+	if input.TweetID == "" {
+		http.Error(w, "tweet_id is required", http.StatusBadRequest)
 		return
 	}
 
@@ -34,9 +34,13 @@ func (t TweetHandler) ReTweet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !t.canInteract(w, input.TweetID, userID) {
+		return
+	}
+
 	retweet := tweetmodel.Retweet{
 		TweetID: input.TweetID,
-		UserID:  input.UserID,
+		UserID:  userID,
 	}
 
 	retweet, err := t.store.ReTweet(retweet)
@@ -62,18 +66,18 @@ func (t TweetHandler) DeleteReTweet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if input.TweetID == "" || input.UserID == "" {
-		http.Error(w, "tweet_id and user_id are required", http.StatusBadRequest)
+	userID, ok := actingUser(w, r, input.UserID)
+	if !ok {
 		return
 	}
 
-	if ok := uuid.IsValid(input.ID); !ok {
-		http.Error(w, "retweet id invalid", http.StatusBadRequest)
+	if input.TweetID == "" {
+		http.Error(w, "tweet_id is required", http.StatusBadRequest)
 		return
 	}
 
-	if ok := uuid.IsValid(input.UserID); !ok {
-		http.Error(w, "user id invalid", http.StatusBadRequest)
+	if ok := uuid.IsValid(input.ID); !ok {
+		http.Error(w, "retweet id invalid", http.StatusBadRequest)
 		return
 	}
 
@@ -85,7 +89,7 @@ func (t TweetHandler) DeleteReTweet(w http.ResponseWriter, r *http.Request) {
 	retweet := tweetmodel.Retweet{
 		Id:      input.ID,
 		TweetID: input.TweetID,
-		UserID:  input.UserID,
+		UserID:  userID,
 	}
 
 	err := t.store.DeleteReTweet(retweet)
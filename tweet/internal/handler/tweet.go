@@ -10,6 +10,7 @@ import (
 	"github.com/jackc/pgx/v5"
 	"github.com/jackgris/twitter-backend/tweet/internal/domain/tweetmodel"
 	"github.com/jackgris/twitter-backend/tweet/internal/store/tweetdb"
+	"github.com/jackgris/twitter-backend/tweet/pkg/middleware"
 	"github.com/jackgris/twitter-backend/tweet/pkg/uuid"
 )
 
@@ -24,13 +25,13 @@ func (t TweetHandler) CreateTweet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if input.UserID == "" || input.Content == "" {
-		http.Error(w, "user_id and content are required", http.StatusBadRequest)
+	userID, ok := actingUser(w, r, input.UserID)
+	if !ok {
 		return
 	}
 
-	if ok := uuid.IsValid(input.UserID); !ok {
-		http.Error(w, "user id invalid", http.StatusBadRequest)
+	if input.Content == "" {
+		http.Error(w, "content is required", http.StatusBadRequest)
 		return
 	}
 
@@ -40,7 +41,7 @@ func (t TweetHandler) CreateTweet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	tweet := tweetmodel.Tweet{
-		UserID:  input.UserID,
+		UserID:  userID,
 		Content: input.Content,
 	}
 	tweet, err := t.store.Create(tweet)
@@ -75,7 +76,7 @@ func (t TweetHandler) GetTweetById(w http.ResponseWriter, r *http.Request) {
 
 	tweet, err := t.store.GetByID(tweetID)
 	if err != nil {
-		if err == pgx.ErrNoRows {
+		if errors.Is(err, pgx.ErrNoRows) {
 			http.Error(w, "Tweet not found", http.StatusNotFound)
 		} else {
 			http.Error(w, fmt.Sprintf("Failed to retrieve tweet: %v", err), http.StatusInternalServerError)
@@ -83,12 +84,35 @@ func (t TweetHandler) GetTweetById(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	// Tweets of protected users are hidden from anyone but their followers,
+	// as if they didn't exist
+	var viewerID string
+	if claims, ok := middleware.ClaimsFromContext(r.Context()); ok {
+		viewerID = claims.UserID
+	}
+
+	visible, err := t.store.CanView(tweet.UserID, viewerID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to retrieve tweet: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if !visible {
+		http.Error(w, "Tweet not found", http.StatusNotFound)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
 	_ = json.NewEncoder(w).Encode(TweetToJSON(tweet))
 }
 
 func (t TweetHandler) DeleteTweet(w http.ResponseWriter, r *http.Request) {
+	userID, ok := actingUser(w, r, "")
+	if !ok {
+		return
+	}
+
 	tweetID := r.PathValue("id")
 	if tweetID == "" {
 		http.Error(w, "id query parameter is required", http.StatusBadRequest)
@@ -100,11 +124,36 @@ func (t TweetHandler) DeleteTweet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := t.store.Delete(tweetID)
-	if errors.Is(err, tweetdb.ErrDeleteTweet) {
-		http.Error(w, "Tweet not found", http.StatusNotFound)
+	tweet, err := t.store.GetByID(tweetID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Tweet not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to retrieve tweet: %v", err), http.StatusInternalServerError)
+		}
 		return
 	}
 
+	// Moderators delete the tweets that break the rules
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+	if tweet.UserID != userID && !claims.Can(middleware.PermDeleteContent) {
+		http.Error(w, "only the author can delete a tweet", http.StatusForbidden)
+		return
+	}
+
+	err = t.store.Delete(tweetID)
+	if err != nil {
+		if errors.Is(err, tweetdb.ErrDeleteTweet) {
+			http.Error(w, "Tweet not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to delete tweet: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if tweet.UserID != userID {
+		t.logs.Info(r.Context(), "tweet service", "tweet deleted by moderator", "tweet ID", tweetID, "author ID", tweet.UserID, "moderator ID", userID)
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,128 @@
+package handler_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackgris/twitter-backend/tweet/internal/domain/tweetmodel"
+	"github.com/jackgris/twitter-backend/tweet/internal/handler"
+	"github.com/jackgris/twitter-backend/tweet/pkg/logger"
+	"github.com/jackgris/twitter-backend/tweet/pkg/middleware"
+	"github.com/jackgris/twitter-backend/tweet/pkg/msgbroker"
+	"github.com/jackgris/twitter-backend/tweet/pkg/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteTweet(t *testing.T) {
+	author := uuid.New()
+	tweetID := uuid.New()
+
+	tests := []struct {
+		name         string
+		actor        string
+		role         middleware.Role
+		getByIDErr   error
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "Author deletes the tweet",
+			actor:        author,
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name:         "Someone else can't delete the tweet",
+			actor:        uuid.New(),
+			expectedCode: http.StatusForbidden,
+			expectedBody: "only the author can delete a tweet",
+		},
+		{
+			name:         "Moderator deletes someone else's tweet",
+			actor:        uuid.New(),
+			role:         middleware.RoleModerator,
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name:         "Tweet not found",
+			actor:        author,
+			getByIDErr:   pgx.ErrNoRows,
+			expectedCode: http.StatusNotFound,
+			expectedBody: "Tweet not found",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockStore := &MockStore{
+				GetByIDFunc: func(id string) (tweetmodel.Tweet, error) {
+					if test.getByIDErr != nil {
+						return tweetmodel.Tweet{}, test.getByIDErr
+					}
+					return tweetmodel.Tweet{Id: id, UserID: author}, nil
+				},
+			}
+
+			log := logger.New(io.Discard)
+			handler := handler.NewTweetHandler(mockStore, msgbroker.NewMockMsgBroker(log), nil, log)
+
+			req := httptest.NewRequest(http.MethodDelete, "/delete/"+tweetID, nil)
+			req.SetPathValue("id", tweetID)
+			req = req.WithContext(middleware.ContextWithClaims(req.Context(), middleware.Claims{UserID: test.actor, Role: test.role}))
+			rec := httptest.NewRecorder()
+
+			handler.DeleteTweet(rec, req)
+
+			assert.Equal(t, test.expectedCode, rec.Code)
+			if test.expectedBody != "" {
+				assert.Contains(t, rec.Body.String(), test.expectedBody)
+			}
+		})
+	}
+}
+
+func TestGetTweetByIdProtected(t *testing.T) {
+	author := uuid.New()
+	follower := uuid.New()
+	tweetID := uuid.New()
+
+	tests := []struct {
+		name         string
+		viewer       string
+		expectedCode int
+	}{
+		{name: "Author", viewer: author, expectedCode: http.StatusOK},
+		{name: "Approved follower", viewer: follower, expectedCode: http.StatusOK},
+		{name: "Someone else", viewer: uuid.New(), expectedCode: http.StatusNotFound},
+		{name: "Anonymous", viewer: "", expectedCode: http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockStore := &MockStore{
+				GetByIDFunc: func(id string) (tweetmodel.Tweet, error) {
+					return tweetmodel.Tweet{Id: id, UserID: author}, nil
+				},
+				CanViewFunc: func(authorID, viewerID string) (bool, error) {
+					return viewerID == authorID || viewerID == follower, nil
+				},
+			}
+
+			log := logger.New(io.Discard)
+			handler := handler.NewTweetHandler(mockStore, msgbroker.NewMockMsgBroker(log), nil, log)
+
+			req := httptest.NewRequest(http.MethodGet, "/id/"+tweetID, nil)
+			req.SetPathValue("id", tweetID)
+			if test.viewer != "" {
+				req = req.WithContext(middleware.ContextWithClaims(req.Context(), middleware.Claims{UserID: test.viewer}))
+			}
+			rec := httptest.NewRecorder()
+
+			handler.GetTweetById(rec, req)
+
+			assert.Equal(t, test.expectedCode, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package tweetdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// AddBlock stores that userID blocked targetID. Adding the same block again
+// does nothing, so replayed events are harmless.
+func (s *Store) AddBlock(userID, targetID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+		INSERT INTO tweet_blocks (user_id, target_id)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, target_id) DO NOTHING;
+	`
+	_, err := s.db.Exec(ctx, query, userID, targetID)
+	if err != nil {
+		return fmt.Errorf("failed to insert block: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) RemoveBlock(userID, targetID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+		DELETE FROM tweet_blocks
+		WHERE user_id = $1 AND target_id = $2;
+	`
+	_, err := s.db.Exec(ctx, query, userID, targetID)
+	if err != nil {
+		return fmt.Errorf("failed to delete block: %w", err)
+	}
+
+	return nil
+}
+
+// IsBlocked reports whether any of the users blocked the other.
+func (s *Store) IsBlocked(userID, otherID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM tweet_blocks
+			WHERE (user_id = $1 AND target_id = $2) OR (user_id = $2 AND target_id = $1)
+		);
+	`
+	var blocked bool
+	err := s.db.QueryRow(ctx, query, userID, otherID).Scan(&blocked)
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch block: %w", err)
+	}
+
+	return blocked, nil
+}
@@ -0,0 +1,77 @@
+package tweetdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// PurgeUser removes everything a deleted user left in the tweet service:
+// their tweets, with the likes and retweets they got, their likes and
+// retweets of other tweets, whose counters go down, and the copies of their
+// follows, blocks, protection and suspension. Purging a user twice does
+// nothing, so replayed events are harmless.
+func (s *Store) PurgeUser(userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	// Decrement the counters before the likes and retweets are deleted, in
+	// the same transaction, so they only go down once
+	likeCountQuery := `
+		UPDATE tweets t
+		SET like_count = GREATEST(t.like_count - l.count, 0)
+		FROM (SELECT tweet_id, COUNT(*) AS count FROM likes WHERE user_id = $1 GROUP BY tweet_id) l
+		WHERE t.id = l.tweet_id;
+	`
+	_, err = tx.Exec(ctx, likeCountQuery, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update like counts: %w", err)
+	}
+
+	retweetCountQuery := `
+		UPDATE tweets t
+		SET retweet_count = GREATEST(t.retweet_count - r.count, 0)
+		FROM (SELECT tweet_id, COUNT(*) AS count FROM retweets WHERE user_id = $1 GROUP BY tweet_id) r
+		WHERE t.id = r.tweet_id;
+	`
+	_, err = tx.Exec(ctx, retweetCountQuery, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update retweet counts: %w", err)
+	}
+
+	// Likes and retweets of the user's own tweets go away with them
+	queries := []struct {
+		query string
+		what  string
+	}{
+		{`DELETE FROM likes WHERE user_id = $1;`, "likes"},
+		{`DELETE FROM retweets WHERE user_id = $1;`, "retweets"},
+		{`DELETE FROM tweets WHERE user_id = $1;`, "tweets"},
+		{`DELETE FROM tweet_blocks WHERE user_id = $1 OR target_id = $1;`, "blocks"},
+		{`DELETE FROM tweet_follows WHERE user_id = $1 OR follower_id = $1;`, "follows"},
+		{`DELETE FROM tweet_protected_users WHERE user_id = $1;`, "protected user"},
+		{`DELETE FROM tweet_suspended_users WHERE user_id = $1;`, "suspended user"},
+		{`DELETE FROM tweet_user_roles WHERE user_id = $1;`, "user role"},
+	}
+	for _, q := range queries {
+		_, err = tx.Exec(ctx, q.query, userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete %s: %w", q.what, err)
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package tweetdb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackgris/twitter-backend/tweet/internal/store/tweetdb"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPurgeUser(t *testing.T) {
+	userID := "csvqvamek44s73e2qf8g"
+
+	t.Run("Purge OK", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE tweets t SET like_count").WithArgs(userID).WillReturnResult(pgxmock.NewResult("UPDATE", 2))
+		mock.ExpectExec("UPDATE tweets t SET retweet_count").WithArgs(userID).WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectExec("DELETE FROM likes").WithArgs(userID).WillReturnResult(pgxmock.NewResult("DELETE", 2))
+		mock.ExpectExec("DELETE FROM retweets").WithArgs(userID).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		mock.ExpectExec("DELETE FROM tweets").WithArgs(userID).WillReturnResult(pgxmock.NewResult("DELETE", 3))
+		mock.ExpectExec("DELETE FROM tweet_blocks").WithArgs(userID).WillReturnResult(pgxmock.NewResult("DELETE", 0))
+		mock.ExpectExec("DELETE FROM tweet_follows").WithArgs(userID).WillReturnResult(pgxmock.NewResult("DELETE", 4))
+		mock.ExpectExec("DELETE FROM tweet_protected_users").WithArgs(userID).WillReturnResult(pgxmock.NewResult("DELETE", 0))
+		mock.ExpectExec("DELETE FROM tweet_suspended_users").WithArgs(userID).WillReturnResult(pgxmock.NewResult("DELETE", 0))
+		mock.ExpectExec("DELETE FROM tweet_user_roles").WithArgs(userID).WillReturnResult(pgxmock.NewResult("DELETE", 0))
+		mock.ExpectCommit()
+
+		store := tweetdb.NewStore(mock)
+		err = store.PurgeUser(userID)
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Nothing is deleted if a counter fails", func(t *testing.T) {
+		mock, err := pgxmock.NewConn()
+		assert.NoError(t, err)
+		defer mock.Close(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE tweets t SET like_count").WithArgs(userID).WillReturnError(errors.New("connection lost"))
+		mock.ExpectRollback()
+
+		store := tweetdb.NewStore(mock)
+		err = store.PurgeUser(userID)
+
+		assert.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,182 @@
+package tweetdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SetProtected marks userID as protected or public. Protected users' tweets
+// are only visible to them and their approved followers.
+func (s *Store) SetProtected(userID string, protected bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+		DELETE FROM tweet_protected_users
+		WHERE user_id = $1;
+	`
+	if protected {
+		query = `
+			INSERT INTO tweet_protected_users (user_id)
+			VALUES ($1)
+			ON CONFLICT (user_id) DO NOTHING;
+		`
+	}
+
+	_, err := s.db.Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update protected user: %w", err)
+	}
+
+	return nil
+}
+
+// AddFollow stores that followerID follows userID. Adding the same follow
+// again does nothing, so replayed events are harmless.
+func (s *Store) AddFollow(userID, followerID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+		INSERT INTO tweet_follows (user_id, follower_id)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, follower_id) DO NOTHING;
+	`
+	_, err := s.db.Exec(ctx, query, userID, followerID)
+	if err != nil {
+		return fmt.Errorf("failed to insert follow: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) RemoveFollow(userID, followerID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+		DELETE FROM tweet_follows
+		WHERE user_id = $1 AND follower_id = $2;
+	`
+	_, err := s.db.Exec(ctx, query, userID, followerID)
+	if err != nil {
+		return fmt.Errorf("failed to delete follow: %w", err)
+	}
+
+	return nil
+}
+
+// SetSuspended marks userID as suspended or not. Suspended users' tweets are
+// hidden from everyone and their access tokens are rejected.
+func (s *Store) SetSuspended(userID string, suspended bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+		DELETE FROM tweet_suspended_users
+		WHERE user_id = $1;
+	`
+	if suspended {
+		query = `
+			INSERT INTO tweet_suspended_users (user_id)
+			VALUES ($1)
+			ON CONFLICT (user_id) DO NOTHING;
+		`
+	}
+
+	_, err := s.db.Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update suspended user: %w", err)
+	}
+
+	return nil
+}
+
+// IsSuspended reports whether userID is suspended.
+func (s *Store) IsSuspended(userID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+		SELECT EXISTS (SELECT 1 FROM tweet_suspended_users WHERE user_id = $1);
+	`
+	var suspended bool
+	err := s.db.QueryRow(ctx, query, userID).Scan(&suspended)
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch suspended user: %w", err)
+	}
+
+	return suspended, nil
+}
+
+// SetRole saves the role of userID, regular users are removed.
+func (s *Store) SetRole(userID, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+		DELETE FROM tweet_user_roles
+		WHERE user_id = $1;
+	`
+	args := []any{userID}
+	if role != "user" {
+		query = `
+			INSERT INTO tweet_user_roles (user_id, role)
+			VALUES ($1, $2)
+			ON CONFLICT (user_id) DO UPDATE SET role = EXCLUDED.role;
+		`
+		args = append(args, role)
+	}
+
+	_, err := s.db.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update user role: %w", err)
+	}
+
+	return nil
+}
+
+// Role returns the role of userID, users without a saved role are regular
+// users.
+func (s *Store) Role(userID string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+		SELECT COALESCE((SELECT role FROM tweet_user_roles WHERE user_id = $1), 'user');
+	`
+	var role string
+	err := s.db.QueryRow(ctx, query, userID).Scan(&role)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch user role: %w", err)
+	}
+
+	return role, nil
+}
+
+// CanView reports whether viewerID can see the tweets of authorID. Public
+// users' tweets are visible to everyone, protected ones only to the author
+// and their followers, and suspended ones to nobody. viewerID is empty for
+// anonymous requests.
+func (s *Store) CanView(authorID, viewerID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*400)
+	defer cancel()
+
+	query := `
+		SELECT
+			NOT EXISTS (SELECT 1 FROM tweet_suspended_users WHERE user_id = $1)
+			AND (
+				NOT EXISTS (SELECT 1 FROM tweet_protected_users WHERE user_id = $1)
+				OR $1 = $2
+				OR EXISTS (SELECT 1 FROM tweet_follows WHERE user_id = $1 AND follower_id = $2)
+			);
+	`
+	var visible bool
+	err := s.db.QueryRow(ctx, query, authorID, viewerID).Scan(&visible)
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch visibility: %w", err)
+	}
+
+	return visible, nil
+}
@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// APIKeyPrefix starts every API key, it tells them apart from access tokens
+// and makes leaked keys easy to find.
+const APIKeyPrefix = "twk_"
+
+// Scope is what an API key is allowed to call. The access tokens of users
+// can call everything.
+type Scope string
+
+const (
+	ScopeTweetRead    Scope = "tweet:read"
+	ScopeTweetWrite   Scope = "tweet:write"
+	ScopeTimelineRead Scope = "timeline:read"
+	ScopeUsersRead    Scope = "users:read"
+	ScopeUsersWrite   Scope = "users:write"
+)
+
+// ParseScope returns the scope named s, or false when there is no such scope.
+func ParseScope(s string) (Scope, bool) {
+	scope := Scope(s)
+	switch scope {
+	case ScopeTweetRead, ScopeTweetWrite, ScopeTimelineRead, ScopeUsersRead, ScopeUsersWrite:
+		return scope, true
+	}
+	return "", false
+}
+
+// APIKey is a valid API key of a bot account.
+type APIKey struct {
+	ID       string  `json:"id"`
+	UserID   string  `json:"user_id"`
+	Username string  `json:"username"`
+	Scopes   []Scope `json:"scopes"`
+}
+
+// ErrInvalidAPIKey is returned for unknown, expired and revoked API keys.
+var ErrInvalidAPIKey = errors.New("invalid, expired or revoked API key")
+
+// APIKeys verifies API keys. The auth service checks its database and the
+// other services ask the auth service.
+type APIKeys interface {
+	VerifyAPIKey(ctx context.Context, key string) (APIKey, error)
+}
+
+var (
+	errAPIKeyCheck   = errors.New("can't check the API key")
+	errMissingScope  = errors.New("the API key is missing the scope")
+	errAPIKeyRefused = errors.New("API keys can't be used here")
+)
+
+// AcceptAPIKeys makes Authorize and Identify accept API keys besides access
+// tokens. Requests with an API key need the read scope for GET and HEAD and
+// the write scope for the other methods. It has to be called before serving
+// requests.
+func (k *KeySet) AcceptAPIKeys(apiKeys APIKeys, read, write Scope) {
+	k.apiKeys = apiKeys
+	k.readScope = read
+	k.writeScope = write
+}
+
+// authenticateAPIKey verifies the API key and its scope for the request and
+// returns the claims of its bot account.
+func (k *KeySet) authenticateAPIKey(r *http.Request, key string) (Claims, error) {
+	if k.apiKeys == nil {
+		return Claims{}, errAPIKeyRefused
+	}
+
+	apiKey, err := k.apiKeys.VerifyAPIKey(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, ErrInvalidAPIKey) {
+			return Claims{}, ErrInvalidAPIKey
+		}
+		return Claims{}, errAPIKeyCheck
+	}
+
+	scope := k.writeScope
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		scope = k.readScope
+	}
+	if !slices.Contains(apiKey.Scopes, scope) {
+		return Claims{}, fmt.Errorf("%w %s", errMissingScope, scope)
+	}
+
+	if err := k.checkSuspended(apiKey.UserID); err != nil {
+		return Claims{}, err
+	}
+
+	// Bots are created by admins, there is no email to verify
+	return Claims{
+		UserID:        apiKey.UserID,
+		Username:      apiKey.Username,
+		EmailVerified: true,
+		Role:          RoleUser,
+		APIKeyID:      apiKey.ID,
+		Scopes:        apiKey.Scopes,
+	}, nil
+}
+
+// HasScope reports whether the request can call routes of the scope. Only
+// API keys are limited to their scopes.
+func (c Claims) HasScope(scope Scope) bool {
+	if c.APIKeyID == "" {
+		return true
+	}
+	return slices.Contains(c.Scopes, scope)
+}
+
+// RejectAPIKeys only lets through the access tokens of users, for routes
+// bots must not call whatever their scopes, like the sessions of the
+// account. It has to run after Authorize.
+func RejectAPIKeys(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := ClaimsFromContext(r.Context())
+		if !ok {
+			http.Error(w, "missing access token", http.StatusUnauthorized)
+			return
+		}
+
+		if claims.APIKeyID != "" {
+			http.Error(w, errAPIKeyRefused.Error(), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,149 @@
+package middleware_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jackgris/twitter-backend/tweet/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+type apiKeys map[string]middleware.APIKey
+
+func (a apiKeys) VerifyAPIKey(_ context.Context, key string) (middleware.APIKey, error) {
+	if key == "twk_broken_secret" {
+		return middleware.APIKey{}, errors.New("auth service down")
+	}
+	apiKey, ok := a[key]
+	if !ok {
+		return middleware.APIKey{}, middleware.ErrInvalidAPIKey
+	}
+	return apiKey, nil
+}
+
+func TestAuthorizeAPIKeys(t *testing.T) {
+	keys := middleware.NewStaticKeySet(nil)
+	keys.RejectSuspended(suspensions{"suspended": true})
+	keys.AcceptAPIKeys(apiKeys{
+		"twk_reader_secret": {ID: "key-1", UserID: "bot-1", Username: "reader", Scopes: []middleware.Scope{middleware.ScopeTweetRead}},
+		"twk_writer_secret": {ID: "key-2", UserID: "bot-2", Username: "writer", Scopes: []middleware.Scope{middleware.ScopeTweetRead, middleware.ScopeTweetWrite}},
+		"twk_banned_secret": {ID: "key-3", UserID: "suspended", Username: "banned", Scopes: []middleware.Scope{middleware.ScopeTweetRead}},
+	}, middleware.ScopeTweetRead, middleware.ScopeTweetWrite)
+
+	tests := []struct {
+		name         string
+		method       string
+		key          string
+		expectedCode int
+		expectedUser string
+	}{
+		{name: "Read with read scope", method: http.MethodGet, key: "twk_reader_secret", expectedCode: http.StatusNoContent, expectedUser: "bot-1"},
+		{name: "Write without write scope", method: http.MethodPost, key: "twk_reader_secret", expectedCode: http.StatusForbidden},
+		{name: "Write with write scope", method: http.MethodDelete, key: "twk_writer_secret", expectedCode: http.StatusNoContent, expectedUser: "bot-2"},
+		{name: "Unknown key", method: http.MethodGet, key: "twk_revoked_secret", expectedCode: http.StatusUnauthorized},
+		{name: "Suspended bot", method: http.MethodGet, key: "twk_banned_secret", expectedCode: http.StatusForbidden},
+		{name: "Auth service down", method: http.MethodGet, key: "twk_broken_secret", expectedCode: http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var claims middleware.Claims
+			next := func(w http.ResponseWriter, r *http.Request) {
+				claims, _ = middleware.ClaimsFromContext(r.Context())
+				w.WriteHeader(http.StatusNoContent)
+			}
+
+			req := httptest.NewRequest(test.method, "/create", nil)
+			req.Header.Set("Authorization", "Bearer "+test.key)
+			rec := httptest.NewRecorder()
+
+			middleware.Authorize(next, keys)(rec, req)
+
+			assert.Equal(t, test.expectedCode, rec.Code)
+			assert.Equal(t, test.expectedUser, claims.UserID)
+		})
+	}
+
+	t.Run("API keys have no permissions", func(t *testing.T) {
+		claims := middleware.Claims{UserID: "bot-1", Role: middleware.RoleAdmin, APIKeyID: "key-1"}
+		assert.False(t, claims.Can(middleware.PermDeleteContent))
+		assert.True(t, middleware.Claims{Role: middleware.RoleAdmin}.Can(middleware.PermDeleteContent))
+	})
+
+	t.Run("Without API keys accepted", func(t *testing.T) {
+		next := func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/create", nil)
+		req.Header.Set("Authorization", "Bearer twk_reader_secret")
+		rec := httptest.NewRecorder()
+
+		middleware.Authorize(next, middleware.NewStaticKeySet(nil))(rec, req)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
+
+func TestRejectAPIKeys(t *testing.T) {
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	tests := []struct {
+		name         string
+		claims       middleware.Claims
+		expectedCode int
+	}{
+		{name: "Access token", claims: middleware.Claims{UserID: "user-1"}, expectedCode: http.StatusNoContent},
+		{name: "API key", claims: middleware.Claims{UserID: "bot-1", APIKeyID: "key-1"}, expectedCode: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/sessions", nil)
+			req = req.WithContext(middleware.ContextWithClaims(req.Context(), test.claims))
+			rec := httptest.NewRecorder()
+
+			middleware.RejectAPIKeys(next)(rec, req)
+
+			assert.Equal(t, test.expectedCode, rec.Code)
+		})
+	}
+}
+
+func TestAPIKeyClient(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		var input struct {
+			Key string `json:"key"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&input)
+		if input.Key != "twk_valid_secret" {
+			http.Error(w, "invalid API key", http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(middleware.APIKey{ID: "key-1", UserID: "bot-1", Username: "bot", Scopes: []middleware.Scope{middleware.ScopeTimelineRead}})
+	}))
+	defer srv.Close()
+
+	client := middleware.NewAPIKeyClient(srv.URL)
+
+	for range 2 {
+		apiKey, err := client.VerifyAPIKey(context.Background(), "twk_valid_secret")
+		assert.NoError(t, err)
+		assert.Equal(t, "bot-1", apiKey.UserID)
+		assert.Equal(t, []middleware.Scope{middleware.ScopeTimelineRead}, apiKey.Scopes)
+
+		_, err = client.VerifyAPIKey(context.Background(), "twk_invalid_secret")
+		assert.ErrorIs(t, err, middleware.ErrInvalidAPIKey)
+	}
+
+	// The second round is answered from the cache
+	assert.Equal(t, 2, hits)
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import "context"
+
+// Claims identify the user an authorized request acts as.
+type Claims struct {
+	UserID        string
+	Username      string
+	EmailVerified bool
+	// Role is what the user is allowed to do, tokens without one are of
+	// regular users
+	Role Role
+	// SessionID is the session the access token was issued for
+	SessionID string
+	// APIKeyID is set when a bot authorized with an API key, which only
+	// allows its Scopes
+	APIKeyID string
+	Scopes   []Scope
+}
+
+type ctxKey int
+
+const claimsKey ctxKey = iota
+
+// ContextWithClaims returns a copy of ctx carrying the verified claims.
+func ContextWithClaims(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, claimsKey, claims)
+}
+
+// ClaimsFromContext returns the claims Authorize put on the request context.
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsKey).(Claims)
+	return claims, ok
+}
@@ -0,0 +1,10 @@
+package middleware
+
+import "time"
+
+// SetMinRefresh lets tests refresh the key set without waiting.
+func (k *KeySet) SetMinRefresh(d time.Duration) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.minRefresh = d
+}
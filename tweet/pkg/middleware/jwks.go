@@ -0,0 +1,231 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// jwksTTL is how long a fetched key set is used before fetching it again.
+	jwksTTL = 5 * time.Minute
+	// jwksMinRefresh limits how often an unknown kid can force a fetch, so
+	// tokens with made up kids can't be used to flood the auth service.
+	jwksMinRefresh = 10 * time.Second
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// KeySet holds the public keys access tokens are validated with. The keys
+// are fetched from the auth service JWKS endpoint and cached. Keys read from
+// the fallback file are used when the endpoint can't be reached or doesn't
+// know the kid, which allows running the services and tests offline.
+type KeySet struct {
+	url        string
+	client     *http.Client
+	minRefresh time.Duration
+	mu         sync.RWMutex
+	keys       map[string]*rsa.PublicKey
+	expiresAt  time.Time
+	fetchedAt  time.Time
+	fallback   []*rsa.PublicKey
+	// suspensions rejects the tokens of suspended users when it is set
+	suspensions Suspensions
+	// roles replaces the role claim of access tokens when it is set
+	roles Roles
+	// apiKeys verifies the API keys of bots, which are refused when it is
+	// nil, and the scopes they need to read and write
+	apiKeys    APIKeys
+	readScope  Scope
+	writeScope Scope
+	// issuer and audience are the iss and aud access tokens need, when they
+	// are set
+	issuer   string
+	audience string
+}
+
+// NewKeySet creates a key set fetching from jwksURL. fallbackFile is an
+// optional path to a PEM file with one or more RSA public keys.
+func NewKeySet(jwksURL, fallbackFile string) (*KeySet, error) {
+	k := &KeySet{
+		url:        jwksURL,
+		client:     &http.Client{Timeout: 2 * time.Second},
+		minRefresh: jwksMinRefresh,
+		keys:       map[string]*rsa.PublicKey{},
+	}
+
+	if fallbackFile != "" {
+		keys, err := readPublicKeys(fallbackFile)
+		if err != nil {
+			return nil, err
+		}
+		k.fallback = keys
+	}
+
+	return k, nil
+}
+
+// NewStaticKeySet creates a key set that never fetches, for the auth service
+// which owns the keys.
+func NewStaticKeySet(keys map[string]*rsa.PublicKey) *KeySet {
+	return &KeySet{
+		keys:      keys,
+		expiresAt: time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// Key returns the public key for kid.
+func (k *KeySet) Key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	k.mu.RLock()
+	key, ok := k.keys[kid]
+	stale := time.Now().After(k.expiresAt)
+	canRefresh := time.Since(k.fetchedAt) > k.minRefresh
+	k.mu.RUnlock()
+
+	if ok && !stale {
+		return key, nil
+	}
+
+	if k.url != "" && (stale || canRefresh) {
+		if err := k.refresh(ctx); err == nil {
+			k.mu.RLock()
+			key, ok = k.keys[kid]
+			k.mu.RUnlock()
+		}
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+
+	return key, nil
+}
+
+// keyfunc resolves the key for a token by its kid. When the kid is unknown
+// every fallback key is tried.
+func (k *KeySet) keyfunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexepcted signing method: %v", token.Header["alg"])
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		key, err := k.Key(ctx, kid)
+		if err == nil {
+			return key, nil
+		}
+
+		if len(k.fallback) == 0 {
+			return nil, err
+		}
+
+		set := jwt.VerificationKeySet{}
+		for _, key := range k.fallback {
+			set.Keys = append(set.Keys, key)
+		}
+		return set, nil
+	}
+}
+
+func (k *KeySet) refresh(ctx context.Context) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	// Another request may have refreshed while this one waited for the lock.
+	if time.Since(k.fetchedAt) <= k.minRefresh && time.Now().Before(k.expiresAt) {
+		return nil
+	}
+	k.fetchedAt = time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching JWKS: status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("decoding JWKS: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return fmt.Errorf("decoding JWKS key %q: %w", jwk.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return fmt.Errorf("decoding JWKS key %q: %w", jwk.Kid, err)
+		}
+
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	k.keys = keys
+	k.expiresAt = time.Now().Add(jwksTTL)
+
+	return nil
+}
+
+func readPublicKeys(path string) ([]*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading public keys: %w", err)
+	}
+
+	var keys []*rsa.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		key, err := jwt.ParseRSAPublicKeyFromPEM(pem.EncodeToMemory(block))
+		if err != nil {
+			return nil, fmt.Errorf("parsing public key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no public keys in %s", path)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,130 @@
+package middleware_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackgris/twitter-backend/tweet/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func signToken(t *testing.T, key *rsa.PrivateKey, kid string) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"name": "jackgris",
+		"ID":   "csvqda265b6s73dtmot0",
+		"exp":  time.Now().Add(time.Minute).Unix(),
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	assert.NoError(t, err)
+	return signed
+}
+
+func jwk(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	var rotated atomic.Bool
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		keys := []map[string]string{jwk("old", &oldKey.PublicKey)}
+		if rotated.Load() {
+			keys = append(keys, jwk("new", &newKey.PublicKey))
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	}))
+	defer srv.Close()
+
+	keys, err := middleware.NewKeySet(srv.URL, "")
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	_, claims, err := keys.ValidateJwt(ctx, signToken(t, oldKey, "old"))
+	assert.NoError(t, err)
+	assert.Equal(t, "jackgris", claims["name"])
+
+	_, _, err = keys.ValidateJwt(ctx, signToken(t, oldKey, "old"))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), fetches.Load(), "known keys are served from the cache")
+
+	_, _, err = keys.ValidateJwt(ctx, signToken(t, newKey, "new"))
+	assert.Error(t, err, "the new key isn't published yet")
+
+	_, _, err = keys.ValidateJwt(ctx, signToken(t, oldKey, "forged"))
+	assert.ErrorIs(t, err, middleware.ErrUnknownKey)
+	assert.Equal(t, int32(1), fetches.Load(), "unknown kids can't force a fetch right after another one")
+
+	rotated.Store(true)
+	_, _, err = keys.ValidateJwt(ctx, signToken(t, newKey, "new"))
+	assert.ErrorIs(t, err, middleware.ErrUnknownKey)
+
+	keys.SetMinRefresh(0)
+	_, _, err = keys.ValidateJwt(ctx, signToken(t, newKey, "new"))
+	assert.NoError(t, err, "an unknown kid refreshes the key set")
+	assert.Equal(t, int32(2), fetches.Load())
+
+	_, _, err = keys.ValidateJwt(ctx, signToken(t, oldKey, "old"))
+	assert.NoError(t, err, "the old key stays valid while it's published")
+}
+
+func TestKeySetFallbackFile(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "public.pem")
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600)
+	assert.NoError(t, err)
+
+	// Nothing listens on this address, so only the fallback file can be used.
+	keys, err := middleware.NewKeySet("http://127.0.0.1:1/.well-known/jwks.json", path)
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	_, claims, err := keys.ValidateJwt(ctx, signToken(t, key, ""))
+	assert.NoError(t, err)
+	assert.Equal(t, "csvqda265b6s73dtmot0", claims["ID"])
+
+	_, _, err = keys.ValidateJwt(ctx, signToken(t, key, "some-kid"))
+	assert.NoError(t, err)
+
+	_, _, err = keys.ValidateJwt(ctx, signToken(t, other, ""))
+	assert.Error(t, err)
+
+	_, err = middleware.NewKeySet("", filepath.Join(t.TempDir(), "missing.pem"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,80 @@
+package middleware_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackgris/twitter-backend/tweet/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateJwtClaims(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	keys := middleware.NewStaticKeySet(map[string]*rsa.PublicKey{"key": &key.PublicKey})
+	keys.RequireClaims("twitter-backend-auth", "twitter-backend")
+
+	claims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"ID":  "csvqda265b6s73dtmot0",
+			"iss": "twitter-backend-auth",
+			"aud": []string{"twitter-backend"},
+			"exp": time.Now().Add(time.Minute).Unix(),
+		}
+	}
+
+	tests := []struct {
+		name  string
+		edit  func(jwt.MapClaims)
+		valid bool
+	}{
+		{name: "Valid token", edit: func(jwt.MapClaims) {}, valid: true},
+		{name: "Wrong issuer", edit: func(c jwt.MapClaims) { c["iss"] = "another-service" }},
+		{name: "Without issuer", edit: func(c jwt.MapClaims) { delete(c, "iss") }},
+		{name: "Wrong audience", edit: func(c jwt.MapClaims) { c["aud"] = []string{"another-app"} }},
+		{name: "Without audience", edit: func(c jwt.MapClaims) { delete(c, "aud") }},
+		{name: "Without expiry", edit: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{name: "Expired", edit: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := claims()
+			test.edit(c)
+
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, c)
+			token.Header["kid"] = "key"
+			signed, err := token.SignedString(key)
+			assert.NoError(t, err)
+
+			_, _, err = keys.ValidateJwt(context.Background(), signed)
+
+			if test.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+
+	t.Run("Without required claims", func(t *testing.T) {
+		keys := middleware.NewStaticKeySet(map[string]*rsa.PublicKey{"key": &key.PublicKey})
+
+		c := claims()
+		delete(c, "iss")
+		delete(c, "aud")
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, c)
+		token.Header["kid"] = "key"
+		signed, err := token.SignedString(key)
+		assert.NoError(t, err)
+
+		_, _, err = keys.ValidateJwt(context.Background(), signed)
+
+		assert.NoError(t, err)
+	})
+}
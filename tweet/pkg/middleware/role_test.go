@@ -0,0 +1,124 @@
+package middleware_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackgris/twitter-backend/tweet/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequire(t *testing.T) {
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	tests := []struct {
+		name         string
+		claims       *middleware.Claims
+		perm         middleware.Permission
+		expectedCode int
+	}{
+		{name: "Admin", claims: &middleware.Claims{UserID: "user-1", Role: middleware.RoleAdmin}, perm: middleware.PermManageRoles, expectedCode: http.StatusNoContent},
+		{name: "Moderator", claims: &middleware.Claims{UserID: "user-1", Role: middleware.RoleModerator}, perm: middleware.PermSuspendUsers, expectedCode: http.StatusNoContent},
+		{name: "Moderator without permission", claims: &middleware.Claims{UserID: "user-1", Role: middleware.RoleModerator}, perm: middleware.PermManageRoles, expectedCode: http.StatusForbidden},
+		{name: "User", claims: &middleware.Claims{UserID: "user-1", Role: middleware.RoleUser}, perm: middleware.PermDeleteContent, expectedCode: http.StatusForbidden},
+		{name: "No role", claims: &middleware.Claims{UserID: "user-1"}, perm: middleware.PermDeleteContent, expectedCode: http.StatusForbidden},
+		{name: "Not authorized", perm: middleware.PermDeleteContent, expectedCode: http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin", nil)
+			if test.claims != nil {
+				req = req.WithContext(middleware.ContextWithClaims(req.Context(), *test.claims))
+			}
+			rec := httptest.NewRecorder()
+
+			middleware.Require(next, test.perm)(rec, req)
+
+			assert.Equal(t, test.expectedCode, rec.Code)
+		})
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	role, ok := middleware.ParseRole("moderator")
+	assert.True(t, ok)
+	assert.Equal(t, middleware.RoleModerator, role)
+
+	role, ok = middleware.ParseRole("root")
+	assert.False(t, ok)
+	assert.Equal(t, middleware.RoleUser, role)
+}
+
+type roles map[string]string
+
+func (r roles) Role(userID string) (string, error) {
+	if userID == "broken" {
+		return "", errors.New("database down")
+	}
+	if role, ok := r[userID]; ok {
+		return role, nil
+	}
+	return "user", nil
+}
+
+func TestAuthorizeCurrentRole(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	keys := middleware.NewStaticKeySet(map[string]*rsa.PublicKey{"key": &key.PublicKey})
+	keys.CheckRoles(roles{"promoted": "admin", "demoted": "user"})
+
+	sign := func(userID, role string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"name": "jackgris",
+			"ID":   userID,
+			"role": role,
+			"exp":  time.Now().Add(time.Minute).Unix(),
+		})
+		token.Header["kid"] = "key"
+		signed, err := token.SignedString(key)
+		assert.NoError(t, err)
+		return signed
+	}
+
+	tests := []struct {
+		name         string
+		userID       string
+		role         string
+		expectedCode int
+		expectedRole middleware.Role
+	}{
+		{name: "Demoted moderator", userID: "demoted", role: "moderator", expectedCode: http.StatusNoContent, expectedRole: middleware.RoleUser},
+		{name: "Promoted user", userID: "promoted", role: "user", expectedCode: http.StatusNoContent, expectedRole: middleware.RoleAdmin},
+		{name: "Role unknown", userID: "broken", role: "admin", expectedCode: http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var role middleware.Role
+			next := func(w http.ResponseWriter, r *http.Request) {
+				claims, _ := middleware.ClaimsFromContext(r.Context())
+				role = claims.Role
+				w.WriteHeader(http.StatusNoContent)
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, "/tweet/1", nil)
+			req.Header.Set("Authorization", "Bearer "+sign(test.userID, test.role))
+			rec := httptest.NewRecorder()
+
+			middleware.Authorize(next, keys)(rec, req)
+
+			assert.Equal(t, test.expectedCode, rec.Code)
+			assert.Equal(t, test.expectedRole, role)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package middleware_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackgris/twitter-backend/tweet/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+type suspensions map[string]bool
+
+func (s suspensions) IsSuspended(userID string) (bool, error) {
+	if userID == "broken" {
+		return false, errors.New("database down")
+	}
+	return s[userID], nil
+}
+
+func TestAuthorizeRolesAndSuspensions(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	keys := middleware.NewStaticKeySet(map[string]*rsa.PublicKey{"key": &key.PublicKey})
+	keys.RejectSuspended(suspensions{"suspended": true})
+
+	sign := func(userID, role string) string {
+		claims := jwt.MapClaims{
+			"name": "jackgris",
+			"ID":   userID,
+			"exp":  time.Now().Add(time.Minute).Unix(),
+		}
+		if role != "" {
+			claims["role"] = role
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "key"
+		signed, err := token.SignedString(key)
+		assert.NoError(t, err)
+		return signed
+	}
+
+	tests := []struct {
+		name         string
+		userID       string
+		role         string
+		expectedCode int
+		expectedRole middleware.Role
+	}{
+		{name: "Moderator", userID: "user-1", role: "moderator", expectedCode: http.StatusNoContent, expectedRole: middleware.RoleModerator},
+		{name: "Without role", userID: "user-1", expectedCode: http.StatusNoContent, expectedRole: middleware.RoleUser},
+		{name: "Unknown role", userID: "user-1", role: "root", expectedCode: http.StatusNoContent, expectedRole: middleware.RoleUser},
+		{name: "Suspended", userID: "suspended", role: "admin", expectedCode: http.StatusForbidden},
+		{name: "Suspension unknown", userID: "broken", expectedCode: http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var role middleware.Role
+			next := func(w http.ResponseWriter, r *http.Request) {
+				claims, _ := middleware.ClaimsFromContext(r.Context())
+				role = claims.Role
+				w.WriteHeader(http.StatusNoContent)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/timeline", nil)
+			req.Header.Set("Authorization", "Bearer "+sign(test.userID, test.role))
+			rec := httptest.NewRecorder()
+
+			middleware.Authorize(next, keys)(rec, req)
+
+			assert.Equal(t, test.expectedCode, rec.Code)
+			assert.Equal(t, test.expectedRole, role)
+		})
+	}
+}
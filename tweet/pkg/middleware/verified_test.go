@@ -0,0 +1,40 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jackgris/twitter-backend/tweet/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifiedEmail(t *testing.T) {
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	tests := []struct {
+		name         string
+		claims       *middleware.Claims
+		expectedCode int
+	}{
+		{name: "Verified", claims: &middleware.Claims{UserID: "user-1", EmailVerified: true}, expectedCode: http.StatusNoContent},
+		{name: "Unverified", claims: &middleware.Claims{UserID: "user-1"}, expectedCode: http.StatusForbidden},
+		{name: "Not authorized", expectedCode: http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/create", nil)
+			if test.claims != nil {
+				req = req.WithContext(middleware.ContextWithClaims(req.Context(), *test.claims))
+			}
+			rec := httptest.NewRecorder()
+
+			middleware.VerifiedEmail(next)(rec, req)
+
+			assert.Equal(t, test.expectedCode, rec.Code)
+		})
+	}
+}